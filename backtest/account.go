@@ -0,0 +1,274 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"trading/networking/feed"
+)
+
+const (
+	SideBuy  = feed.SideBuy
+	SideSell = feed.SideSell
+)
+
+// Account is the account simulated by a backtest: cash in base currency and
+// long positions in quote currency by market. Orders are market orders
+// filled at the time of the event being replayed.
+type Account struct {
+	exchange  string
+	now       int64
+	balance   float64
+	cash      float64
+	positions map[string]*position
+	books     map[string]*Book
+	prices    map[string]float64
+	fills     []*Fill
+	closed    []*ClosedTrade
+	equity    []*EquityPoint
+}
+
+// position cost is the base currency spent (fees included) on quantity.
+type position struct {
+	quantity float64
+	cost     float64
+	opened   time.Time
+}
+
+// Fill is an order filled by the simulation. Price is the average price
+// paid before fees, Fee is in base currency and SlippageBps is relative to
+// the mid of the book (last price without book).
+type Fill struct {
+	Time        time.Time
+	Market      string
+	Side        string
+	Quantity    float64
+	Price       float64
+	Fee         float64
+	SlippageBps float64
+	FromBook    bool
+}
+
+// ClosedTrade is a sell of (part of) a position. EntryPrice is the average
+// cost of the position, fees included, and PnL is net of all fees.
+type ClosedTrade struct {
+	Market     string
+	Opened     time.Time
+	Closed     time.Time
+	Quantity   float64
+	EntryPrice float64
+	ExitPrice  float64
+	PnL        float64
+}
+
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+func newAccount(exchange string, balance float64) *Account {
+
+	return &Account{
+		exchange:  exchange,
+		balance:   balance,
+		cash:      balance,
+		positions: make(map[string]*position),
+		books:     make(map[string]*Book),
+		prices:    make(map[string]float64),
+	}
+}
+
+// Time returns the time of the event being replayed.
+func (a *Account) Time() time.Time {
+	return time.Unix(0, a.now).UTC()
+}
+
+func (a *Account) Cash() float64 {
+	return a.cash
+}
+
+// Position returns the quantity held on market.
+func (a *Account) Position(market string) float64 {
+
+	if p, ok := a.positions[market]; ok {
+		return p.quantity
+	}
+
+	return 0.0
+}
+
+// Price returns the last price of market (0 if none yet).
+func (a *Account) Price(market string) float64 {
+	return a.prices[market]
+}
+
+// Equity returns the cash and the positions valued at the last prices.
+func (a *Account) Equity() float64 {
+
+	equity := a.cash
+	for market, p := range a.positions {
+		equity += p.quantity * a.prices[market]
+	}
+
+	return equity
+}
+
+// Buy fills quantity of market, cost and fees being paid from the cash.
+func (a *Account) Buy(market string, quantity float64) (*Fill, error) {
+
+	fill, err := a.simulateFill(market, SideBuy, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	cost := fill.Price*fill.Quantity + fill.Fee
+	if cost > a.cash {
+		return nil, fmt.Errorf("insufficient cash: %f < %f", a.cash, cost)
+	}
+	a.cash -= cost
+
+	p, ok := a.positions[market]
+	if !ok || p.quantity == 0.0 {
+		p = &position{opened: fill.Time}
+		a.positions[market] = p
+	}
+	p.quantity += fill.Quantity
+	p.cost += cost
+
+	a.fills = append(a.fills, fill)
+	return fill, nil
+}
+
+// Sell fills quantity of the position on market, closing it if entirely
+// sold.
+func (a *Account) Sell(market string, quantity float64) (*Fill, error) {
+
+	p, ok := a.positions[market]
+	if !ok || quantity > p.quantity {
+		return nil, fmt.Errorf("insufficient position: %f < %f",
+			a.Position(market), quantity)
+	}
+
+	fill, err := a.simulateFill(market, SideSell, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	proceeds := fill.Price*fill.Quantity - fill.Fee
+	cost := p.cost * fill.Quantity / p.quantity
+	a.cash += proceeds
+
+	a.closed = append(a.closed, &ClosedTrade{
+		Market:     market,
+		Opened:     p.opened,
+		Closed:     fill.Time,
+		Quantity:   fill.Quantity,
+		EntryPrice: p.cost / p.quantity,
+		ExitPrice:  fill.Price,
+		PnL:        proceeds - cost,
+	})
+
+	p.quantity -= fill.Quantity
+	p.cost -= cost
+	if p.quantity == 0.0 {
+		delete(a.positions, market)
+	}
+
+	a.fills = append(a.fills, fill)
+	return fill, nil
+}
+
+// simulateFill walks the last book of market when recent enough. The
+// quantity exceeding the book, or the whole quantity without book, is
+// filled at the worst (last) price moved by slippage_bps.
+func (a *Account) simulateFill(market, side string,
+	quantity float64) (*Fill, error) {
+
+	if quantity <= 0.0 {
+		return nil, fmt.Errorf("invalid quantity: %f", quantity)
+	}
+
+	fill := &Fill{
+		Time:     a.Time(),
+		Market:   market,
+		Side:     side,
+		Quantity: quantity,
+	}
+
+	slippage := conf.Backtest.SlippageBps / 10000
+	if side == SideSell {
+		slippage = -slippage
+	}
+
+	reference := a.prices[market]
+	remaining := quantity
+	total := 0.0
+
+	book, ok := a.books[market]
+	if ok && a.now-book.Time.UnixNano() <= int64(conf.Backtest.maxBookAge) &&
+		len(book.Bids) != 0 && len(book.Asks) != 0 {
+
+		levels := book.Asks
+		if side == SideSell {
+			levels = book.Bids
+		}
+
+		for _, l := range levels {
+
+			filled := math.Min(remaining, l.Quantity)
+			total += filled * l.Rate
+			remaining -= filled
+
+			if remaining == 0.0 {
+				break
+			}
+		}
+
+		reference = (book.Bids[0].Rate + book.Asks[0].Rate) / 2
+		fill.FromBook = true
+
+		if remaining > 0.0 {
+			total += remaining * levels[len(levels)-1].Rate * (1 + slippage)
+		}
+
+	} else {
+
+		if reference == 0.0 {
+			return nil, fmt.Errorf("no price for %s", market)
+		}
+		total = quantity * reference * (1 + slippage)
+	}
+
+	fill.Price = total / quantity
+	fill.Fee = total * conf.Backtest.TakerFees[a.exchange]
+	fill.SlippageBps = (fill.Price - reference) / reference * 10000
+	if side == SideSell {
+		fill.SlippageBps = -fill.SlippageBps
+	}
+
+	return fill, nil
+}
+
+// updateBook sets the last book of its market, its mid becoming the last
+// price.
+func (a *Account) updateBook(b *Book) {
+
+	a.books[b.Market] = b
+
+	if len(b.Bids) != 0 && len(b.Asks) != 0 {
+		a.prices[b.Market] = (b.Bids[0].Rate + b.Asks[0].Rate) / 2
+	}
+}
+
+// markEquity records the equity at the current time, once per timestamp.
+func (a *Account) markEquity() {
+
+	ep := &EquityPoint{a.Time(), a.Equity()}
+
+	if n := len(a.equity); n != 0 && a.equity[n-1].Time.Equal(ep.Time) {
+		a.equity[n-1] = ep
+		return
+	}
+
+	a.equity = append(a.equity, ep)
+}
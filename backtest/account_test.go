@@ -0,0 +1,70 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulateFill(t *testing.T) {
+
+	book := &Book{
+		Market: "BTC_ETH",
+		Time:   testStart,
+		Bids:   []*Level{{99, 1}, {98, 2}},
+		Asks:   []*Level{{101, 1}, {102, 2}},
+	}
+
+	tests := []struct {
+		name     string
+		book     *Book
+		price    float64
+		after    time.Duration
+		side     string
+		quantity float64
+		total    float64 // 0 if no fill
+		slippage float64
+		fromBook bool
+	}{
+		{"walk the asks", book, 100, time.Minute, SideBuy, 2,
+			101 + 102, 150, true},
+		{"beyond the bids", book, 100, time.Minute, SideSell, 4,
+			99 + 98*2 + 98*0.999, 177.45, true},
+		{"stale book", book, 100, 10 * time.Minute, SideBuy, 2,
+			200 * 1.001, 10, false},
+		{"last price", nil, 100, 0, SideSell, 2, 200 * 0.999, 10, false},
+		{"no price", nil, 0, 0, SideBuy, 2, 0, 0, false},
+		{"invalid quantity", book, 100, time.Minute, SideBuy, 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+
+		a := newAccount(testExchange, 1000)
+		a.now = testStart.Add(tt.after).UnixNano()
+		a.prices["BTC_ETH"] = tt.price
+		if tt.book != nil {
+			a.books["BTC_ETH"] = tt.book
+		}
+
+		fill, err := a.simulateFill("BTC_ETH", tt.side, tt.quantity)
+		if tt.total == 0.0 {
+			if err == nil {
+				t.Errorf("%s: got %+v, want an error", tt.name, *fill)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		if !approxEqual(fill.Price, tt.total/tt.quantity) ||
+			!approxEqual(fill.Fee, tt.total*0.0025) ||
+			!approxEqual(fill.SlippageBps, tt.slippage) ||
+			fill.FromBook != tt.fromBook {
+			t.Errorf("%s: got %+v, want price %v fee %v slippage %v book %t",
+				tt.name, *fill, tt.total/tt.quantity, tt.total*0.0025,
+				tt.slippage, tt.fromBook)
+		}
+	}
+}
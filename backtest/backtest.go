@@ -0,0 +1,294 @@
+package backtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+	"trading/networking/database"
+	"trading/networking/feed"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+	prefixed "github.com/x-cray/logrus-prefixed-formatter"
+)
+
+var (
+	conf     *configuration
+	logger   *logrus.Entry
+	dbClient ifxClient.Client
+)
+
+type configuration struct {
+	Backtest *backtestConf `json:"backtest"`
+}
+
+// backtestConf sets the metrics database (candles) and the exchanges
+// databases (trades, order books) replayed chunk by chunk. Fills pay the
+// taker fees (rate) of the exchange and walk the last stored book not older
+// than max_book_age, else the last price moved by slippage_bps.
+type backtestConf struct {
+	LogLevel    string                 `json:"log_level"`
+	Schema      map[string]string      `json:"schema"`
+	Chunk       string                 `json:"chunk"`
+	TakerFees   map[string]float64     `json:"taker_fees"`
+	SlippageBps float64                `json:"slippage_bps"`
+	MaxBookAge  string                 `json:"max_book_age"`
+	Sources     map[string]*sourceConf `json:"sources"`
+	chunk       time.Duration
+	maxBookAge  time.Duration
+}
+
+type sourceConf struct {
+	Schema map[string]string `json:"schema"`
+}
+
+// Options describes a backtest. Candles of ohlc_<Period> are always
+// replayed, trades and stored order books only if requested. Markets is
+// optional (all markets of the exchange if empty) and Balance is the initial
+// cash in base currency (BTC).
+type Options struct {
+	Exchange string
+	Markets  []string
+	Period   string
+	From     time.Time
+	To       time.Time
+	Balance  float64
+	Trades   bool
+	Books    bool
+}
+
+// Strategy receives the events in time order and places its orders on the
+// account. Candles are received at their close.
+type Strategy interface {
+	OnCandle(a *Account, c *Candle)
+	OnTrade(a *Account, t *Trade)
+	OnBook(a *Account, b *Book)
+}
+
+type Candle struct {
+	Market          string
+	Start           time.Time
+	Open            float64
+	High            float64
+	Low             float64
+	Close           float64
+	Volume          float64
+	Quantity        float64
+	WeightedAverage float64
+}
+
+// trades and order books are read from the feed stored by the ingestion
+type (
+	Trade = feed.Trade
+	Book  = feed.Book
+	Level = feed.Level
+)
+
+// events of a same timestamp are replayed books first, then trades and
+// candles
+const (
+	eventBook = iota
+	eventTrade
+	eventCandle
+)
+
+type event struct {
+	timestamp int64
+	kind      int
+	book      *Book
+	trade     *Trade
+	candle    *Candle
+}
+
+func init() {
+
+	customFormatter := new(prefixed.TextFormatter)
+	customFormatter.FullTimestamp = true
+	customFormatter.ForceColors = true
+	customFormatter.ForceFormatting = true
+	logrus.SetFormatter(customFormatter)
+
+	logger = logrus.WithField("prefix", "[backtest]")
+
+	content, err := ioutil.ReadFile("conf.json")
+
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading configuration")
+	}
+
+	if err := json.Unmarshal(content, &conf); err != nil {
+		logger.WithField("error", err).Fatal("loading configuration")
+	}
+
+	switch conf.Backtest.LogLevel {
+	case "debug":
+		logrus.SetLevel(logrus.DebugLevel)
+	case "info":
+		logrus.SetLevel(logrus.InfoLevel)
+	case "warn":
+		logrus.SetLevel(logrus.WarnLevel)
+	case "error":
+		logrus.SetLevel(logrus.ErrorLevel)
+	case "fatal":
+		logrus.SetLevel(logrus.FatalLevel)
+	case "panic":
+		logrus.SetLevel(logrus.PanicLevel)
+	default:
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+
+	if conf.Backtest.chunk, err = time.ParseDuration(
+		conf.Backtest.Chunk); err != nil {
+		logger.WithField("error", err).Fatal("time.ParseDuration")
+	}
+
+	if conf.Backtest.maxBookAge, err = time.ParseDuration(
+		conf.Backtest.MaxBookAge); err != nil {
+		logger.WithField("error", err).Fatal("time.ParseDuration")
+	}
+
+	if dbClient, err = database.NewdbClient(); err != nil {
+		logger.WithField("error", err).Fatal("database.NewdbClient")
+	}
+}
+
+// Run replays the events of the exchange between from and to through the
+// strategy and returns the report of the simulated account.
+func Run(opts *Options, strategy Strategy) (*Report, error) {
+
+	source, ok := conf.Backtest.Sources[opts.Exchange]
+	if !ok {
+		return nil, fmt.Errorf("unknown exchange: %s", opts.Exchange)
+	}
+
+	if !opts.From.Before(opts.To) {
+		return nil, fmt.Errorf("invalid range: %s - %s", opts.From, opts.To)
+	}
+
+	period, err := time.ParseDuration(opts.Period)
+	if err != nil {
+		return nil, fmt.Errorf("time.ParseDuration: %v", err)
+	}
+
+	account := newAccount(opts.Exchange, opts.Balance)
+	end := opts.To.UnixNano()
+
+	for start := opts.From.UnixNano(); start < end; start += int64(
+		conf.Backtest.chunk) {
+
+		chunkEnd := start + int64(conf.Backtest.chunk)
+		if chunkEnd > end {
+			chunkEnd = end
+		}
+
+		events, err := loadEvents(opts, source, period, start, chunkEnd)
+		if err != nil {
+			return nil, fmt.Errorf("loadEvents: %v", err)
+		}
+
+		for _, e := range events {
+
+			account.now = e.timestamp
+
+			switch e.kind {
+			case eventBook:
+				account.updateBook(e.book)
+				strategy.OnBook(account, e.book)
+
+			case eventTrade:
+				account.prices[e.trade.Market] = e.trade.Rate
+				strategy.OnTrade(account, e.trade)
+
+			case eventCandle:
+				account.prices[e.candle.Market] = e.candle.Close
+				strategy.OnCandle(account, e.candle)
+				account.markEquity()
+			}
+		}
+
+		logger.WithFields(logrus.Fields{
+			"exchange": opts.Exchange,
+			"until":    time.Unix(0, chunkEnd).UTC(),
+			"events":   len(events),
+			"equity":   account.Equity(),
+		}).Info("Run: chunk replayed")
+	}
+
+	return account.report(opts, period), nil
+}
+
+// loadEvents returns the events of [start, end) sorted by time. Candles are
+// timestamped and selected by their close, a candle closing at the end of a
+// chunk being replayed with the books and trades of the next one.
+func loadEvents(opts *Options, source *sourceConf, period time.Duration,
+	start, end int64) ([]*event, error) {
+
+	candles, err := getCandles(opts, period, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("getCandles: %v", err)
+	}
+
+	events := make([]*event, 0, len(candles))
+	for _, c := range candles {
+		events = append(events, &event{
+			timestamp: c.Start.Add(period).UnixNano(),
+			kind:      eventCandle,
+			candle:    c,
+		})
+	}
+
+	if opts.Trades {
+
+		trades, err := getTrades(opts, source, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("getTrades: %v", err)
+		}
+
+		for _, t := range trades {
+			events = append(events, &event{
+				timestamp: t.Time.UnixNano(),
+				kind:      eventTrade,
+				trade:     t,
+			})
+		}
+	}
+
+	if opts.Books {
+
+		books, err := getBooks(opts, source, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("getBooks: %v", err)
+		}
+
+		for _, b := range books {
+			events = append(events, &event{
+				timestamp: b.Time.UnixNano(),
+				kind:      eventBook,
+				book:      b,
+			})
+		}
+	}
+
+	sortEvents(events)
+
+	return events, nil
+}
+
+// sortEvents sorts events by time, books first, then trades and candles.
+func sortEvents(events []*event) {
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].timestamp != events[j].timestamp {
+			return events[i].timestamp < events[j].timestamp
+		}
+		return events[i].kind < events[j].kind
+	})
+}
+
+// marketsCondition returns the where clause restricting a query to the
+// markets of the options (all markets if none).
+func (opts *Options) marketsCondition() string {
+	return feed.MarketsCondition(opts.Markets)
+}
@@ -0,0 +1,37 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// the tests run on the exchange of conf.json
+const testExchange = "poloniex"
+
+var testStart = time.Date(2017, 10, 2, 0, 0, 0, 0, time.UTC)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1.0, math.Abs(b))
+}
+
+func TestSortEvents(t *testing.T) {
+
+	at := testStart.UnixNano()
+	candle := &event{timestamp: at, kind: eventCandle}
+	trade := &event{timestamp: at, kind: eventTrade}
+	sameTrade := &event{timestamp: at, kind: eventTrade}
+	book := &event{timestamp: at, kind: eventBook}
+	before := &event{timestamp: at - 1, kind: eventCandle}
+
+	// the candle closing at the chunk boundary comes with the next chunk
+	events := []*event{candle, trade, before, sameTrade, book}
+	sortEvents(events)
+
+	want := []*event{before, book, trade, sameTrade, candle}
+	for i, e := range events {
+		if e != want[i] {
+			t.Errorf("event %d: got %+v, want %+v", i, *e, *want[i])
+		}
+	}
+}
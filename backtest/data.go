@@ -0,0 +1,120 @@
+package backtest
+
+import (
+	"fmt"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+	"trading/networking/feed"
+
+	"github.com/sirupsen/logrus"
+)
+
+// getCandles returns the candles of ohlc_<period> closing within
+// [start, end). Gap candles without close are skipped.
+func getCandles(opts *Options, period time.Duration,
+	start, end int64) ([]*Candle, error) {
+
+	query := fmt.Sprintf(
+		`SELECT open, high, low, close, volume, quantity, weighted_average
+    FROM ohlc_%s
+    WHERE exchange = '%s' AND time >= %d AND time < %d%s
+    GROUP BY market`,
+		opts.Period, opts.Exchange,
+		start-int64(period), end-int64(period), opts.marketsCondition())
+
+	res, err := database.QueryDB(dbClient, query,
+		conf.Backtest.Schema["database"])
+	if err != nil {
+		return nil, fmt.Errorf("database.QueryDB: %v", err)
+	}
+
+	candles := make([]*Candle, 0)
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+
+		for _, rec := range serie.Values {
+
+			if rec[4] == nil {
+				continue
+			}
+
+			timestamp, err := networking.ConvertJsonValueToTime(rec[0])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":  err,
+					"market": market,
+				}).Error("getCandles: networking.ConvertJsonValueToTime")
+				continue
+			}
+
+			values := make([]float64, len(rec)-1)
+			for i, v := range rec[1:] {
+
+				if v == nil {
+					continue
+				}
+
+				if values[i], err = networking.ConvertJsonValueToFloat64(
+					v); err != nil {
+					break
+				}
+			}
+
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":  err,
+					"market": market,
+				}).Error("getCandles: networking.ConvertJsonValueToFloat64")
+				continue
+			}
+
+			candles = append(candles, &Candle{
+				Market:          market,
+				Start:           timestamp,
+				Open:            values[0],
+				High:            values[1],
+				Low:             values[2],
+				Close:           values[3],
+				Volume:          values[4],
+				Quantity:        values[5],
+				WeightedAverage: values[6],
+			})
+		}
+	}
+
+	return candles, nil
+}
+
+// getTrades returns the trades of the exchange within [start, end).
+func getTrades(opts *Options, source *sourceConf,
+	start, end int64) ([]*Trade, error) {
+
+	query := feed.TradesQuery(source.Schema["trades_measurement"],
+		start, end, opts.Markets)
+
+	res, err := database.QueryDB(dbClient, query, source.Schema["database"])
+	if err != nil {
+		return nil, fmt.Errorf("database.QueryDB: %v", err)
+	}
+
+	return feed.ParseTrades(opts.Exchange, res), nil
+}
+
+// getBooks returns the order books stored by the ingestion within
+// [start, end).
+func getBooks(opts *Options, source *sourceConf,
+	start, end int64) ([]*Book, error) {
+
+	query := feed.BooksQuery(source.Schema["book_orders_measurement"],
+		start, end, opts.Markets)
+
+	res, err := database.QueryDB(dbClient, query, source.Schema["database"])
+	if err != nil {
+		return nil, fmt.Errorf("database.QueryDB: %v", err)
+	}
+
+	return feed.ParseBooks(opts.Exchange, res), nil
+}
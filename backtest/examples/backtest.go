@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"trading/backtest"
+)
+
+// crossover holds a position on the markets whose fast moving average of
+// the closes is above the slow one, investing a fraction of the cash.
+type crossover struct {
+	fast     int
+	slow     int
+	fraction float64
+	closes   map[string][]float64
+}
+
+func (s *crossover) OnCandle(a *backtest.Account, c *backtest.Candle) {
+
+	closes := append(s.closes[c.Market], c.Close)
+	if len(closes) > s.slow {
+		closes = closes[1:]
+	}
+	s.closes[c.Market] = closes
+
+	if len(closes) < s.slow || c.Close == 0.0 {
+		return
+	}
+
+	above := average(closes[s.slow-s.fast:]) > average(closes)
+	position := a.Position(c.Market)
+
+	var err error
+
+	switch {
+	case above && position == 0.0:
+		_, err = a.Buy(c.Market, a.Cash()*s.fraction/c.Close)
+
+	case !above && position != 0.0:
+		_, err = a.Sell(c.Market, position)
+	}
+
+	if err != nil {
+		log.Printf("%s %s: %v", a.Time().Format(time.RFC3339), c.Market, err)
+	}
+}
+
+func (s *crossover) OnTrade(a *backtest.Account, t *backtest.Trade) {}
+
+func (s *crossover) OnBook(a *backtest.Account, b *backtest.Book) {}
+
+func average(values []float64) float64 {
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
+
+func main() {
+
+	exchange := flag.String("exchange", "", "exchange to backtest")
+	markets := flag.String("markets", "", "comma separated markets (all if empty)")
+	period := flag.String("period", "5m", "ohlc period of the candles")
+	from := flag.String("from", "", "start of the range (RFC3339)")
+	to := flag.String("to", "", "end of the range (RFC3339, now if empty)")
+	balance := flag.Float64("balance", 1, "initial cash (base currency)")
+	trades := flag.Bool("trades", false, "replay the trades")
+	books := flag.Bool("books", false, "replay the order books (fills)")
+	fast := flag.Int("fast", 10, "fast moving average length")
+	slow := flag.Int("slow", 30, "slow moving average length")
+	flag.Parse()
+
+	opts := &backtest.Options{
+		Exchange: *exchange,
+		Period:   *period,
+		Balance:  *balance,
+		Trades:   *trades,
+		Books:    *books,
+		To:       time.Now(),
+	}
+
+	if *markets != "" {
+		opts.Markets = strings.Split(*markets, ",")
+	}
+
+	var err error
+
+	if opts.From, err = time.Parse(time.RFC3339, *from); err != nil {
+		log.Fatalf("invalid from: %v", err)
+	}
+
+	if *to != "" {
+		if opts.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			log.Fatalf("invalid to: %v", err)
+		}
+	}
+
+	strategy := &crossover{
+		fast:     *fast,
+		slow:     *slow,
+		fraction: 0.2,
+		closes:   make(map[string][]float64),
+	}
+
+	report, err := backtest.Run(opts, strategy)
+	if err != nil {
+		log.Fatalf("backtest.Run: %v", err)
+	}
+
+	fmt.Print(report)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"trading/backtest"
+)
+
+func main() {
+
+	exchange := flag.String("exchange", "", "exchange of the signals")
+	markets := flag.String("markets", "", "comma separated markets (all if empty)")
+	generator := flag.String("generator", "", "generator (all if empty)")
+	period := flag.String("period", "5m", "ohlc period of the prices")
+	delay := flag.String("delay", "",
+		"delay before a signal is known (period of its source if empty)")
+	horizons := flag.String("horizons", "5m,1h,24h", "comma separated horizons")
+	from := flag.String("from", "", "start of the range (RFC3339)")
+	to := flag.String("to", "", "end of the range (RFC3339, now if empty)")
+	flag.Parse()
+
+	opts := &backtest.SignalsOptions{
+		Exchange:  *exchange,
+		Generator: *generator,
+		Period:    *period,
+		To:        time.Now(),
+	}
+
+	if *delay != "" {
+		d, err := time.ParseDuration(*delay)
+		if err != nil {
+			log.Fatalf("invalid delay: %v", err)
+		}
+		opts.Delay = &d
+	}
+
+	if *markets != "" {
+		opts.Markets = strings.Split(*markets, ",")
+	}
+
+	for _, h := range strings.Split(*horizons, ",") {
+		horizon, err := time.ParseDuration(h)
+		if err != nil {
+			log.Fatalf("invalid horizon: %v", err)
+		}
+		opts.Horizons = append(opts.Horizons, horizon)
+	}
+
+	var err error
+
+	if opts.From, err = time.Parse(time.RFC3339, *from); err != nil {
+		log.Fatalf("invalid from: %v", err)
+	}
+
+	if *to != "" {
+		if opts.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			log.Fatalf("invalid to: %v", err)
+		}
+	}
+
+	hitRates, err := backtest.EvaluateSignals(opts)
+	if err != nil {
+		log.Fatalf("backtest.EvaluateSignals: %v", err)
+	}
+
+	for _, hr := range hitRates {
+		fmt.Printf("%s %s %s: %d signals, hit rate %.1f%%, "+
+			"average return %.3f%%\n", hr.Generator, hr.Kind, hr.Horizon,
+			hr.Signals, hr.Rate*100, hr.AverageReturnPercent)
+	}
+}
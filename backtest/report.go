@@ -0,0 +1,144 @@
+package backtest
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Report summarizes a backtest. Drawdowns and returns are computed from the
+// equity marked at each candle close, the Sharpe ratio being annualized from
+// the returns by period (risk free rate of 0). PnL and drawdowns are in base
+// currency, the open positions valued at the last prices.
+type Report struct {
+	Exchange           string
+	From               time.Time
+	To                 time.Time
+	Balance            float64
+	Equity             float64
+	PnL                float64
+	ReturnPercent      float64
+	MaxDrawdown        float64
+	MaxDrawdownPercent float64
+	Sharpe             float64
+	WinRate            float64
+	Fees               float64
+	Fills              []*Fill
+	Trades             []*ClosedTrade
+	EquityCurve        []*EquityPoint
+}
+
+func (a *Account) report(opts *Options, period time.Duration) *Report {
+
+	r := &Report{
+		Exchange:    opts.Exchange,
+		From:        opts.From,
+		To:          opts.To,
+		Balance:     a.balance,
+		Equity:      a.Equity(),
+		Fills:       a.fills,
+		Trades:      a.closed,
+		EquityCurve: a.equity,
+	}
+
+	r.PnL = r.Equity - r.Balance
+	if r.Balance != 0.0 {
+		r.ReturnPercent = r.PnL / r.Balance * 100
+	}
+
+	for _, f := range a.fills {
+		r.Fees += f.Fee
+	}
+
+	if len(a.closed) != 0 {
+
+		wins := 0
+		for _, ct := range a.closed {
+			if ct.PnL > 0.0 {
+				wins++
+			}
+		}
+		r.WinRate = float64(wins) / float64(len(a.closed))
+	}
+
+	r.computeDrawdown()
+	r.computeSharpe(period)
+
+	return r
+}
+
+func (r *Report) computeDrawdown() {
+
+	peak := r.Balance
+
+	for _, ep := range r.EquityCurve {
+
+		if ep.Equity > peak {
+			peak = ep.Equity
+		}
+
+		if drawdown := peak - ep.Equity; drawdown > r.MaxDrawdown {
+			r.MaxDrawdown = drawdown
+			if peak != 0.0 {
+				r.MaxDrawdownPercent = drawdown / peak * 100
+			}
+		}
+	}
+}
+
+func (r *Report) computeSharpe(period time.Duration) {
+
+	returns := make([]float64, 0, len(r.EquityCurve))
+	previous := r.Balance
+
+	for _, ep := range r.EquityCurve {
+		if previous != 0.0 {
+			returns = append(returns, ep.Equity/previous-1)
+		}
+		previous = ep.Equity
+	}
+
+	if len(returns) < 2 {
+		return
+	}
+
+	mean := 0.0
+	for _, ret := range returns {
+		mean += ret
+	}
+	mean /= float64(len(returns))
+
+	variance := 0.0
+	for _, ret := range returns {
+		variance += (ret - mean) * (ret - mean)
+	}
+	stdDev := math.Sqrt(variance / float64(len(returns)-1))
+
+	if stdDev == 0.0 {
+		return
+	}
+
+	periodsByYear := float64(365*24*time.Hour) / float64(period)
+	r.Sharpe = mean / stdDev * math.Sqrt(periodsByYear)
+}
+
+func (r *Report) String() string {
+
+	s := fmt.Sprintf("%s %s - %s\n", r.Exchange,
+		r.From.UTC().Format(time.RFC3339), r.To.UTC().Format(time.RFC3339))
+	s += fmt.Sprintf("balance: %.8f equity: %.8f pnl: %.8f (%.2f%%)\n",
+		r.Balance, r.Equity, r.PnL, r.ReturnPercent)
+	s += fmt.Sprintf("max drawdown: %.8f (%.2f%%) sharpe: %.2f\n",
+		r.MaxDrawdown, r.MaxDrawdownPercent, r.Sharpe)
+	s += fmt.Sprintf("fills: %d fees: %.8f trades: %d win rate: %.1f%%\n",
+		len(r.Fills), r.Fees, len(r.Trades), r.WinRate*100)
+
+	for _, ct := range r.Trades {
+		s += fmt.Sprintf("%s %s - %s quantity: %.8f entry: %.8f exit: %.8f "+
+			"pnl: %.8f\n", ct.Market,
+			ct.Opened.Format(time.RFC3339), ct.Closed.Format(time.RFC3339),
+			ct.Quantity, ct.EntryPrice, ct.ExitPrice, ct.PnL)
+	}
+
+	return s
+}
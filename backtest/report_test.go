@@ -0,0 +1,37 @@
+package backtest
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestComputeSharpe(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		equity []float64
+		want   float64
+	}{
+		// returns 10%, -10%, 10%
+		{"daily returns", []float64{110, 99, 108.9},
+			(0.1 / 3) / math.Sqrt(0.04/3) * math.Sqrt(365)},
+		{"single return", []float64{110}, 0},
+		{"constant returns", []float64{200, 400, 800}, 0},
+	}
+
+	for _, tt := range tests {
+
+		r := &Report{Balance: 100}
+		for i, equity := range tt.equity {
+			r.EquityCurve = append(r.EquityCurve, &EquityPoint{
+				testStart.Add(time.Duration(i) * 24 * time.Hour), equity})
+		}
+
+		r.computeSharpe(24 * time.Hour)
+
+		if !approxEqual(r.Sharpe, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, r.Sharpe, tt.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package backtest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SignalsOptions selects the signals of an exchange evaluated (generator
+// optional) and the horizons of the evaluation. Prices are the closes of
+// the ohlc_<Period> candles. Signals are evaluated from their time plus
+// Delay, for the signal to be known. Without Delay, it is the period of the
+// source measurement of each signal (e.g. ma_5m, indicators being stamped at
+// the beginning of their interval), none for sources without period.
+type SignalsOptions struct {
+	Exchange  string
+	Markets   []string
+	Generator string
+	Period    string
+	Delay     *time.Duration
+	Horizons  []time.Duration
+	From      time.Time
+	To        time.Time
+}
+
+// HitRate is the share of the signals of a generator followed by a move of
+// the price in their direction after horizon. The average return is signed
+// along the direction of the signals.
+type HitRate struct {
+	Generator            string
+	Kind                 string
+	Horizon              time.Duration
+	Signals              int
+	Hits                 int
+	Rate                 float64
+	AverageReturnPercent float64
+}
+
+type signalRecord struct {
+	generator string
+	kind      string
+	market    string
+	direction string
+	source    string
+	timestamp int64
+}
+
+type timedClose struct {
+	timestamp int64
+	close     float64
+}
+
+// EvaluateSignals returns the hit rates of the signals written between from
+// and to, by generator, kind and horizon. Signals without price at their
+// time or without candle closed over the horizon are skipped.
+func EvaluateSignals(opts *SignalsOptions) ([]*HitRate, error) {
+
+	if !opts.From.Before(opts.To) {
+		return nil, fmt.Errorf("invalid range: %s - %s", opts.From, opts.To)
+	}
+
+	if opts.Delay != nil && *opts.Delay < 0 {
+		return nil, fmt.Errorf("invalid delay: %s", *opts.Delay)
+	}
+
+	period, err := time.ParseDuration(opts.Period)
+	if err != nil {
+		return nil, fmt.Errorf("time.ParseDuration: %v", err)
+	}
+
+	records, err := getSignals(opts)
+	if err != nil {
+		return nil, fmt.Errorf("getSignals: %v", err)
+	}
+
+	var maxHorizon, maxDelay time.Duration
+	for _, horizon := range opts.Horizons {
+		if horizon > maxHorizon {
+			maxHorizon = horizon
+		}
+	}
+	for _, sr := range records {
+		if delay := opts.signalDelay(sr.source); delay > maxDelay {
+			maxDelay = delay
+		}
+	}
+
+	candles, err := getCandles(&Options{
+		Exchange: opts.Exchange,
+		Markets:  opts.Markets,
+		Period:   opts.Period,
+	}, period, opts.From.Add(-period).UnixNano(),
+		opts.To.Add(maxDelay+maxHorizon+period).UnixNano())
+	if err != nil {
+		return nil, fmt.Errorf("getCandles: %v", err)
+	}
+
+	// closes by market, oldest first
+	closes := make(map[string][]*timedClose)
+	for _, c := range candles {
+		closes[c.Market] = append(closes[c.Market],
+			&timedClose{c.Start.Add(period).UnixNano(), c.Close})
+	}
+	for _, tcs := range closes {
+		sort.Slice(tcs, func(i, j int) bool {
+			return tcs[i].timestamp < tcs[j].timestamp
+		})
+	}
+
+	hitRates := make(map[string]*HitRate)
+	keys := make([]string, 0)
+
+	for _, sr := range records {
+
+		known := sr.timestamp + int64(opts.signalDelay(sr.source))
+
+		price := closeAt(closes[sr.market], known)
+		if price == nil || price.close == 0.0 {
+			continue
+		}
+
+		for _, horizon := range opts.Horizons {
+
+			// no candle closed over the horizon
+			later := closeAt(closes[sr.market], known+int64(horizon))
+			if later == price {
+				continue
+			}
+
+			ret := (later.close - price.close) / price.close * 100
+			if sr.direction == "short" {
+				ret = -ret
+			}
+
+			key := fmt.Sprintf("%s/%s/%d", sr.generator, sr.kind, horizon)
+			hr, ok := hitRates[key]
+			if !ok {
+				hr = &HitRate{
+					Generator: sr.generator,
+					Kind:      sr.kind,
+					Horizon:   horizon,
+				}
+				hitRates[key] = hr
+				keys = append(keys, key)
+			}
+
+			hr.Signals++
+			hr.AverageReturnPercent += ret
+			if ret > 0.0 {
+				hr.Hits++
+			}
+		}
+	}
+
+	res := make([]*HitRate, 0, len(keys))
+	for _, key := range keys {
+
+		hr := hitRates[key]
+		hr.Rate = float64(hr.Hits) / float64(hr.Signals)
+		hr.AverageReturnPercent /= float64(hr.Signals)
+		res = append(res, hr)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Generator != res[j].Generator {
+			return res[i].Generator < res[j].Generator
+		}
+		if res[i].Kind != res[j].Kind {
+			return res[i].Kind < res[j].Kind
+		}
+		return res[i].Horizon < res[j].Horizon
+	})
+
+	return res, nil
+}
+
+// signalDelay returns the delay of the signals of source: Delay if set,
+// else the period suffixing source (0 if none).
+func (opts *SignalsOptions) signalDelay(source string) time.Duration {
+
+	if opts.Delay != nil {
+		return *opts.Delay
+	}
+
+	i := strings.LastIndex(source, "_")
+	if i == -1 {
+		return 0
+	}
+
+	period, err := time.ParseDuration(source[i+1:])
+	if err != nil {
+		return 0
+	}
+
+	return period
+}
+
+// closeAt returns the last candle close at timestamp or before (nil if
+// none).
+func closeAt(tcs []*timedClose, timestamp int64) *timedClose {
+
+	i := sort.Search(len(tcs), func(i int) bool {
+		return tcs[i].timestamp > timestamp
+	}) - 1
+
+	if i < 0 {
+		return nil
+	}
+
+	return tcs[i]
+}
+
+func getSignals(opts *SignalsOptions) ([]*signalRecord, error) {
+
+	where := fmt.Sprintf("WHERE exchange = '%s' AND time >= %d AND time < %d",
+		opts.Exchange, opts.From.UnixNano(), opts.To.UnixNano())
+
+	if opts.Generator != "" {
+		where += fmt.Sprintf(" AND generator = '%s'", opts.Generator)
+	}
+
+	where += (&Options{Markets: opts.Markets}).marketsCondition()
+
+	query := fmt.Sprintf(
+		`SELECT strength, source FROM %s %s
+    GROUP BY generator, kind, market, direction`,
+		conf.Backtest.Schema["signals_measurement"], where)
+
+	res, err := database.QueryDB(dbClient, query,
+		conf.Backtest.Schema["database"])
+	if err != nil {
+		return nil, fmt.Errorf("database.QueryDB: %v", err)
+	}
+
+	records := make([]*signalRecord, 0)
+
+	for _, serie := range res[0].Series {
+		for _, rec := range serie.Values {
+
+			timestamp, err := networking.ConvertJsonValueToTime(rec[0])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":     err,
+					"generator": serie.Tags["generator"],
+				}).Error("getSignals: networking.ConvertJsonValueToTime")
+				continue
+			}
+
+			// signals of an unknown source are known at their time
+			source, _ := rec[2].(string)
+
+			records = append(records, &signalRecord{
+				generator: serie.Tags["generator"],
+				kind:      serie.Tags["kind"],
+				market:    serie.Tags["market"],
+				direction: serie.Tags["direction"],
+				source:    source,
+				timestamp: timestamp.UnixNano(),
+			})
+		}
+	}
+
+	return records, nil
+}
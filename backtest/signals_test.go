@@ -0,0 +1,54 @@
+package backtest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCloseAt(t *testing.T) {
+
+	tcs := []*timedClose{{10, 1}, {20, 2}, {30, 3}}
+
+	tests := []struct {
+		timestamp int64
+		want      *timedClose
+	}{
+		{5, nil},
+		{10, tcs[0]},
+		{25, tcs[1]},
+		{30, tcs[2]},
+		{40, tcs[2]},
+	}
+
+	for _, tt := range tests {
+		if got := closeAt(tcs, tt.timestamp); got != tt.want {
+			t.Errorf("%d: got %+v, want %+v", tt.timestamp, got, tt.want)
+		}
+	}
+}
+
+func TestSignalDelay(t *testing.T) {
+
+	explicit := time.Duration(0)
+
+	tests := []struct {
+		name   string
+		delay  *time.Duration
+		source string
+		want   time.Duration
+	}{
+		{"indicator period", nil, "ma_5m", 5 * time.Minute},
+		{"series indicator period", nil, "rsi_heikin_ashi_1h", time.Hour},
+		{"source without period", nil, "market_depths", 0},
+		{"unknown source", nil, "", 0},
+		{"explicit delay", &explicit, "ma_5m", 0},
+	}
+
+	for _, tt := range tests {
+
+		opts := &SignalsOptions{Delay: tt.delay}
+		if got := opts.signalDelay(tt.source); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
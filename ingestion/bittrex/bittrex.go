@@ -38,6 +38,7 @@ type bittrexConf struct {
 	MarketsCheckPeriodMin         int               `json:"markets_check_period_min"`
 	MarketHistoriesCheckPeriodSec int               `json:"market_histories_check_period_sec"`
 	OrderBooksCheckPeriodSec      int               `json:"order_books_check_period_sec"`
+	LateTradesThresholdSec        int               `json:"late_trades_threshold_sec"`
 	FlushBatchsPeriodSec          int               `json:"flush_batchs_period_sec"`
 	FlushCapacity                 int               `json:"flush_capacity"`
 }
@@ -50,6 +51,7 @@ type allMarkets struct {
 type lastTrades struct {
 	sync.Mutex
 	lastTrades map[string]*publicapi.Trade
+	lastPolls  map[string]time.Time
 }
 
 func init() {
@@ -96,7 +98,11 @@ func init() {
 	publicClient = publicapi.NewClient()
 
 	ams = &allMarkets{sync.Mutex{}, make(map[string]*publicapi.Market)}
-	lts = &lastTrades{sync.Mutex{}, make(map[string]*publicapi.Trade)}
+	lts = &lastTrades{
+		sync.Mutex{},
+		make(map[string]*publicapi.Trade),
+		make(map[string]time.Time),
+	}
 
 	batchsToWrite = make(chan *database.BatchPoints, conf.FlushCapacity)
 }
@@ -3,7 +3,9 @@ package bittrex
 import (
 	"time"
 	"trading/networking"
+	"trading/networking/bus"
 	"trading/networking/database"
+	"trading/networking/symbols"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	publicapi "github.com/joemocquant/bittrex-api/publicapi"
@@ -45,11 +47,11 @@ func ingestMarketHistory(marketName string) {
 		return
 	}
 
-	prepareMarketHistoryPoints(marketName, marketHistory)
+	prepareMarketHistoryPoints(marketName, marketHistory, time.Now())
 }
 
 func prepareMarketHistoryPoints(marketName string,
-	mh publicapi.MarketHistory) {
+	mh publicapi.MarketHistory, polled time.Time) {
 
 	measurement := conf.Schema["trades_measurement"]
 	points := make([]*ifxClient.Point, 0, len(mh))
@@ -58,6 +60,7 @@ func prepareMarketHistoryPoints(marketName string,
 		"source": "publicapi",
 		"market": marketName,
 	}
+	symbols.AddTags("bittrex", marketName, measurement, tags)
 
 	lastTrade := getLastTrade(marketName)
 
@@ -91,10 +94,42 @@ func prepareMarketHistoryPoints(marketName string,
 		logger.Warnf("Possibly missing trades for market %s", marketName)
 	}
 
+	// marking the buckets of trades ingested late for recomputation
+	previous := setLastPoll(marketName, polled)
+	if len(points) != 0 && isLate(points[len(points)-1].Time(), previous) {
+
+		pt, err := database.NewLateTradesPoint(
+			conf.Schema["late_trades_measurement"], "bittrex", marketName,
+			points[len(points)-1].Time(), len(points))
+
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareMarketHistoryPoints: database.NewLateTradesPoint")
+		} else {
+			points = append(points, pt)
+		}
+	}
+
 	if len(mh) == 0 || !setLastTrade(marketName, mh[0]) {
 		return
 	}
 
+	for index, trade := range mh {
+
+		if lastTrade != nil && trade.Id <= lastTrade.Id {
+			break
+		}
+
+		bus.PublishTrade(&bus.Trade{
+			Exchange: "bittrex",
+			Market:   marketName,
+			Time:     time.Unix(trade.TimeStamp, int64(index)),
+			Rate:     trade.Price,
+			Quantity: trade.Quantity,
+			Total:    trade.Total,
+		})
+	}
+
 	batchsToWrite <- &database.BatchPoints{
 		TypePoint: "marketHistory",
 		Points:    points,
@@ -122,3 +157,28 @@ func setLastTrade(marketName string, newTrade *publicapi.Trade) bool {
 
 	return false
 }
+
+// setLastPoll returns the previous poll time of market (polled on the first
+// one, all the trades of the history being new).
+func setLastPoll(marketName string, polled time.Time) time.Time {
+
+	lts.Lock()
+	defer lts.Unlock()
+
+	previous, ok := lts.lastPolls[marketName]
+	if !ok {
+		previous = polled
+	}
+	lts.lastPolls[marketName] = polled
+
+	return previous
+}
+
+// isLate tells if a trade was already due at the previous poll, the threshold
+// absorbing the lag of the exchange timestamps.
+func isLate(timestamp, previous time.Time) bool {
+
+	threshold := time.Duration(conf.LateTradesThresholdSec) * time.Second
+
+	return timestamp.Before(previous.Add(-threshold))
+}
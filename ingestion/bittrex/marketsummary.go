@@ -4,6 +4,7 @@ import (
 	"time"
 	"trading/networking"
 	"trading/networking/database"
+	"trading/networking/symbols"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	publicapi "github.com/joemocquant/bittrex-api/publicapi"
@@ -67,6 +68,7 @@ func prepareMarketSummaryPoint(
 		"source": "publicapi",
 		"market": ms.MarketName,
 	}
+	symbols.AddTags("bittrex", ms.MarketName, measurement, tags)
 
 	fields := map[string]interface{}{
 		"high":             ms.High,
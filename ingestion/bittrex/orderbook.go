@@ -4,6 +4,7 @@ import (
 	"time"
 	"trading/networking"
 	"trading/networking/database"
+	"trading/networking/symbols"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	publicapi "github.com/joemocquant/bittrex-api/publicapi"
@@ -64,6 +65,7 @@ func prepareOrderBookPoints(market string, orderBook *publicapi.OrderBook,
 			"order_type": typeOrder,
 			"market":     market,
 		}
+		symbols.AddTags("bittrex", market, measurement, tags)
 
 		cumulativeSum := 0.0
 		for _, order := range orders {
@@ -108,6 +110,7 @@ func prepareLastOrderBookCheckPoint(market string,
 		"source": "publicapi",
 		"market": market,
 	}
+	symbols.AddTags("bittrex", market, measurement, tags)
 
 	fields := map[string]interface{}{
 		"bid_depth": len(orderBook.Buy),
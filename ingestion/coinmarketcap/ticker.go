@@ -3,6 +3,7 @@ package coinmarketcap
 import (
 	"time"
 	"trading/networking"
+	"trading/networking/symbols"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	coinmarketcap "github.com/joemocquant/cmc-api"
@@ -64,6 +65,10 @@ func prepareTickPoint(tick *coinmarketcap.Tick) (*ifxClient.Point, error) {
 		"symbol": tick.Symbol,
 	}
 
+	if symbols.Tagged("coinmarketcap", measurement) {
+		tags["currency"] = symbols.Currency("coinmarketcap", tick.Symbol)
+	}
+
 	fields := map[string]interface{}{
 		"id":                 tick.Id,
 		"name":               tick.Name,
@@ -4,7 +4,9 @@ import (
 	"time"
 
 	"trading/networking"
+	"trading/networking/bus"
 	"trading/networking/database"
+	"trading/networking/symbols"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	publicapi "github.com/joemocquant/poloniex-api/publicapi"
@@ -130,6 +132,13 @@ func getMarketNewPoints(marketUpdater pushapi.MarketUpdater, market string) {
 				}
 
 				points = append(points, pt)
+
+				if marketUpdate.TypeUpdate == "newTrade" {
+					nt := marketUpdate.Data.(*pushapi.NewTrade)
+					ns := nt.TradeId % int64(time.Second/time.Nanosecond)
+					publishTrade(market, time.Unix(nt.Date, ns),
+						nt.Rate, nt.Amount, nt.Total)
+				}
 			}
 			batchsToWrite <- &database.BatchPoints{
 				TypePoint: "market",
@@ -208,9 +217,26 @@ func prepareMarketPoint(marketUpdate *pushapi.MarketUpdate,
 		timestamp = time.Unix(nt.Date, ns)
 	}
 
+	symbols.AddTags("poloniex", market, measurement, tags)
+
 	pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
 	if err != nil {
 		return nil, err
 	}
 	return pt, nil
 }
+
+// publishTrade makes trade available to in-process consumers (streaming
+// metrics).
+func publishTrade(market string, timestamp time.Time,
+	rate, quantity, total float64) {
+
+	bus.PublishTrade(&bus.Trade{
+		Exchange: "poloniex",
+		Market:   market,
+		Time:     timestamp,
+		Rate:     rate,
+		Quantity: quantity,
+		Total:    total,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 	"trading/networking"
 	"trading/networking/database"
+	"trading/networking/symbols"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	publicapi "github.com/joemocquant/poloniex-api/publicapi"
@@ -148,6 +149,7 @@ func prepareMissingTradePoints(market string, mt []*publicapi.Trade) {
 			"order_type": trade.TypeOrder,
 			"market":     market,
 		}
+		symbols.AddTags("poloniex", market, measurement, tags)
 
 		fields := map[string]interface{}{
 			"trade_id": trade.TradeId,
@@ -165,6 +167,31 @@ func prepareMissingTradePoints(market string, mt []*publicapi.Trade) {
 			continue
 		}
 		points = append(points, pt)
+
+		publishTrade(market, timestamp, trade.Rate, trade.Amount, trade.Total)
+	}
+
+	// marking the buckets of the recovered trades for recomputation
+	if len(mt) != 0 {
+
+		oldest := time.Unix(mt[0].Date, mt[0].TradeId%1000000000)
+		for _, trade := range mt[1:] {
+			if timestamp := time.Unix(trade.Date,
+				trade.TradeId%1000000000); timestamp.Before(oldest) {
+				oldest = timestamp
+			}
+		}
+
+		pt, err := database.NewLateTradesPoint(
+			conf.Schema["late_trades_measurement"], "poloniex", market,
+			oldest, len(mt))
+
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareMissingTradePoints: database.NewLateTradesPoint")
+		} else {
+			points = append(points, pt)
+		}
 	}
 
 	batchsToWrite <- &database.BatchPoints{
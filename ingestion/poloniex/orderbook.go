@@ -4,6 +4,7 @@ import (
 	"time"
 	"trading/networking"
 	"trading/networking/database"
+	"trading/networking/symbols"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	publicapi "github.com/joemocquant/poloniex-api/publicapi"
@@ -64,6 +65,7 @@ func prepareOrderBookPoints(market string,
 			"order_type": typeOrder,
 			"market":     market,
 		}
+		symbols.AddTags("poloniex", market, measurement, tags)
 
 		cumulativeSum := 0.0
 		for _, order := range orders {
@@ -113,6 +115,7 @@ func prepareLastOrderBookCheckPoints(orderBooks publicapi.OrderBooks,
 			"source": "publicapi",
 			"market": market,
 		}
+		symbols.AddTags("poloniex", market, measurement, tags)
 
 		fields := map[string]interface{}{
 			"sequence":  ob.Seq,
@@ -4,6 +4,7 @@ import (
 	"time"
 	"trading/networking"
 	"trading/networking/database"
+	"trading/networking/symbols"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	publicapi "github.com/joemocquant/poloniex-api/publicapi"
@@ -71,6 +72,7 @@ func preparePublicTickPoint(market string,
 		"source": "publicapi",
 		"market": market,
 	}
+	symbols.AddTags("poloniex", market, measurement, tags)
 
 	fields := map[string]interface{}{
 		"last":           tick.Last,
@@ -143,6 +145,7 @@ func preparePushTickPoint(tick *pushapi.Tick) (*ifxClient.Point, error) {
 		"source": "pushapi",
 		"market": tick.CurrencyPair,
 	}
+	symbols.AddTags("poloniex", tick.CurrencyPair, measurement, tags)
 
 	fields := map[string]interface{}{
 		"last":           tick.Last,
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+)
+
+func getADX(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "adx")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeADX(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeADX: no result")
+	}
+
+	updateCacheLastFields(ind, imfields)
+	prepareFieldsPoints(ind, "ADX", imfields)
+
+	return ind, nil
+}
+
+// computeADX computes the directional indicators and the average directional
+// index with Wilder's smoothing. The smoothed true range and directional
+// movements are persisted (tr, plus_dm, minus_dm) along with the adx to carry
+// the smoothing over the next runs. Without previous values the smoothing is
+// seeded with the sums over the last length periods.
+func computeADX(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	lengths := conf.Metrics.Trend.ADX.Lengths
+	fieldNames := make([]string, 0, 4*len(lengths))
+
+	for _, length := range lengths {
+		fieldNames = append(fieldNames,
+			fmt.Sprintf("tr_%d", length),
+			fmt.Sprintf("plus_dm_%d", length),
+			fmt.Sprintf("minus_dm_%d", length),
+			fmt.Sprintf("adx_%d", length))
+	}
+
+	lastMfields := getLastMfields(ind, fieldNames)
+	if lastMfields == nil {
+		return nil
+	}
+
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, _ := range imohlc[interval] {
+
+			lastFields := lastMfields[market]
+			fields := make(indicatorFields, 6*len(lengths))
+
+			for _, length := range lengths {
+
+				trKey := fmt.Sprintf("tr_%d", length)
+				plusDMKey := fmt.Sprintf("plus_dm_%d", length)
+				minusDMKey := fmt.Sprintf("minus_dm_%d", length)
+				adxKey := fmt.Sprintf("adx_%d", length)
+
+				var trS, plusDMS, minusDMS, adx float64
+				n := float64(length)
+
+				trLast, ok1 := lastFields[trKey]
+				plusDMLast, ok2 := lastFields[plusDMKey]
+				minusDMLast, ok3 := lastFields[minusDMKey]
+				adxLast, ok4 := lastFields[adxKey]
+
+				if ok1 && ok2 && ok3 && ok4 {
+
+					window := getOHLCWindow(imohlc, ind.period, interval, market, 2)
+					if window == nil {
+						continue
+					}
+
+					tr, plusDM, minusDM := directionalMovement(window[0], window[1])
+					trS = trLast - trLast/n + tr
+					plusDMS = plusDMLast - plusDMLast/n + plusDM
+					minusDMS = minusDMLast - minusDMLast/n + minusDM
+
+					_, _, dx := directionalIndex(trS, plusDMS, minusDMS)
+					adx = (adxLast*(n-1) + dx) / n
+
+				} else {
+
+					window := getOHLCWindow(imohlc, ind.period, interval, market,
+						length+1)
+					if window == nil {
+						continue
+					}
+
+					for i := 1; i < len(window); i++ {
+						tr, plusDM, minusDM := directionalMovement(window[i-1], window[i])
+						trS += tr
+						plusDMS += plusDM
+						minusDMS += minusDM
+					}
+
+					_, _, adx = directionalIndex(trS, plusDMS, minusDMS)
+				}
+
+				plusDI, minusDI, _ := directionalIndex(trS, plusDMS, minusDMS)
+
+				fields[trKey] = trS
+				fields[plusDMKey] = plusDMS
+				fields[minusDMKey] = minusDMS
+				fields[adxKey] = adx
+				fields[fmt.Sprintf("plus_di_%d", length)] = plusDI
+				fields[fmt.Sprintf("minus_di_%d", length)] = minusDI
+			}
+
+			imfields[interval][market] = fields
+			lastMfields[market] = fields
+		}
+	}
+
+	return imfields
+}
+
+func directionalMovement(prev, cur *ohlc) (float64, float64, float64) {
+
+	tr := math.Max(cur.high-cur.low,
+		math.Max(math.Abs(cur.high-prev.close), math.Abs(cur.low-prev.close)))
+
+	upMove := cur.high - prev.high
+	downMove := prev.low - cur.low
+
+	plusDM, minusDM := 0.0, 0.0
+
+	if upMove > downMove && upMove > 0.0 {
+		plusDM = upMove
+	}
+
+	if downMove > upMove && downMove > 0.0 {
+		minusDM = downMove
+	}
+
+	return tr, plusDM, minusDM
+}
+
+func directionalIndex(trS, plusDMS, minusDMS float64) (float64, float64, float64) {
+
+	if trS == 0.0 {
+		return 0.0, 0.0, 0.0
+	}
+
+	plusDI := 100.0 * plusDMS / trS
+	minusDI := 100.0 * minusDMS / trS
+
+	dx := 0.0
+	if plusDI+minusDI != 0.0 {
+		dx = 100.0 * math.Abs(plusDI-minusDI) / (plusDI + minusDI)
+	}
+
+	return plusDI, minusDI, dx
+}
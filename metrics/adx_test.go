@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDirectionalMovement(t *testing.T) {
+
+	tests := []struct {
+		name                string
+		prev, cur           *ohlc
+		tr, plusDM, minusDM float64
+	}{
+		{"up move", testOscillatorCandles[1], testOscillatorCandles[2], 2, 1, 0},
+		{"outside bar", testOscillatorCandles[2], testOscillatorCandles[3], 4, 0, 0},
+		{
+			name:    "gap down",
+			prev:    newTestOHLC(10, 11, 9, 10, 1),
+			cur:     newTestOHLC(7, 8, 6, 7, 1),
+			tr:      4,
+			minusDM: 3,
+		},
+	}
+
+	for _, tt := range tests {
+
+		tr, plusDM, minusDM := directionalMovement(tt.prev, tt.cur)
+		if tr != tt.tr || plusDM != tt.plusDM || minusDM != tt.minusDM {
+			t.Errorf("%s: got %v, %v, %v, want %v, %v, %v", tt.name,
+				tr, plusDM, minusDM, tt.tr, tt.plusDM, tt.minusDM)
+		}
+	}
+}
+
+func TestComputeADX(t *testing.T) {
+
+	defer func(tc *trendConf) { conf.Metrics.Trend = tc }(conf.Metrics.Trend)
+	conf.Metrics.Trend = &trendConf{ADX: &lengthsConf{[]int{2}}}
+
+	tests := []struct {
+		name string
+		last indicatorFields
+		want indicatorFields
+	}{
+		{
+			// true ranges 2 and 4, +DM 1 and 0
+			name: "seeded with sums",
+			want: indicatorFields{
+				"tr_2": 6, "plus_dm_2": 1, "minus_dm_2": 0, "adx_2": 100,
+				"plus_di_2": 100.0 / 6, "minus_di_2": 0,
+			},
+		},
+		{
+			name: "wilder smoothing",
+			last: indicatorFields{
+				"tr_2": 6, "plus_dm_2": 1, "minus_dm_2": 0, "adx_2": 50,
+			},
+			want: indicatorFields{
+				"tr_2": 7, "plus_dm_2": 0.5, "minus_dm_2": 0, "adx_2": 75,
+				"plus_di_2": 50.0 / 7, "minus_di_2": 0,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+
+		ind := newTestIndicator(time.Minute, 1)
+		ind.destination = "adx_1m"
+		setTestOHLC(ind.period, 3, "BTC_ETH", testOscillatorCandles)
+
+		mfields := map[string]indicatorFields{}
+		if tt.last != nil {
+			mfields["BTC_ETH"] = tt.last
+		}
+		setTestFields(ind, mfields)
+
+		got := computeADX(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
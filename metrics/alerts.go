@@ -0,0 +1,496 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// alertsConf evaluates the rules on the points written by the live metrics
+// (not by the backfills). Fired alerts are queued (capacity) and delivered
+// to the sinks of their rule: log, webhook, file or a registered sink.
+type alertsConf struct {
+	Capacity int              `json:"capacity"`
+	Webhook  *webhookSinkConf `json:"webhook"`
+	File     *fileSinkConf    `json:"file"`
+	Rules    []*alertRule     `json:"rules"`
+}
+
+type webhookSinkConf struct {
+	URL     string `json:"url"`
+	Timeout string `json:"timeout"`
+}
+
+// fileSinkConf appends the alerts as json lines to path.
+type fileSinkConf struct {
+	Path string `json:"path"`
+}
+
+// alertRule compares field of the points of measurement (matching tags) to
+// threshold. Operators are <, <=, >, >= and rises_percent, drops_percent
+// (change from the value window earlier). The condition must hold for
+// debounce successive points of a series (1 by default) and a series fires
+// at most once per cooldown.
+type alertRule struct {
+	Name        string            `json:"name"`
+	Measurement string            `json:"measurement"`
+	Field       string            `json:"field"`
+	Tags        map[string]string `json:"tags"`
+	Operator    string            `json:"operator"`
+	Threshold   float64           `json:"threshold"`
+	Window      string            `json:"window"`
+	Debounce    int               `json:"debounce"`
+	Cooldown    string            `json:"cooldown"`
+	Sinks       []string          `json:"sinks"`
+	window      time.Duration
+	cooldown    time.Duration
+}
+
+// Alert is fired by a rule on a point. Reference is the value window
+// earlier for the change operators.
+type Alert struct {
+	Rule        string            `json:"rule"`
+	Measurement string            `json:"measurement"`
+	Field       string            `json:"field"`
+	Tags        map[string]string `json:"tags"`
+	Operator    string            `json:"operator"`
+	Threshold   float64           `json:"threshold"`
+	Value       float64           `json:"value"`
+	Reference   float64           `json:"reference,omitempty"`
+	Time        time.Time         `json:"time"`
+	sinks       []string
+}
+
+// AlertSink delivers the alerts of the rules listing its name.
+type AlertSink interface {
+	Deliver(a *Alert) error
+}
+
+type timedValue struct {
+	timestamp int64
+	value     float64
+}
+
+// alertSeries is the state of a rule for a tag set.
+type alertSeries struct {
+	history       []*timedValue
+	lastTimestamp int64
+	successive    int
+	lastFired     int64
+}
+
+type alertsState struct {
+	sync.Mutex
+	rules  map[string][]*alertRule
+	series map[string]*alertSeries
+	sinks  map[string]AlertSink
+}
+
+var (
+	alerts = &alertsState{
+		rules:  make(map[string][]*alertRule),
+		series: make(map[string]*alertSeries),
+		sinks:  make(map[string]AlertSink),
+	}
+	alertsToDeliver chan *Alert
+)
+
+// RegisterAlertSink makes sink available to the rules under name. Sinks
+// are to be registered before ComputeMetrics.
+func RegisterAlertSink(name string, sink AlertSink) {
+
+	alerts.Lock()
+	defer alerts.Unlock()
+
+	alerts.sinks[name] = sink
+}
+
+func initAlerts() {
+
+	ac := conf.Metrics.Alerts
+	if ac == nil {
+		return
+	}
+
+	var err error
+
+	for _, rule := range ac.Rules {
+
+		switch rule.Operator {
+		case "<", "<=", ">", ">=":
+		case "rises_percent", "drops_percent":
+			if rule.window, err = time.ParseDuration(rule.Window); err != nil {
+				logger.WithFields(logrus.Fields{
+					"error": err,
+					"rule":  rule.Name,
+				}).Fatal("initAlerts: time.ParseDuration")
+			}
+		default:
+			logger.WithField("rule", rule.Name).Fatal(
+				"initAlerts: unknown operator")
+		}
+
+		if rule.Cooldown != "" {
+			if rule.cooldown, err = time.ParseDuration(
+				rule.Cooldown); err != nil {
+				logger.WithFields(logrus.Fields{
+					"error": err,
+					"rule":  rule.Name,
+				}).Fatal("initAlerts: time.ParseDuration")
+			}
+		}
+
+		if rule.Debounce < 1 {
+			rule.Debounce = 1
+		}
+
+		alerts.rules[rule.Measurement] = append(alerts.rules[rule.Measurement],
+			rule)
+	}
+
+	alerts.sinks["log"] = &logSink{}
+
+	if ac.Webhook != nil {
+
+		timeout, err := time.ParseDuration(ac.Webhook.Timeout)
+		if err != nil {
+			logger.WithField("error", err).Fatal(
+				"initAlerts: time.ParseDuration")
+		}
+
+		alerts.sinks["webhook"] = &webhookSink{
+			url:    ac.Webhook.URL,
+			client: &http.Client{Timeout: timeout},
+		}
+	}
+
+	if ac.File != nil {
+		alerts.sinks["file"] = &fileSink{path: ac.File.Path}
+	}
+
+	alertsToDeliver = make(chan *Alert, ac.Capacity)
+}
+
+// deliverAlerts sends the queued alerts to their sinks.
+func deliverAlerts() {
+
+	if conf.Metrics.Alerts == nil {
+		return
+	}
+
+	alerts.Lock()
+	for _, rule := range conf.Metrics.Alerts.Rules {
+		for _, name := range rule.Sinks {
+			if _, ok := alerts.sinks[name]; !ok {
+				logger.WithFields(logrus.Fields{
+					"rule": rule.Name,
+					"sink": name,
+				}).Fatal("deliverAlerts: unknown sink")
+			}
+		}
+	}
+	alerts.Unlock()
+
+	for a := range alertsToDeliver {
+		for _, name := range a.sinks {
+
+			alerts.Lock()
+			sink := alerts.sinks[name]
+			alerts.Unlock()
+
+			if err := sink.Deliver(a); err != nil {
+				logger.WithFields(logrus.Fields{
+					"error": err,
+					"rule":  a.Rule,
+					"sink":  name,
+				}).Error("deliverAlerts: sink.Deliver")
+			}
+		}
+	}
+}
+
+// evaluateAlerts evaluates the rules of the measurement of each point,
+// queueing the alerts fired.
+func evaluateAlerts(points []*ifxClient.Point) {
+
+	if conf.Metrics.Alerts == nil {
+		return
+	}
+
+	fired := make([]*Alert, 0)
+
+	alerts.Lock()
+
+	for _, pt := range points {
+
+		if pt == nil {
+			continue
+		}
+
+		rules, ok := alerts.rules[pt.Name()]
+		if !ok {
+			continue
+		}
+
+		fields, err := pt.Fields()
+		if err != nil {
+			logger.WithField("error", err).Error("evaluateAlerts: pt.Fields")
+			continue
+		}
+
+		for _, rule := range rules {
+			if a := rule.evaluate(pt, fields); a != nil {
+				fired = append(fired, a)
+			}
+		}
+	}
+
+	alerts.Unlock()
+
+	for _, a := range fired {
+		select {
+		case alertsToDeliver <- a:
+		default:
+			logger.WithField("rule", a.Rule).Warn(
+				"evaluateAlerts: alerts queue full, alert dropped")
+		}
+	}
+}
+
+// evaluate returns the alert fired by the point (nil if none), recording
+// its value in the series of its tags.
+func (rule *alertRule) evaluate(pt *ifxClient.Point,
+	fields map[string]interface{}) *Alert {
+
+	tags := pt.Tags()
+	for k, v := range rule.Tags {
+		if tags[k] != v {
+			return nil
+		}
+	}
+
+	value, ok := toFloat64(fields[rule.Field])
+	if !ok {
+		return nil
+	}
+
+	key := rule.seriesKey(tags)
+	s, ok := alerts.series[key]
+	if !ok {
+		s = &alertSeries{}
+		alerts.series[key] = s
+	}
+
+	timestamp := pt.UnixNano()
+	reference, hold := rule.check(s, timestamp, value)
+
+	// points rewritten at the same timestamp (open candles) count once
+	switch {
+	case !hold:
+		s.successive = 0
+	case timestamp != s.lastTimestamp || s.successive == 0:
+		s.successive++
+	}
+
+	if timestamp > s.lastTimestamp {
+		s.lastTimestamp = timestamp
+	}
+
+	if s.successive < rule.Debounce || s.lastFired != 0 &&
+		(timestamp <= s.lastFired ||
+			timestamp-s.lastFired < int64(rule.cooldown)) {
+		return nil
+	}
+	s.lastFired = timestamp
+
+	return &Alert{
+		Rule:        rule.Name,
+		Measurement: rule.Measurement,
+		Field:       rule.Field,
+		Tags:        tags,
+		Operator:    rule.Operator,
+		Threshold:   rule.Threshold,
+		Value:       value,
+		Reference:   reference,
+		Time:        pt.Time(),
+		sinks:       rule.Sinks,
+	}
+}
+
+// check returns whether value holds the condition of the rule (and the
+// reference value of the change operators).
+func (rule *alertRule) check(s *alertSeries, timestamp int64,
+	value float64) (float64, bool) {
+
+	switch rule.Operator {
+	case "<":
+		return 0.0, value < rule.Threshold
+	case "<=":
+		return 0.0, value <= rule.Threshold
+	case ">":
+		return 0.0, value > rule.Threshold
+	case ">=":
+		return 0.0, value >= rule.Threshold
+	}
+
+	s.record(timestamp, value, rule.window)
+
+	// last value at least window old
+	var reference *timedValue
+	for _, tv := range s.history {
+		if tv.timestamp > timestamp-int64(rule.window) {
+			break
+		}
+		reference = tv
+	}
+
+	if reference == nil || reference.value == 0.0 {
+		return 0.0, false
+	}
+
+	change := (value - reference.value) / reference.value * 100
+
+	if rule.Operator == "rises_percent" {
+		return reference.value, change >= rule.Threshold
+	}
+
+	return reference.value, -change >= rule.Threshold
+}
+
+// record adds the value of timestamp to the history (replacing a value of
+// the same timestamp), keeping a single value older than window.
+func (s *alertSeries) record(timestamp int64, value float64,
+	window time.Duration) {
+
+	n := len(s.history)
+
+	switch {
+	case n != 0 && s.history[n-1].timestamp == timestamp:
+		s.history[n-1].value = value
+	case n == 0 || s.history[n-1].timestamp < timestamp:
+		s.history = append(s.history, &timedValue{timestamp, value})
+	default:
+		// late rewrite of an older point
+		return
+	}
+
+	oldest := 0
+	for i, tv := range s.history {
+		if tv.timestamp <= timestamp-int64(window) {
+			oldest = i
+		}
+	}
+	s.history = s.history[oldest:]
+}
+
+func (rule *alertRule) seriesKey(tags map[string]string) string {
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	key := rule.Name
+	for _, k := range keys {
+		key += "," + k + "=" + tags[k]
+	}
+
+	return key
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+
+	return 0.0, false
+}
+
+type logSink struct{}
+
+func (ls *logSink) Deliver(a *Alert) error {
+
+	tags := make([]string, 0, len(a.Tags))
+	for k, v := range a.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	logger.WithFields(logrus.Fields{
+		"rule":      a.Rule,
+		"tags":      strings.Join(tags, ","),
+		"value":     a.Value,
+		"threshold": a.Threshold,
+		"time":      a.Time.UTC(),
+	}).Warn("alert")
+
+	return nil
+}
+
+// webhookSink posts each alert as json.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (ws *webhookSink) Deliver(a *Alert) error {
+
+	body, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	resp, err := ws.client.Post(ws.url, "application/json",
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("client.Post: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// fileSink appends the alerts to a local queue file, one json per line.
+type fileSink struct {
+	path string
+}
+
+func (fs *fileSink) Deliver(a *Alert) error {
+
+	line, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	f, err := os.OpenFile(fs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("os.OpenFile: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("f.Write: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+)
+
+func TestAlertRuleCheck(t *testing.T) {
+
+	minute := int64(time.Minute)
+
+	tests := []struct {
+		name      string
+		operator  string
+		threshold float64
+		values    []timedValue // the last one is checked
+		reference float64
+		hold      bool
+	}{
+		{"lower", "<", 5, []timedValue{{0, 4}}, 0, true},
+		{"lower or equal", "<=", 5, []timedValue{{0, 5}}, 0, true},
+		{"greater", ">", 5, []timedValue{{0, 5}}, 0, false},
+		{"greater or equal", ">=", 5, []timedValue{{0, 5}}, 0, true},
+		{"rise over the window", "rises_percent", 10, []timedValue{
+			{0, 100}, {3 * minute, 105}, {5 * minute, 110}}, 100, true},
+		{"rise within the window", "rises_percent", 10, []timedValue{
+			{0, 100}, {4 * minute, 110}}, 0, false},
+		{"last value older than the window", "drops_percent", 10,
+			[]timedValue{{0, 50}, {2 * minute, 100}, {7 * minute, 80}}, 100,
+			true},
+		{"drop below the threshold", "drops_percent", 30, []timedValue{
+			{0, 100}, {5 * minute, 80}}, 100, false},
+		{"zero reference", "drops_percent", 10, []timedValue{
+			{0, 0}, {5 * minute, -10}}, 0, false},
+	}
+
+	for _, tt := range tests {
+
+		rule := &alertRule{
+			Operator:  tt.operator,
+			Threshold: tt.threshold,
+			window:    5 * time.Minute,
+		}
+		s := &alertSeries{}
+
+		var reference float64
+		var hold bool
+		for _, tv := range tt.values {
+			reference, hold = rule.check(s, testStart+tv.timestamp, tv.value)
+		}
+
+		if reference != tt.reference || hold != tt.hold {
+			t.Errorf("%s: got %v (%t), want %v (%t)", tt.name, reference, hold,
+				tt.reference, tt.hold)
+		}
+	}
+}
+
+func TestAlertRuleEvaluate(t *testing.T) {
+
+	defer func(series map[string]*alertSeries) { alerts.series = series }(
+		alerts.series)
+	alerts.series = make(map[string]*alertSeries)
+
+	rule := &alertRule{
+		Name:        "depth",
+		Measurement: "market_depths",
+		Field:       "imbalance",
+		Tags:        map[string]string{"exchange": testExchange},
+		Operator:    ">",
+		Threshold:   5,
+		Debounce:    2,
+		cooldown:    10 * time.Minute,
+	}
+
+	tests := []struct {
+		minute int
+		value  float64
+		fired  bool
+	}{
+		{0, 6, false},
+		{0, 7, false}, // rewritten point, counted once
+		{1, 6, true},
+		{2, 6, false}, // cooldown
+		{3, 4, false},
+		{12, 6, false},
+		{13, 6, true},
+	}
+
+	tags := map[string]string{"exchange": testExchange, "market": "BTC_ETH"}
+
+	for i, tt := range tests {
+
+		fields := map[string]interface{}{"imbalance": tt.value}
+		pt, err := ifxClient.NewPoint("market_depths", tags, fields,
+			time.Unix(0, testStart+int64(tt.minute)*int64(time.Minute)))
+		if err != nil {
+			t.Fatalf("ifxClient.NewPoint: %v", err)
+		}
+
+		if a := rule.evaluate(pt, fields); (a != nil) != tt.fired {
+			t.Errorf("point %d: got fired %t, want %t", i, a != nil, tt.fired)
+		}
+	}
+
+	// other exchanges are not matched
+	fields := map[string]interface{}{"imbalance": 10.0}
+	pt, _ := ifxClient.NewPoint("market_depths",
+		map[string]string{"exchange": "bittrex"}, fields,
+		time.Unix(0, testStart))
+	if a := rule.evaluate(pt, fields); a != nil {
+		t.Errorf("unmatched tags: got %+v, want nil", *a)
+	}
+}
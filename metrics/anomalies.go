@@ -0,0 +1,445 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// anomaliesConf detects the abnormal candles of ohlc_<period> from the
+// z-scores of their return and of their log volume over the window
+// previous candles. An anomaly starts when a z-score reaches its threshold
+// and ends when both fall below end_z_threshold (or after max_length
+// candles). Candles of an anomaly are kept out of the rolling window.
+type anomaliesConf struct {
+	Period           string  `json:"period"`
+	Window           int     `json:"window"`
+	ReturnZThreshold float64 `json:"return_z_threshold"`
+	VolumeZThreshold float64 `json:"volume_z_threshold"`
+	EndZThreshold    float64 `json:"end_z_threshold"`
+	MaxLength        int     `json:"max_length"`
+}
+
+// validate requires a window of at least two candles (standard deviations)
+// and positive thresholds, anomalies ending below their start thresholds.
+func (ac *anomaliesConf) validate() error {
+
+	if ac == nil {
+		return nil
+	}
+
+	if ac.Window < 2 {
+		return fmt.Errorf("invalid window: %d", ac.Window)
+	}
+
+	if ac.ReturnZThreshold <= 0.0 || ac.VolumeZThreshold <= 0.0 ||
+		ac.EndZThreshold <= 0.0 || ac.EndZThreshold >= ac.ReturnZThreshold ||
+		ac.EndZThreshold >= ac.VolumeZThreshold {
+		return fmt.Errorf("invalid thresholds: %v %v %v", ac.ReturnZThreshold,
+			ac.VolumeZThreshold, ac.EndZThreshold)
+	}
+
+	return nil
+}
+
+type anomalyCandle struct {
+	interval int64
+	close    float64
+	volume   float64
+}
+
+// anomalyMarket is the rolling window of a market and its ongoing anomaly.
+type anomalyMarket struct {
+	lastClose float64
+	returns   []float64
+	volumes   []float64
+	anomaly   *anomaly
+}
+
+// anomaly magnitude is the largest move of the close from the close
+// preceding the start, at the peak.
+type anomaly struct {
+	start        int64
+	peak         int64
+	end          int64
+	refClose     float64
+	lastClose    float64
+	magnitude    float64
+	peakReturnZ  float64
+	peakVolumeZ  float64
+	peakScore    float64
+	volume       float64
+	baseVolume   float64
+	candles      int
+	up           bool
+	down         bool
+	volumeSpiked bool
+}
+
+func computeAnomalies() {
+
+	ac := conf.Metrics.Anomalies
+	if ac == nil {
+		return
+	}
+
+	indexPeriod := -1
+	for i, period := range conf.Metrics.OhlcPeriodsStr {
+		if period == ac.Period {
+			indexPeriod = i
+		}
+	}
+
+	if indexPeriod == -1 {
+		logger.WithField("period", ac.Period).Fatal(
+			"computeAnomalies: unknown ohlc period")
+	}
+
+	for exchange, dataSource := range conf.Metrics.Sources {
+
+		ind := &indicator{
+			period:      conf.Metrics.OhlcPeriods[indexPeriod],
+			indexPeriod: indexPeriod,
+			dataSource:  dataSource,
+			source:      "ohlc_" + ac.Period,
+			destination: "anomalies",
+			exchange:    exchange,
+		}
+
+		markets := make(map[string]*anomalyMarket)
+
+		// candles before processed are final
+		var processed int64
+
+		go networking.RunEvery(ind.period, func(nextRun int64) {
+
+			ind.nextRun = nextRun
+			ind.computeTimeIntervals(0)
+
+			// leaving a period to the ohlc being written at the same time
+			end := ind.timeIntervals[0] - int64(ind.period)
+
+			// warming the windows up on the first run
+			start, detect := processed, true
+			if processed == 0 {
+				start = end - int64(ac.Window+1)*int64(ind.period)
+				detect = false
+			}
+
+			mcandles, ok := getAnomalyCandles(ind, start, end)
+			if !ok {
+				return
+			}
+			processed = end
+
+			// several anomalies of a market may end over a catch up run
+			ended := make(map[string][]*anomaly)
+
+			for market, candles := range mcandles {
+
+				am, ok := markets[market]
+				if !ok {
+					am = &anomalyMarket{}
+					markets[market] = am
+				}
+
+				for _, c := range candles {
+					if a := am.addCandle(c, detect); a != nil {
+						ended[market] = append(ended[market], a)
+					}
+				}
+			}
+
+			prepareAnomaliesPoints(ind, ended)
+		})
+	}
+}
+
+func getAnomalyCandles(ind *indicator,
+	start, end int64) (map[string][]*anomalyCandle, bool) {
+
+	query := fmt.Sprintf(
+		`SELECT close, volume
+    FROM %s
+    WHERE exchange = '%s' AND time >= %d AND time < %d
+    GROUP BY market`,
+		ind.source, ind.exchange, start, end)
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, conf.Metrics.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   ind.period,
+		ErrorMsg: "getAnomalyCandles: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil, false
+	}
+
+	mcandles := make(map[string][]*anomalyCandle, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+
+		for _, rec := range serie.Values {
+
+			if rec[1] == nil || rec[2] == nil {
+				continue
+			}
+
+			timestamp, err := networking.ConvertJsonValueToTime(rec[0])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":  err,
+					"market": market,
+				}).Error("getAnomalyCandles: networking.ConvertJsonValueToTime")
+				continue
+			}
+
+			close, err := networking.ConvertJsonValueToFloat64(rec[1])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":  err,
+					"market": market,
+				}).Error("getAnomalyCandles: networking.ConvertJsonValueToFloat64")
+				continue
+			}
+
+			volume, err := networking.ConvertJsonValueToFloat64(rec[2])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":  err,
+					"market": market,
+				}).Error("getAnomalyCandles: networking.ConvertJsonValueToFloat64")
+				continue
+			}
+
+			mcandles[market] = append(mcandles[market],
+				&anomalyCandle{timestamp.UnixNano(), close, volume})
+		}
+	}
+
+	return mcandles, true
+}
+
+// addCandle scores c against the window, returning the anomaly it ends (nil
+// if none). Without detection the candle only feeds the window.
+func (am *anomalyMarket) addCandle(c *anomalyCandle, detect bool) *anomaly {
+
+	ac := conf.Metrics.Anomalies
+
+	if am.lastClose == 0.0 || c.close == 0.0 {
+		am.lastClose = c.close
+		return nil
+	}
+
+	ret := c.close/am.lastClose - 1
+	logVolume := math.Log1p(c.volume)
+	previousClose := am.lastClose
+	am.lastClose = c.close
+
+	returnZ, okReturn := zScore(am.returns, ret)
+	volumeZ, okVolume := zScore(am.volumes, logVolume)
+
+	if !detect || !okReturn || !okVolume {
+		am.push(ret, logVolume)
+		return nil
+	}
+
+	abnormal := math.Abs(returnZ) >= ac.ReturnZThreshold ||
+		volumeZ >= ac.VolumeZThreshold
+
+	a := am.anomaly
+
+	if a == nil {
+
+		if !abnormal {
+			am.push(ret, logVolume)
+			return nil
+		}
+
+		a = &anomaly{
+			start:      c.interval,
+			refClose:   previousClose,
+			baseVolume: math.Expm1(mean(am.volumes)),
+		}
+		am.anomaly = a
+	}
+
+	a.update(c, returnZ, volumeZ)
+
+	calm := math.Abs(returnZ) < ac.EndZThreshold &&
+		volumeZ < ac.EndZThreshold
+
+	if calm || ac.MaxLength > 0 && a.candles >= ac.MaxLength {
+		a.end = c.interval
+		am.anomaly = nil
+		return a
+	}
+
+	return nil
+}
+
+func (am *anomalyMarket) push(ret, logVolume float64) {
+
+	window := conf.Metrics.Anomalies.Window
+
+	am.returns = append(am.returns, ret)
+	if len(am.returns) > window {
+		am.returns = am.returns[1:]
+	}
+
+	am.volumes = append(am.volumes, logVolume)
+	if len(am.volumes) > window {
+		am.volumes = am.volumes[1:]
+	}
+}
+
+func (a *anomaly) update(c *anomalyCandle, returnZ, volumeZ float64) {
+
+	ac := conf.Metrics.Anomalies
+
+	a.candles++
+	a.volume += c.volume
+	a.lastClose = c.close
+
+	if returnZ >= ac.ReturnZThreshold {
+		a.up = true
+	}
+	if returnZ <= -ac.ReturnZThreshold {
+		a.down = true
+	}
+	if volumeZ >= ac.VolumeZThreshold {
+		a.volumeSpiked = true
+	}
+
+	if move := (c.close/a.refClose - 1) * 100; math.Abs(move) >=
+		math.Abs(a.magnitude) {
+		a.magnitude = move
+	}
+
+	score := math.Max(math.Abs(returnZ)/ac.ReturnZThreshold,
+		volumeZ/ac.VolumeZThreshold)
+
+	if a.peak == 0 || score > a.peakScore {
+		a.peak = c.interval
+		a.peakScore = score
+		a.peakReturnZ = returnZ
+		a.peakVolumeZ = volumeZ
+	}
+}
+
+// kind is pump_and_dump when the price spiked both ways, pump or dump one
+// way and volume_spike without price spike.
+func (a *anomaly) kind() string {
+
+	switch {
+	case a.up && a.down:
+		return "pump_and_dump"
+	case a.up:
+		return "pump"
+	case a.down:
+		return "dump"
+	}
+
+	return "volume_spike"
+}
+
+// zScore returns the z-score of value within window (false if the window
+// is not full or flat).
+func zScore(window []float64, value float64) (float64, bool) {
+
+	if len(window) < conf.Metrics.Anomalies.Window {
+		return 0.0, false
+	}
+
+	m := mean(window)
+
+	variance := 0.0
+	for _, v := range window {
+		variance += (v - m) * (v - m)
+	}
+	stdDev := math.Sqrt(variance / float64(len(window)-1))
+
+	if stdDev == 0.0 {
+		return 0.0, false
+	}
+
+	return (value - m) / stdDev, true
+}
+
+func mean(values []float64) float64 {
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
+
+func prepareAnomaliesPoints(ind *indicator, ended map[string][]*anomaly) {
+
+	measurement, ok := conf.Metrics.Schema["anomalies_measurement"]
+	if !ok {
+		return
+	}
+
+	points := make([]*ifxClient.Point, 0, len(ended))
+
+	for market, anomalies := range ended {
+		for _, a := range anomalies {
+
+			tags := map[string]string{
+				"market":   market,
+				"exchange": ind.exchange,
+				"kind":     a.kind(),
+			}
+
+			fields := map[string]interface{}{
+				"peak_time":         a.peak,
+				"end_time":          a.end + int64(ind.period),
+				"magnitude_percent": a.magnitude,
+				"return_percent":    (a.lastClose/a.refClose - 1) * 100,
+				"peak_return_z":     a.peakReturnZ,
+				"peak_volume_z":     a.peakVolumeZ,
+				"volume":            a.volume,
+				"base_volume":       a.baseVolume,
+				"candles":           a.candles,
+				"volume_spike":      a.volumeSpiked,
+			}
+
+			pt, err := ifxClient.NewPoint(measurement, tags, fields,
+				time.Unix(0, a.start))
+			if err != nil {
+				logger.WithField("error", err).Error(
+					"prepareAnomaliesPoints: ifxClient.NewPoint")
+				continue
+			}
+			points = append(points, pt)
+
+			logger.WithFields(logrus.Fields{
+				"exchange":  ind.exchange,
+				"market":    market,
+				"kind":      a.kind(),
+				"magnitude": a.magnitude,
+			}).Info("prepareAnomaliesPoints: anomaly")
+		}
+	}
+
+	sendBatchPoints(ind, "Anomalies", points)
+}
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnomalyMarketAddCandle(t *testing.T) {
+
+	defer func(ac *anomaliesConf) { conf.Metrics.Anomalies = ac }(
+		conf.Metrics.Anomalies)
+
+	// alternating closes and volumes, then a pump and a dump
+	closes := []float64{100, 101, 100, 101, 100, 101, 100, 130, 131, 100,
+		100.5}
+	volumes := []float64{10, 12, 10, 12, 10, 12, 10, 100, 11, 10, 11}
+
+	type want struct {
+		start, peak, end int
+		candles          int
+		kind             string
+		magnitude        float64
+	}
+
+	tests := []struct {
+		name      string
+		maxLength int
+		detect    bool
+		want      []want
+	}{
+		{"pump then dump", 0, true, []want{
+			{7, 7, 8, 2, "pump", (131.0/100 - 1) * 100},
+			{9, 9, 10, 2, "dump", (100.0/131 - 1) * 100},
+		}},
+		{"max length", 1, true, []want{
+			{7, 7, 7, 1, "pump", (130.0/100 - 1) * 100},
+			{9, 9, 9, 1, "dump", (100.0/131 - 1) * 100},
+		}},
+		{"warming up", 0, false, nil},
+	}
+
+	interval := func(i int) int64 {
+		return testStart + int64(i)*int64(time.Minute)
+	}
+
+	for _, tt := range tests {
+
+		conf.Metrics.Anomalies = &anomaliesConf{
+			Window:           5,
+			ReturnZThreshold: 3,
+			VolumeZThreshold: 3,
+			EndZThreshold:    1,
+			MaxLength:        tt.maxLength,
+		}
+
+		am := &anomalyMarket{}
+		ended := make([]*anomaly, 0)
+
+		for i := range closes {
+			c := &anomalyCandle{interval(i), closes[i], volumes[i]}
+			if a := am.addCandle(c, tt.detect); a != nil {
+				ended = append(ended, a)
+			}
+		}
+
+		if len(ended) != len(tt.want) {
+			t.Errorf("%s: got %d anomalies, want %d", tt.name, len(ended),
+				len(tt.want))
+			continue
+		}
+
+		for i, a := range ended {
+
+			w := tt.want[i]
+
+			if a.start != interval(w.start) || a.peak != interval(w.peak) ||
+				a.end != interval(w.end) || a.candles != w.candles ||
+				a.kind() != w.kind || !approxEqual(a.magnitude, w.magnitude) {
+				t.Errorf("%s: anomaly %d: got %+v (%s), want %+v", tt.name, i,
+					*a, a.kind(), w)
+			}
+		}
+	}
+}
+
+func TestPrepareAnomaliesPoints(t *testing.T) {
+
+	conf.Metrics.Schema["anomalies_measurement"] = "anomalies"
+	defer delete(conf.Metrics.Schema, "anomalies_measurement")
+
+	ind := newTestIndicator(time.Minute, 0)
+	minute := int64(time.Minute)
+
+	// two anomalies of a market ended by a single run
+	ended := map[string][]*anomaly{"BTC_ETH": {
+		{start: testStart, end: testStart + minute, refClose: 100,
+			lastClose: 120, up: true},
+		{start: testStart + 5*minute, end: testStart + 6*minute,
+			refClose: 120, lastClose: 100, down: true},
+	}}
+
+	prepareAnomaliesPoints(ind, ended)
+
+	starts := make([]int64, 0)
+	select {
+	case bp := <-batchsToWrite:
+		for _, pt := range bp.Points {
+			starts = append(starts, pt.Time().UnixNano())
+		}
+	default:
+	}
+
+	if len(starts) != 2 || starts[0] != testStart ||
+		starts[1] != testStart+5*minute {
+		t.Errorf("got points at %v, want at %d and %d", starts, testStart,
+			testStart+5*minute)
+	}
+}
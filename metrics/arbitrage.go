@@ -0,0 +1,302 @@
+package metrics
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"trading/networking"
+	"trading/networking/symbols"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// arbitrageConf sets the notionals (base currency) of the spreads, the taker
+// fees (rate) by exchange and the withdrawal costs by exchange and canonical
+// currency (units of the currency). Events are written when the net spread
+// crosses threshold_bps.
+type arbitrageConf struct {
+	Frequency       string                        `json:"frequency"`
+	Notionals       []float64                     `json:"notionals"`
+	TakerFees       map[string]float64            `json:"taker_fees"`
+	WithdrawalCosts map[string]map[string]float64 `json:"withdrawal_costs"`
+	ThresholdBps    float64                       `json:"threshold_bps"`
+}
+
+// arbitrageSpread is the spread of buying notional of a pair on an exchange
+// and selling the quantity bought on another. Costs and spreads are in basis points of the
+// notional.
+type arbitrageSpread struct {
+	pair          *symbols.Pair
+	buyExchange   string
+	sellExchange  string
+	notional      float64
+	buy           *SlippageEstimate
+	sell          *SlippageEstimate
+	grossBps      float64
+	feesBps       float64
+	withdrawalBps float64
+	netBps        float64
+	booksDelay    time.Duration
+}
+
+func computeArbitrage() {
+
+	if conf.Metrics.Arbitrage == nil {
+		return
+	}
+
+	f, err := time.ParseDuration(conf.Metrics.Arbitrage.Frequency)
+	if err != nil {
+		logger.WithField("error", err).Fatal(
+			"computeArbitrage: time.ParseDuration")
+	}
+
+	ind := &indicator{
+		period:   f,
+		exchange: "arbitrage",
+	}
+
+	// tags of the spreads above the threshold at the last run
+	opened := make(map[string]map[string]string)
+
+	go networking.RunEvery(f, func(nextRun int64) {
+
+		ind.nextRun = nextRun
+
+		spreads := getArbitrageSpreads()
+		prepareArbitrageSpreadsPoints(ind, spreads)
+		prepareArbitrageEventsPoints(ind, spreads, opened)
+	})
+}
+
+// getArbitrageSpreads returns the spreads of the canonical pairs traded on
+// several exchanges, from the last books of the market depths.
+func getArbitrageSpreads() []*arbitrageSpread {
+
+	books, timestamps := getLastBooks()
+	ac := conf.Metrics.Arbitrage
+
+	// native market of each canonical pair by exchange
+	pairs := make(map[symbols.Pair]map[string]string)
+
+	for exchange, obs := range books {
+		for market := range obs {
+
+			pair, err := symbols.Canonical(exchange, market)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"exchange": exchange,
+					"market":   market,
+				}).Debug("getArbitrageSpreads: symbols.Canonical")
+				continue
+			}
+
+			if _, ok := pairs[*pair]; !ok {
+				pairs[*pair] = make(map[string]string)
+			}
+			pairs[*pair][exchange] = market
+		}
+	}
+
+	spreads := make([]*arbitrageSpread, 0)
+
+	for pair, markets := range pairs {
+
+		pair := pair
+
+		for buyExchange, buyMarket := range markets {
+			for sellExchange, sellMarket := range markets {
+
+				if buyExchange == sellExchange {
+					continue
+				}
+
+				buyBook := books[buyExchange][buyMarket]
+				sellBook := books[sellExchange][sellMarket]
+				booksDelay := time.Duration(math.Abs(float64(
+					timestamps[buyExchange] - timestamps[sellExchange])))
+
+				for _, notional := range ac.Notionals {
+
+					// the quantity bought is sold on the other exchange
+					buy := estimateSlippage(buyBook, SideBuy, notional)
+					if buy.Quantity == 0.0 {
+						continue
+					}
+
+					sell := estimateSlippageQuantity(sellBook, SideSell,
+						buy.Quantity)
+					if sell.Quantity == 0.0 {
+						continue
+					}
+
+					as := &arbitrageSpread{
+						pair:         &pair,
+						buyExchange:  buyExchange,
+						sellExchange: sellExchange,
+						notional:     notional,
+						buy:          buy,
+						sell:         sell,
+						booksDelay:   booksDelay,
+					}
+
+					as.computeNetSpread()
+					spreads = append(spreads, as)
+				}
+			}
+		}
+	}
+
+	return spreads
+}
+
+// computeNetSpread sets the spread of selling the quantity bought, net of
+// the taker fees of both exchanges and of the withdrawal of the quote
+// currency from the buying exchange.
+func (as *arbitrageSpread) computeNetSpread() {
+
+	ac := conf.Metrics.Arbitrage
+	quantity := math.Min(as.buy.Quantity, as.sell.Quantity)
+
+	bought := quantity * as.buy.AveragePrice
+	sold := quantity * as.sell.AveragePrice
+
+	as.grossBps = (sold - bought) / bought * 10000
+	as.feesBps = (ac.TakerFees[as.buyExchange] + ac.TakerFees[as.sellExchange]) *
+		10000
+
+	withdrawal := ac.WithdrawalCosts[as.buyExchange][as.pair.Quote]
+	as.withdrawalBps = withdrawal * as.sell.AveragePrice / bought * 10000
+
+	as.netBps = as.grossBps - as.feesBps - as.withdrawalBps
+}
+
+func (as *arbitrageSpread) tags() map[string]string {
+
+	return map[string]string{
+		"base":          as.pair.Base,
+		"quote":         as.pair.Quote,
+		"buy_exchange":  as.buyExchange,
+		"sell_exchange": as.sellExchange,
+		"notional":      strconv.FormatFloat(as.notional, 'f', -1, 64),
+	}
+}
+
+func prepareArbitrageSpreadsPoints(ind *indicator, spreads []*arbitrageSpread) {
+
+	measurement, ok := conf.Metrics.Schema["arbitrage_spreads_measurement"]
+	if !ok {
+		return
+	}
+
+	timestamp := time.Unix(0, ind.nextRun)
+	points := make([]*ifxClient.Point, 0, len(spreads))
+
+	for _, as := range spreads {
+
+		fields := map[string]interface{}{
+			"buy_price":      as.buy.AveragePrice,
+			"sell_price":     as.sell.AveragePrice,
+			"gross_bps":      as.grossBps,
+			"fees_bps":       as.feesBps,
+			"withdrawal_bps": as.withdrawalBps,
+			"net_bps":        as.netBps,
+			"filled":         as.buy.Filled && as.sell.Filled,
+			"books_delay_ms": int64(as.booksDelay / time.Millisecond),
+		}
+
+		pt, err := ifxClient.NewPoint(measurement, as.tags(), fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareArbitrageSpreadsPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	sendBatchPoints(ind, "ArbitrageSpreads", points)
+}
+
+// prepareArbitrageEventsPoints writes the spreads whose net spread crossed
+// the threshold since the last run (opened above, closed below). Opened
+// spreads no longer computed (book missing or not deep enough) are closed as
+// unavailable.
+func prepareArbitrageEventsPoints(ind *indicator, spreads []*arbitrageSpread,
+	opened map[string]map[string]string) {
+
+	measurement, ok := conf.Metrics.Schema["arbitrage_events_measurement"]
+	if !ok {
+		return
+	}
+
+	timestamp := time.Unix(0, ind.nextRun)
+	points := make([]*ifxClient.Point, 0)
+	seen := make(map[string]bool, len(spreads))
+
+	for _, as := range spreads {
+
+		tags := as.tags()
+		key := strings.Join([]string{tags["base"], tags["quote"],
+			tags["buy_exchange"], tags["sell_exchange"], tags["notional"]}, "/")
+		seen[key] = true
+
+		_, wasAbove := opened[key]
+		above := as.netBps >= conf.Metrics.Arbitrage.ThresholdBps
+		if above == wasAbove {
+			continue
+		}
+
+		delete(opened, key)
+		tags["event"] = "closed"
+
+		if above {
+			opened[key] = as.tags()
+			tags["event"] = "opened"
+
+			logger.WithFields(logrus.Fields{
+				"pair":    as.pair.Base + "/" + as.pair.Quote,
+				"buy":     as.buyExchange,
+				"sell":    as.sellExchange,
+				"net_bps": as.netBps,
+			}).Info("prepareArbitrageEventsPoints: opportunity")
+		}
+
+		fields := map[string]interface{}{
+			"buy_price":  as.buy.AveragePrice,
+			"sell_price": as.sell.AveragePrice,
+			"net_bps":    as.netBps,
+		}
+
+		pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareArbitrageEventsPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	for key, tags := range opened {
+
+		if seen[key] {
+			continue
+		}
+		delete(opened, key)
+
+		tags["event"] = "closed"
+		fields := map[string]interface{}{"unavailable": true}
+
+		pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareArbitrageEventsPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	sendBatchPoints(ind, "ArbitrageEvents", points)
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+	"trading/networking/symbols"
+)
+
+func newTestSpread(quote string, buyPrice, sellPrice, sellQuantity float64,
+	netBps float64) *arbitrageSpread {
+
+	return &arbitrageSpread{
+		pair:         &symbols.Pair{Base: "BTC", Quote: quote},
+		buyExchange:  "poloniex",
+		sellExchange: "bittrex",
+		notional:     1,
+		buy:          &SlippageEstimate{Quantity: 1, AveragePrice: buyPrice},
+		sell: &SlippageEstimate{Quantity: sellQuantity,
+			AveragePrice: sellPrice},
+		netBps: netBps,
+	}
+}
+
+func TestComputeNetSpread(t *testing.T) {
+
+	defer func(a *arbitrageConf) { conf.Metrics.Arbitrage = a }(
+		conf.Metrics.Arbitrage)
+	conf.Metrics.Arbitrage = &arbitrageConf{
+		TakerFees: map[string]float64{"poloniex": 0.001, "bittrex": 0.002},
+		WithdrawalCosts: map[string]map[string]float64{
+			"poloniex": {"ETH": 0.01},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		as            *arbitrageSpread
+		withdrawalBps float64
+		netBps        float64
+	}{
+		// 0.01 ETH at 102 for a notional of 100
+		{"sold", newTestSpread("ETH", 100, 102, 1, 0), 102, 68},
+		{"half sold", newTestSpread("ETH", 100, 102, 0.5, 0), 204, -34},
+		{"no withdrawal cost", newTestSpread("XMR", 100, 102, 1, 0), 0, 170},
+	}
+
+	for _, tt := range tests {
+
+		tt.as.computeNetSpread()
+
+		if !approxEqual(tt.as.grossBps, 200) || !approxEqual(tt.as.feesBps, 30) ||
+			!approxEqual(tt.as.withdrawalBps, tt.withdrawalBps) ||
+			!approxEqual(tt.as.netBps, tt.netBps) {
+			t.Errorf("%s: got %+v, want withdrawal %v and net %v bps", tt.name,
+				tt.as, tt.withdrawalBps, tt.netBps)
+		}
+	}
+}
+
+func TestEstimateSlippageQuantity(t *testing.T) {
+
+	ob := &orderBook{
+		bids: []*order{{rate: 10, quantity: 1}, {rate: 9, quantity: 2}},
+	}
+
+	tests := []struct {
+		quantity float64
+		notional float64
+		filled   bool
+	}{
+		{0.5, 5, true},
+		{2, 19, true},
+		{4, 28, false},
+	}
+
+	for _, tt := range tests {
+
+		se := estimateSlippageQuantity(ob, SideSell, tt.quantity)
+		if !approxEqual(se.Notional, tt.notional) || se.Filled != tt.filled ||
+			(tt.filled && se.Quantity != tt.quantity) {
+			t.Errorf("quantity %v: got %+v, want notional %v", tt.quantity, se,
+				tt.notional)
+		}
+	}
+}
+
+func TestPrepareArbitrageEventsPoints(t *testing.T) {
+
+	defer func(a *arbitrageConf) { conf.Metrics.Arbitrage = a }(
+		conf.Metrics.Arbitrage)
+	conf.Metrics.Arbitrage = &arbitrageConf{ThresholdBps: 50}
+
+	conf.Metrics.Schema["arbitrage_events_measurement"] = "arbitrage_events"
+	defer delete(conf.Metrics.Schema, "arbitrage_events_measurement")
+
+	ind := newTestIndicator(time.Minute, 0)
+	ind.exchange = "arbitrage"
+	opened := make(map[string]map[string]string)
+
+	runs := []struct {
+		spreads []*arbitrageSpread
+		want    map[string]string // event by quote
+	}{
+		{
+			spreads: []*arbitrageSpread{
+				newTestSpread("ETH", 100, 102, 1, 68),
+				newTestSpread("XMR", 100, 101, 1, 10),
+			},
+			want: map[string]string{"ETH": "opened"},
+		},
+		{
+			// ETH no longer computed
+			spreads: []*arbitrageSpread{newTestSpread("XMR", 100, 101, 1, 60)},
+			want:    map[string]string{"ETH": "closed", "XMR": "opened"},
+		},
+		{
+			spreads: []*arbitrageSpread{newTestSpread("XMR", 100, 101, 1, 60)},
+		},
+		{
+			spreads: []*arbitrageSpread{newTestSpread("XMR", 100, 101, 1, 10)},
+			want:    map[string]string{"XMR": "closed"},
+		},
+	}
+
+	for i, run := range runs {
+
+		prepareArbitrageEventsPoints(ind, run.spreads, opened)
+
+		got := make(map[string]string)
+		select {
+		case bp := <-batchsToWrite:
+			for _, pt := range bp.Points {
+				got[pt.Tags()["quote"]] = pt.Tags()["event"]
+			}
+		default:
+		}
+
+		if len(got) != len(run.want) {
+			t.Errorf("run %d: got %v, want %v", i, got, run.want)
+			continue
+		}
+
+		for quote, event := range run.want {
+			if got[quote] != event {
+				t.Errorf("run %d: got %v, want %v", i, got, run.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"trading/networking/database"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	backfillCheckpointEvery = 30 * time.Second
+	backfillReportEvery     = 10 * time.Second
+	backfillWritesTimeout   = 5 * time.Minute
+)
+
+// BackfillOptions describes the metrics to recompute from raw data.
+// Markets is optional (all markets of the exchange if empty) and
+// CheckpointPath allows to resume an interrupted backfill.
+type BackfillOptions struct {
+	Exchange       string
+	Markets        []string
+	From           time.Time
+	To             time.Time
+	Parallelism    int
+	CheckpointPath string
+	MarketDepths   bool
+}
+
+// backfillStep tracks the writes of the whole backfill so that progress is
+// only checkpointed once the points have been written.
+type backfillStep struct {
+	writes *backfillWrites
+}
+
+// backfillWrites counts the pending writes and keeps the first failure.
+type backfillWrites struct {
+	sync.WaitGroup
+	failed chan error
+}
+
+type backfillCheckpoint struct {
+	Exchange              string   `json:"exchange"`
+	Markets               []string `json:"markets"`
+	From                  int64    `json:"from"`
+	To                    int64    `json:"to"`
+	OHLCDoneUntil         int64    `json:"ohlc_done_until"`
+	MarketDepthsDoneUntil int64    `json:"market_depths_done_until"`
+}
+
+type backfillProgress struct {
+	name       string
+	exchange   string
+	total      int
+	done       int
+	begin      time.Time
+	lastReport time.Time
+}
+
+type prefetchedOHLC struct {
+	nextRun int64
+	imohlc  chan map[int64]map[string]*ohlc
+}
+
+// Backfill recomputes the ohlc of every period with their derived indicators
+// (and optionally the market depths) of an exchange between from and to.
+// Points are written with the tags and timestamps of the live computation,
+// existing points are therefore overwritten and a backfill can safely be run
+// several times over the same range.
+func Backfill(opts *BackfillOptions) error {
+
+	dataSource, ok := conf.Metrics.Sources[opts.Exchange]
+	if !ok {
+		return fmt.Errorf("unknown exchange: %s", opts.Exchange)
+	}
+
+	if !opts.From.Before(opts.To) {
+		return fmt.Errorf("invalid range: %s - %s", opts.From, opts.To)
+	}
+
+	if opts.Parallelism < 1 {
+		opts.Parallelism = 1
+	}
+
+	cp, err := loadBackfillCheckpoint(opts)
+	if err != nil {
+		return fmt.Errorf("loadBackfillCheckpoint: %v", err)
+	}
+
+	// flushing batchs periodically
+	period := time.Duration(conf.Metrics.FlushBatchsPeriodMs) * time.Millisecond
+
+	go database.FlushEvery(period, &database.FlushInfo{
+		batchsToWrite,
+		conf.Metrics.Schema["database"],
+		dbClient,
+	})
+
+	writes := &backfillWrites{failed: make(chan error, 1)}
+
+	if err := backfillOHLC(opts, dataSource, cp, writes); err != nil {
+		return fmt.Errorf("backfillOHLC: %v", err)
+	}
+
+	if opts.MarketDepths {
+		if err := backfillMarketDepths(opts, dataSource, cp, writes); err != nil {
+			return fmt.Errorf("backfillMarketDepths: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// backfillOHLC replays the base period bucket by bucket. Trades are fetched
+// in parallel ahead of time while buckets are computed in order as indicators
+// are seeded from the previous ones.
+func backfillOHLC(opts *BackfillOptions, dataSource *exchangeConf,
+	cp *backfillCheckpoint, writes *backfillWrites) error {
+
+	period := int64(conf.Metrics.OhlcPeriods[0])
+
+	// a lag of one period makes each run compute its last closed bucket only
+	source := *dataSource
+	source.UpdateLag = conf.Metrics.OhlcPeriods[0]
+
+	start := cp.From - cp.From%period
+	if cp.OHLCDoneUntil > start {
+		start = cp.OHLCDoneUntil
+	}
+
+	if start >= cp.To {
+		return nil
+	}
+
+	newIndicator := func(nextRun int64) *indicator {
+		return &indicator{
+			nextRun:     nextRun,
+			period:      conf.Metrics.OhlcPeriods[0],
+			indexPeriod: 0,
+			dataSource:  &source,
+			destination: "ohlc_" + conf.Metrics.OhlcPeriodsStr[0],
+			exchange:    opts.Exchange,
+			markets:     opts.Markets,
+		}
+	}
+
+	queue := make(chan *prefetchedOHLC, opts.Parallelism)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+
+		defer close(queue)
+		sem := make(chan struct{}, opts.Parallelism)
+
+		for bucket := start; bucket < cp.To; bucket += period {
+
+			p := &prefetchedOHLC{
+				nextRun: bucket + period,
+				imohlc:  make(chan map[int64]map[string]*ohlc, 1),
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-stop:
+				return
+			}
+
+			select {
+			case queue <- p:
+			case <-stop:
+				return
+			}
+
+			go func(p *prefetchedOHLC) {
+				defer func() { <-sem }()
+
+				ind := newIndicator(p.nextRun)
+				ind.computeTimeIntervals(0)
+				p.imohlc <- getOHLCFromTrades(ind)
+			}(p)
+		}
+	}()
+
+	progress := newBackfillProgress("backfillOHLC", opts.Exchange,
+		int((cp.To-start+period-1)/period))
+	lastCheckpoint := time.Now()
+
+	for p := range queue {
+
+		imohlc := <-p.imohlc
+		if imohlc == nil {
+			return fmt.Errorf("getOHLCFromTrades: failed at %s",
+				time.Unix(0, p.nextRun-period).UTC())
+		}
+
+		ind := newIndicator(p.nextRun)
+		ind.prefetched = imohlc
+		ind.step = &backfillStep{writes: writes}
+
+		if failed := metricsDAG.run(ind); len(failed) != 0 {
+			return fmt.Errorf("metricsDAG.run: %s failed at %s",
+				strings.Join(failed, ", "),
+				time.Unix(0, p.nextRun-period).UTC())
+		}
+		progress.add(1)
+
+		if time.Since(lastCheckpoint) >= backfillCheckpointEvery ||
+			p.nextRun >= cp.To {
+
+			if err := waitBackfillWrites(writes); err != nil {
+				return fmt.Errorf("waitBackfillWrites: %v", err)
+			}
+
+			cp.OHLCDoneUntil = p.nextRun
+			if err := cp.save(opts.CheckpointPath); err != nil {
+				return fmt.Errorf("cp.save: %v", err)
+			}
+			lastCheckpoint = time.Now()
+		}
+	}
+
+	return nil
+}
+
+// backfillMarketDepths rebuilds the order books as they were at each run of
+// the market depths frequency. Runs don't depend on each other and are
+// computed in parallel.
+func backfillMarketDepths(opts *BackfillOptions, dataSource *exchangeConf,
+	cp *backfillCheckpoint, writes *backfillWrites) error {
+
+	if opts.Exchange != "bittrex" && opts.Exchange != "poloniex" {
+		return fmt.Errorf("market depths not supported: %s", opts.Exchange)
+	}
+
+	f, err := time.ParseDuration(conf.Metrics.MarketDepths.Frequency)
+	if err != nil {
+		return fmt.Errorf("time.ParseDuration: %v", err)
+	}
+	frequency := int64(f)
+
+	// runs are aligned on the frequency as in the live computation
+	start := cp.From + (frequency-cp.From%frequency)%frequency
+	if cp.MarketDepthsDoneUntil >= start {
+		start = cp.MarketDepthsDoneUntil + frequency
+	}
+
+	if start > cp.To {
+		return nil
+	}
+
+	progress := newBackfillProgress("backfillMarketDepths", opts.Exchange,
+		int((cp.To-start)/frequency)+1)
+	lastCheckpoint := time.Now()
+	chunkSize := frequency * int64(opts.Parallelism)
+
+	for chunk := start; chunk <= cp.To; chunk += chunkSize {
+
+		var wg sync.WaitGroup
+		last := chunk
+
+		for nextRun := chunk; nextRun <= cp.To &&
+			nextRun < chunk+chunkSize; nextRun += frequency {
+
+			last = nextRun
+			wg.Add(1)
+
+			go func(nextRun int64) {
+				defer wg.Done()
+
+				computePastMarketDepths(&indicator{
+					nextRun:    nextRun,
+					period:     f,
+					dataSource: dataSource,
+					exchange:   opts.Exchange,
+					markets:    opts.Markets,
+					step:       &backfillStep{writes: writes},
+				})
+			}(nextRun)
+		}
+
+		wg.Wait()
+		progress.add(int((last-chunk)/frequency) + 1)
+
+		if time.Since(lastCheckpoint) >= backfillCheckpointEvery ||
+			last+frequency > cp.To {
+
+			if err := waitBackfillWrites(writes); err != nil {
+				return fmt.Errorf("waitBackfillWrites: %v", err)
+			}
+
+			cp.MarketDepthsDoneUntil = last
+			if err := cp.save(opts.CheckpointPath); err != nil {
+				return fmt.Errorf("cp.save: %v", err)
+			}
+			lastCheckpoint = time.Now()
+		}
+	}
+
+	return nil
+}
+
+func computePastMarketDepths(ind *indicator) {
+
+	var obs orderBooks
+
+	switch ind.exchange {
+	case "bittrex":
+		obs = getLastOrderBooksBittrex(ind, ind.markets)
+
+	case "poloniex":
+		obs = getLastOrderBooksPoloniex(ind, ind.markets)
+		bookUpdates := getBookUpdates(obs, ind)
+		mergeOrderBooksWithBookUpdates(obs, bookUpdates)
+	}
+
+	mds := getMarketDepths(obs)
+	prepareMarketDepthsPoints(ind, mds)
+	prepareBookMetricsPoints(ind, getBookMetrics(obs))
+	prepareSlippagesPoints(ind, obs)
+	prepareBookHeatmapsPoints(ind, obs)
+}
+
+func (w *backfillWrites) done(err error) {
+
+	if err != nil {
+		select {
+		case w.failed <- err:
+		default:
+		}
+	}
+
+	w.Done()
+}
+
+// waitBackfillWrites waits for the points sent so far to be written, failing
+// as soon as a write failed.
+func waitBackfillWrites(writes *backfillWrites) error {
+
+	done := make(chan struct{})
+
+	go func() {
+		writes.Wait()
+		close(done)
+	}()
+
+	select {
+	case err := <-writes.failed:
+		return fmt.Errorf("write failed: %v", err)
+	case <-done:
+	case <-time.After(backfillWritesTimeout):
+		return fmt.Errorf("writes not acknowledged after %s",
+			backfillWritesTimeout)
+	}
+
+	// failures are reported before the writes are done
+	select {
+	case err := <-writes.failed:
+		return fmt.Errorf("write failed: %v", err)
+	default:
+		return nil
+	}
+}
+
+func loadBackfillCheckpoint(opts *BackfillOptions) (*backfillCheckpoint, error) {
+
+	cp := &backfillCheckpoint{
+		Exchange: opts.Exchange,
+		Markets:  opts.Markets,
+		From:     opts.From.UnixNano(),
+		To:       opts.To.UnixNano(),
+	}
+
+	if opts.CheckpointPath == "" {
+		return cp, nil
+	}
+
+	content, err := ioutil.ReadFile(opts.CheckpointPath)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadFile: %v", err)
+	}
+
+	saved := &backfillCheckpoint{}
+	if err := json.Unmarshal(content, saved); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %v", err)
+	}
+
+	if saved.Exchange != cp.Exchange || saved.From != cp.From ||
+		saved.To != cp.To ||
+		strings.Join(saved.Markets, ",") != strings.Join(cp.Markets, ",") {
+		return nil, fmt.Errorf("%s doesn't match the backfill options",
+			opts.CheckpointPath)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"exchange":                 saved.Exchange,
+		"ohlc_done_until":          time.Unix(0, saved.OHLCDoneUntil).UTC(),
+		"market_depths_done_until": time.Unix(0, saved.MarketDepthsDoneUntil).UTC(),
+	}).Info("loadBackfillCheckpoint: resuming")
+
+	return saved, nil
+}
+
+func (cp *backfillCheckpoint) save(path string) error {
+
+	if path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json.MarshalIndent: %v", err)
+	}
+
+	// writing then renaming so that an interruption never corrupts the file
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("ioutil.WriteFile: %v", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("os.Rename: %v", err)
+	}
+
+	return nil
+}
+
+func newBackfillProgress(name, exchange string, total int) *backfillProgress {
+
+	now := time.Now()
+
+	return &backfillProgress{
+		name:       name,
+		exchange:   exchange,
+		total:      total,
+		begin:      now,
+		lastReport: now,
+	}
+}
+
+func (p *backfillProgress) add(count int) {
+
+	p.done += count
+
+	if time.Since(p.lastReport) < backfillReportEvery && p.done < p.total {
+		return
+	}
+	p.lastReport = time.Now()
+
+	elapsed := time.Since(p.begin)
+	eta := time.Duration(float64(elapsed) / float64(p.done) *
+		float64(p.total-p.done))
+
+	logger.WithFields(logrus.Fields{
+		"exchange": p.exchange,
+		"done":     p.done,
+		"total":    p.total,
+		"progress": fmt.Sprintf("%.1f%%", float64(p.done)*100/float64(p.total)),
+		"elapsed":  elapsed.Truncate(time.Second),
+		"eta":      eta.Truncate(time.Second),
+	}).Info(p.name)
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitBackfillWrites(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		results []error // of the pending writes
+		wantErr bool
+	}{
+		{"no pending write", nil, false},
+		{"all written", []error{nil, nil, nil}, false},
+		{"one failed", []error{nil, errors.New("timeout"), nil}, true},
+		{"all failed", []error{errors.New("a"), errors.New("b")}, true},
+	}
+
+	for _, tt := range tests {
+
+		writes := &backfillWrites{failed: make(chan error, 1)}
+		writes.Add(len(tt.results))
+
+		for _, err := range tt.results {
+			go writes.done(err)
+		}
+
+		if err := waitBackfillWrites(writes); (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %t", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBackfillCheckpoint(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	from := time.Date(2017, 9, 1, 0, 0, 0, 0, time.UTC)
+	opts := &BackfillOptions{
+		Exchange:       "poloniex",
+		Markets:        []string{"BTC_ETH"},
+		From:           from,
+		To:             from.Add(24 * time.Hour),
+		CheckpointPath: filepath.Join(dir, "backfill.json"),
+	}
+
+	cp, err := loadBackfillCheckpoint(opts)
+	if err != nil || cp.OHLCDoneUntil != 0 {
+		t.Fatalf("new checkpoint: got %+v, %v", cp, err)
+	}
+
+	cp.OHLCDoneUntil = from.Add(time.Hour).UnixNano()
+	if err := cp.save(opts.CheckpointPath); err != nil {
+		t.Fatalf("cp.save: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		markets []string
+		want    int64
+		wantErr bool
+	}{
+		{"resumed", []string{"BTC_ETH"}, cp.OHLCDoneUntil, false},
+		{"other markets", []string{"BTC_XMR"}, 0, true},
+	}
+
+	for _, tt := range tests {
+
+		opts.Markets = tt.markets
+
+		got, err := loadBackfillCheckpoint(opts)
+		if (err != nil) != tt.wantErr || err == nil && got.OHLCDoneUntil != tt.want {
+			t.Errorf("%s: got %+v, %v", tt.name, got, err)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+type barsConf struct {
+	Frequency string                    `json:"frequency"`
+	Default   *barThresholds            `json:"default"`
+	Markets   map[string]*barThresholds `json:"markets"`
+}
+
+// barThresholds closes a bar every Ticks trades, every Volume quantity
+// traded, every Dollars total traded (base currency) or once the tick
+// imbalance (trades signed by the tick rule) reaches Imbalance. A threshold
+// of 0 disables the bar.
+type barThresholds struct {
+	Ticks     float64 `json:"ticks"`
+	Volume    float64 `json:"volume"`
+	Dollars   float64 `json:"dollars"`
+	Imbalance float64 `json:"imbalance"`
+}
+
+type barKind struct {
+	measurement string
+	typePoint   string
+	threshold   func(*barThresholds) float64
+	size        func(*bar) float64
+}
+
+type bar struct {
+	ohlc
+	start     int64
+	ticks     float64
+	imbalance float64
+}
+
+type marketBars struct {
+	bars     map[string]*bar
+	lastRate float64
+	lastSign float64
+}
+
+type barsState struct {
+	checkedUntil int64
+	markets      map[string]*marketBars
+}
+
+type barTrade struct {
+	timestamp int64
+	rate      float64
+	quantity  float64
+	total     float64
+}
+
+var barKinds = []*barKind{
+	{
+		measurement: "tick_bars",
+		typePoint:   "TickBars",
+		threshold:   func(t *barThresholds) float64 { return t.Ticks },
+		size:        func(b *bar) float64 { return b.ticks },
+	},
+	{
+		measurement: "volume_bars",
+		typePoint:   "VolumeBars",
+		threshold:   func(t *barThresholds) float64 { return t.Volume },
+		size:        func(b *bar) float64 { return b.quantity },
+	},
+	{
+		measurement: "dollar_bars",
+		typePoint:   "DollarBars",
+		threshold:   func(t *barThresholds) float64 { return t.Dollars },
+		size:        func(b *bar) float64 { return b.volume },
+	},
+	{
+		measurement: "imbalance_bars",
+		typePoint:   "ImbalanceBars",
+		threshold:   func(t *barThresholds) float64 { return t.Imbalance },
+		size:        func(b *bar) float64 { return math.Abs(b.imbalance) },
+	},
+}
+
+// computeBars aggregates the trades of each exchange into bars closing on
+// activity rather than time. Bars in progress are kept in memory, bars
+// therefore start with the first trade following the start.
+func computeBars() {
+
+	if conf.Metrics.Bars == nil {
+		return
+	}
+
+	f, err := time.ParseDuration(conf.Metrics.Bars.Frequency)
+	if err != nil {
+		logger.WithField("error", err).Fatal("computeBars: time.ParseDuration")
+	}
+
+	for exchange, dataSource := range conf.Metrics.Sources {
+
+		ind := &indicator{
+			period:     f,
+			dataSource: dataSource,
+			exchange:   exchange,
+		}
+
+		state := &barsState{markets: make(map[string]*marketBars)}
+
+		go networking.RunEvery(f, func(nextRun int64) {
+
+			ind.nextRun = nextRun
+
+			// trades are processed once the ingestion lag has elapsed
+			end := nextRun - int64(dataSource.UpdateLag)
+			if state.checkedUntil == 0 {
+				state.checkedUntil = end
+				return
+			}
+
+			mtrades := getBarTrades(ind, state.checkedUntil, end)
+			if mtrades == nil {
+				return
+			}
+			state.checkedUntil = end
+
+			prepareBarsPoints(ind, state.updateBars(mtrades))
+		})
+	}
+}
+
+func getBarTrades(ind *indicator, start, end int64) map[string][]*barTrade {
+
+	query := fmt.Sprintf(
+		`SELECT rate, quantity, total
+    FROM %s
+    WHERE time >= %d AND time < %d
+    GROUP BY market`,
+		ind.dataSource.Schema["trades_measurement"],
+		start, end)
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, ind.dataSource.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   ind.period,
+		ErrorMsg: "getBarTrades: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil
+	}
+
+	mtrades := make(map[string][]*barTrade, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+		trades := make([]*barTrade, 0, len(serie.Values))
+
+		for _, tradeRec := range serie.Values {
+
+			if tradeRec[1] == nil || tradeRec[2] == nil || tradeRec[3] == nil {
+				continue
+			}
+
+			timestamp, err := networking.ConvertJsonValueToTime(tradeRec[0])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"exchange": ind.exchange,
+					"market":   market,
+				}).Error("getBarTrades: networking.ConvertJsonValueToTime")
+				continue
+			}
+
+			rate, err := networking.ConvertJsonValueToFloat64(tradeRec[1])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"exchange": ind.exchange,
+					"market":   market,
+				}).Error("getBarTrades: networking.ConvertJsonValueToFloat64")
+				continue
+			}
+
+			quantity, err := networking.ConvertJsonValueToFloat64(tradeRec[2])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"exchange": ind.exchange,
+					"market":   market,
+				}).Error("getBarTrades: networking.ConvertJsonValueToFloat64")
+				continue
+			}
+
+			total, err := networking.ConvertJsonValueToFloat64(tradeRec[3])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"exchange": ind.exchange,
+					"market":   market,
+				}).Error("getBarTrades: networking.ConvertJsonValueToFloat64")
+				continue
+			}
+
+			trades = append(trades,
+				&barTrade{timestamp.UnixNano(), rate, quantity, total})
+		}
+
+		mtrades[market] = trades
+	}
+
+	return mtrades
+}
+
+// updateBars adds the trades (ordered by time) to the bars in progress and
+// returns the bars closed by kind and market.
+func (s *barsState) updateBars(
+	mtrades map[string][]*barTrade) map[*barKind]map[string][]*bar {
+
+	closed := make(map[*barKind]map[string][]*bar, len(barKinds))
+	for _, kind := range barKinds {
+		closed[kind] = make(map[string][]*bar)
+	}
+
+	for market, trades := range mtrades {
+
+		thresholds := getBarThresholds(market)
+		if thresholds == nil {
+			continue
+		}
+
+		mb, ok := s.markets[market]
+		if !ok {
+			mb = &marketBars{bars: make(map[string]*bar, len(barKinds))}
+			s.markets[market] = mb
+		}
+
+		for _, trade := range trades {
+
+			// tick rule: sign of the last price change
+			if mb.lastRate != 0.0 && trade.rate > mb.lastRate {
+				mb.lastSign = 1.0
+			} else if mb.lastRate != 0.0 && trade.rate < mb.lastRate {
+				mb.lastSign = -1.0
+			}
+			mb.lastRate = trade.rate
+
+			for _, kind := range barKinds {
+
+				threshold := kind.threshold(thresholds)
+				if threshold <= 0.0 {
+					continue
+				}
+
+				b, ok := mb.bars[kind.measurement]
+				if !ok {
+					b = &bar{
+						ohlc: ohlc{
+							open: trade.rate,
+							high: trade.rate,
+							low:  trade.rate,
+						},
+						start: trade.timestamp,
+					}
+					mb.bars[kind.measurement] = b
+				}
+
+				b.volume += trade.total
+				b.quantity += trade.quantity
+				b.high = math.Max(b.high, trade.rate)
+				b.low = math.Min(b.low, trade.rate)
+				b.close = trade.rate
+				b.ticks++
+				b.imbalance += mb.lastSign
+
+				if kind.size(b) >= threshold {
+					b.setDerivedFields()
+					closed[kind][market] = append(closed[kind][market], b)
+					delete(mb.bars, kind.measurement)
+				}
+			}
+		}
+	}
+
+	return closed
+}
+
+func getBarThresholds(market string) *barThresholds {
+
+	if thresholds, ok := conf.Metrics.Bars.Markets[market]; ok {
+		return thresholds
+	}
+
+	return conf.Metrics.Bars.Default
+}
+
+func prepareBarsPoints(ind *indicator,
+	closed map[*barKind]map[string][]*bar) {
+
+	for kind, mbars := range closed {
+
+		points := make([]*ifxClient.Point, 0)
+
+		var start, end int64
+		for _, bars := range mbars {
+			for _, b := range bars {
+				if start == 0 || b.start < start {
+					start = b.start
+				}
+				if b.start+1 > end {
+					end = b.start + 1
+				}
+			}
+		}
+		rates := getUSDRates(start, end)
+
+		for market, bars := range mbars {
+
+			tags := map[string]string{
+				"market":   market,
+				"exchange": ind.exchange,
+			}
+
+			for _, b := range bars {
+
+				fields := map[string]interface{}{
+					"volume":           b.volume,
+					"quantity":         b.quantity,
+					"weighted_average": b.weightedAverage,
+					"open":             b.open,
+					"high":             b.high,
+					"low":              b.low,
+					"close":            b.close,
+					"change":           b.change,
+					"change_percent":   b.changePercent,
+				}
+
+				if volumeUSD, ok := rates.usd(ind.exchange, market, b.volume,
+					b.start); ok {
+					fields["volume_usd"] = volumeUSD
+				}
+
+				pt, err := ifxClient.NewPoint(kind.measurement, tags, fields,
+					time.Unix(0, b.start))
+				if err != nil {
+					logger.WithField("error", err).Error(
+						"prepareBarsPoints: ifxClient.NewPoint")
+					continue
+				}
+				points = append(points, pt)
+			}
+		}
+
+		sendBatchPoints(ind, kind.typePoint, points)
+	}
+}
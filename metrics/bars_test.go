@@ -0,0 +1,96 @@
+package metrics
+
+import "testing"
+
+// trades of 1s apart from testStart
+func newTestBarTrades(rates, quantities []float64) []*barTrade {
+
+	trades := make([]*barTrade, len(rates))
+
+	for i := range rates {
+		trades[i] = &barTrade{
+			timestamp: testStart + int64(i)*1e9,
+			rate:      rates[i],
+			quantity:  quantities[i],
+			total:     rates[i] * quantities[i],
+		}
+	}
+
+	return trades
+}
+
+func getBarKind(measurement string) *barKind {
+
+	for _, kind := range barKinds {
+		if kind.measurement == measurement {
+			return kind
+		}
+	}
+
+	return nil
+}
+
+func TestUpdateBars(t *testing.T) {
+
+	defer func(b *barsConf) { conf.Metrics.Bars = b }(conf.Metrics.Bars)
+	conf.Metrics.Bars = &barsConf{
+		Default: &barThresholds{Ticks: 3, Dollars: 25, Imbalance: 2},
+		Markets: map[string]*barThresholds{"BTC_XMR": {Ticks: 1}},
+	}
+
+	trades := newTestBarTrades(
+		[]float64{10, 11, 10.5, 12, 13}, []float64{1, 1, 2, 1, 1})
+
+	type wantBar struct {
+		start                         int64
+		open, high, low, close, ticks float64
+	}
+
+	// the tick rule signs the trades 0, +1, -1, +1, +1
+	want := map[string][]wantBar{
+		"tick_bars": {{testStart, 10, 11, 10, 10.5, 3}},
+		"dollar_bars": {
+			{testStart, 10, 11, 10, 10.5, 3},
+			{testStart + 3e9, 12, 13, 12, 13, 2},
+		},
+		"imbalance_bars": {{testStart, 10, 13, 10, 13, 5}},
+	}
+
+	// bars in progress carry over from a run to the next
+	for split := 0; split <= len(trades); split++ {
+
+		s := &barsState{markets: make(map[string]*marketBars)}
+
+		closed := s.updateBars(map[string][]*barTrade{
+			"BTC_ETH": trades[:split],
+			"BTC_XMR": trades[:1],
+		})
+		next := s.updateBars(map[string][]*barTrade{"BTC_ETH": trades[split:]})
+
+		for _, kind := range barKinds {
+
+			got := append(closed[kind]["BTC_ETH"], next[kind]["BTC_ETH"]...)
+
+			if len(got) != len(want[kind.measurement]) {
+				t.Errorf("split %d: %s: got %d bars, want %d", split,
+					kind.measurement, len(got), len(want[kind.measurement]))
+				continue
+			}
+
+			for i, w := range want[kind.measurement] {
+				b := got[i]
+				if b.start != w.start || b.open != w.open || b.high != w.high ||
+					b.low != w.low || b.close != w.close || b.ticks != w.ticks {
+					t.Errorf("split %d: %s %d: got %+v, want %+v", split,
+						kind.measurement, i, b, w)
+				}
+			}
+		}
+
+		tickBars := closed[getBarKind("tick_bars")]["BTC_XMR"]
+		dollarBars := closed[getBarKind("dollar_bars")]["BTC_XMR"]
+		if len(tickBars) != 1 || len(dollarBars) != 0 {
+			t.Errorf("split %d: market thresholds not applied", split)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package metrics
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+)
+
+// bookHeatmapConf aggregates the books into buckets of step_percent from the
+// mid up to range_percent on each side. Orders resting wall_ratio times the
+// average size of the levels in range are tracked as walls.
+type bookHeatmapConf struct {
+	RangePercent float64 `json:"range_percent"`
+	StepPercent  float64 `json:"step_percent"`
+	WallRatio    float64 `json:"wall_ratio"`
+}
+
+type bookHeatmap struct {
+	bids []float64
+	asks []float64
+}
+
+type wall struct {
+	side string
+	rate float64
+	size float64
+}
+
+// bookWalls keeps the walls of the last book of each market of an exchange.
+type bookWalls struct {
+	walls map[string]map[string]*wall
+}
+
+func newBookWalls() *bookWalls {
+
+	return &bookWalls{walls: make(map[string]map[string]*wall)}
+}
+
+// getBookHeatmaps returns the resting size (base currency) of each bucket,
+// bucket i covering [i*step, (i+1)*step) percent from the mid.
+func getBookHeatmaps(obs orderBooks) map[string]*bookHeatmap {
+
+	hc := conf.Metrics.BookHeatmap
+	buckets := int(math.Ceil(hc.RangePercent / hc.StepPercent))
+	mbh := make(map[string]*bookHeatmap, len(obs))
+
+	for market, ob := range obs {
+
+		if len(ob.bids) == 0 || len(ob.asks) == 0 {
+			continue
+		}
+
+		mid := (ob.bids[0].rate + ob.asks[0].rate) / 2
+		bh := &bookHeatmap{
+			bids: make([]float64, buckets),
+			asks: make([]float64, buckets),
+		}
+
+		for _, bid := range ob.bids {
+
+			i := int((mid - bid.rate) / mid * 100 / hc.StepPercent)
+			if i < 0 {
+				continue
+			}
+			if i >= buckets {
+				break
+			}
+			bh.bids[i] += bid.rate * bid.quantity
+		}
+
+		for _, ask := range ob.asks {
+
+			i := int((ask.rate - mid) / mid * 100 / hc.StepPercent)
+			if i < 0 {
+				continue
+			}
+			if i >= buckets {
+				break
+			}
+			bh.asks[i] += ask.rate * ask.quantity
+		}
+
+		mbh[market] = bh
+	}
+
+	return mbh
+}
+
+func prepareBookHeatmapsPoints(ind *indicator, obs orderBooks) {
+
+	measurement, ok := conf.Metrics.Schema["book_heatmaps_measurement"]
+	if !ok || conf.Metrics.BookHeatmap == nil {
+		return
+	}
+
+	timestamp := time.Unix(0, ind.nextRun)
+	points := make([]*ifxClient.Point, 0, len(obs))
+
+	for market, bh := range getBookHeatmaps(obs) {
+
+		tags := map[string]string{
+			"market":   market,
+			"exchange": ind.exchange,
+		}
+
+		fields := make(map[string]interface{}, len(bh.bids)+len(bh.asks))
+		for i := range bh.bids {
+			fields["bid_"+strconv.Itoa(i)] = bh.bids[i]
+			fields["ask_"+strconv.Itoa(i)] = bh.asks[i]
+		}
+
+		pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareBookHeatmapsPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	sendBatchPoints(ind, "BookHeatmaps", points)
+}
+
+// getWalls returns the walls of the book by side and rate.
+func getWalls(ob *orderBook) map[string]*wall {
+
+	hc := conf.Metrics.BookHeatmap
+	mid := (ob.bids[0].rate + ob.asks[0].rate) / 2
+	walls := make(map[string]*wall)
+
+	find := func(side string, orders []*order) {
+
+		inRange := make([]*order, 0)
+		sum := 0.0
+
+		for _, o := range orders {
+
+			if math.Abs(o.rate-mid)/mid*100 >= hc.RangePercent {
+				break
+			}
+			inRange = append(inRange, o)
+			sum += o.rate * o.quantity
+		}
+
+		if len(inRange) == 0 {
+			return
+		}
+		average := sum / float64(len(inRange))
+
+		for _, o := range inRange {
+
+			size := o.rate * o.quantity
+			if size >= average*hc.WallRatio {
+				key := side + strconv.FormatFloat(o.rate, 'f', -1, 64)
+				walls[key] = &wall{side, o.rate, size}
+			}
+		}
+	}
+
+	find("bid", ob.bids)
+	find("ask", ob.asks)
+
+	return walls
+}
+
+// update compares the walls of the books with the previous ones and writes
+// the walls appearing, pulled (still on the book side) or filled (the price
+// went through).
+func (bw *bookWalls) update(ind *indicator, obs orderBooks) {
+
+	measurement, ok := conf.Metrics.Schema["book_walls_measurement"]
+	if !ok || conf.Metrics.BookHeatmap == nil ||
+		conf.Metrics.BookHeatmap.WallRatio <= 0.0 {
+		return
+	}
+
+	points := make([]*ifxClient.Point, 0)
+
+	// events of a run are written one nanosecond apart not to overwrite
+	// each other
+	addPoint := func(market, event string, w *wall, mid float64) {
+
+		tags := map[string]string{
+			"market":   market,
+			"exchange": ind.exchange,
+			"side":     w.side,
+			"event":    event,
+		}
+
+		fields := map[string]interface{}{
+			"rate":         w.rate,
+			"size":         w.size,
+			"distance_bps": math.Abs(w.rate-mid) / mid * 10000,
+		}
+
+		timestamp := time.Unix(0, ind.nextRun+int64(len(points)))
+
+		pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"bookWalls.update: ifxClient.NewPoint")
+			return
+		}
+		points = append(points, pt)
+	}
+
+	for market, ob := range obs {
+
+		if len(ob.bids) == 0 || len(ob.asks) == 0 {
+			continue
+		}
+
+		mid := (ob.bids[0].rate + ob.asks[0].rate) / 2
+		walls := getWalls(ob)
+		previous, known := bw.walls[market]
+
+		// walls of the first book are not reported as appearing
+		if known {
+
+			for key, w := range walls {
+				if _, ok := previous[key]; !ok {
+					addPoint(market, "appeared", w, mid)
+				}
+			}
+
+			for key, w := range previous {
+
+				if _, ok := walls[key]; ok {
+					continue
+				}
+
+				// walls still resting with half their size are kept
+				if restingOrder(ob, w) {
+					walls[key] = w
+					continue
+				}
+
+				filled := (w.side == "bid" && w.rate >= ob.bids[0].rate) ||
+					(w.side == "ask" && w.rate <= ob.asks[0].rate)
+
+				if filled {
+					addPoint(market, "filled", w, mid)
+				} else {
+					addPoint(market, "pulled", w, mid)
+				}
+			}
+		}
+
+		bw.walls[market] = walls
+	}
+
+	sendBatchPoints(ind, "BookWalls", points)
+}
+
+func restingOrder(ob *orderBook, w *wall) bool {
+
+	orders := ob.bids
+	if w.side == "ask" {
+		orders = ob.asks
+	}
+
+	for _, o := range orders {
+		if o.rate == w.rate {
+			return o.rate*o.quantity >= w.size/2
+		}
+	}
+
+	return false
+}
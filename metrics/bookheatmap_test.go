@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+var testHeatmapBook = &orderBook{
+	bids: []*order{
+		{rate: 99.5, quantity: 1},
+		{rate: 98.8, quantity: 2},
+		{rate: 97.5, quantity: 3},
+	},
+	asks: []*order{
+		{rate: 100.5, quantity: 1},
+		{rate: 100.6, quantity: 2},
+		{rate: 101.5, quantity: 1},
+		{rate: 103, quantity: 1},
+	},
+}
+
+func TestGetBookHeatmaps(t *testing.T) {
+
+	defer func(b *bookHeatmapConf) {
+		conf.Metrics.BookHeatmap = b
+	}(conf.Metrics.BookHeatmap)
+	conf.Metrics.BookHeatmap = &bookHeatmapConf{
+		RangePercent: 2,
+		StepPercent:  1,
+	}
+
+	mbh := getBookHeatmaps(orderBooks{
+		"BTC_ETH": testHeatmapBook,
+		"BTC_XMR": {bids: testHeatmapBook.bids},
+	})
+
+	// buckets of 1% from the mid (100), orders beyond 2% left out
+	want := &bookHeatmap{
+		bids: []float64{99.5, 197.6},
+		asks: []float64{301.7, 101.5},
+	}
+
+	got := mbh["BTC_ETH"]
+	if len(mbh) != 1 || got == nil || len(got.bids) != 2 ||
+		len(got.asks) != 2 {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for i := range want.bids {
+		if !approxEqual(got.bids[i], want.bids[i]) ||
+			!approxEqual(got.asks[i], want.asks[i]) {
+			t.Errorf("bucket %d: got %+v, want %+v", i, got, want)
+		}
+	}
+}
+
+func TestBookWallsUpdate(t *testing.T) {
+
+	defer func(b *bookHeatmapConf) {
+		conf.Metrics.BookHeatmap = b
+	}(conf.Metrics.BookHeatmap)
+	conf.Metrics.BookHeatmap = &bookHeatmapConf{
+		RangePercent: 2,
+		StepPercent:  1,
+		WallRatio:    1.2,
+	}
+
+	conf.Metrics.Schema["book_walls_measurement"] = "book_walls"
+	defer delete(conf.Metrics.Schema, "book_walls_measurement")
+
+	ind := newTestIndicator(time.Minute, 0)
+	bw := newBookWalls()
+
+	// walls of the first book (bid 98.8 and ask 100.6) are not reported
+	bw.update(ind, orderBooks{"BTC_ETH": testHeatmapBook})
+
+	select {
+	case bp := <-batchsToWrite:
+		t.Errorf("first book: got %d events, want none", len(bp.Points))
+	default:
+	}
+
+	// the bids went through 98.8 and the ask wall was mostly pulled
+	bw.update(ind, orderBooks{"BTC_ETH": {
+		bids: []*order{{rate: 98.7, quantity: 1}, {rate: 98, quantity: 1}},
+		asks: []*order{
+			{rate: 99.5, quantity: 1},
+			{rate: 100.6, quantity: 0.5},
+			{rate: 101.5, quantity: 1},
+		},
+	}})
+
+	want := map[string]string{
+		"appeared": "ask", // 99.5
+		"filled":   "bid", // 98.8
+		"pulled":   "ask", // 100.6
+	}
+
+	select {
+	case bp := <-batchsToWrite:
+
+		if len(bp.Points) != len(want) {
+			t.Errorf("got %d events, want %d", len(bp.Points), len(want))
+		}
+
+		for _, pt := range bp.Points {
+			tags := pt.Tags()
+			if side, ok := want[tags["event"]]; !ok || side != tags["side"] {
+				t.Errorf("unexpected event: %v", tags)
+			}
+		}
+
+	default:
+		t.Errorf("got no events, want %d", len(want))
+	}
+}
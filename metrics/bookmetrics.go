@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"time"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+)
+
+type bookMetrics struct {
+	bestBid         float64
+	bestAsk         float64
+	bestBidQuantity float64
+	bestAskQuantity float64
+	spread          float64
+	spreadBps       float64
+	mid             float64
+	microprice      float64
+	bidLevels       int
+	askLevels       int
+}
+
+// getBookMetrics returns the top of book metrics of each order book (bids
+// and asks best first). The microprice weights each side by the quantity of
+// the opposite side.
+func getBookMetrics(obs orderBooks) map[string]*bookMetrics {
+
+	mbm := make(map[string]*bookMetrics, len(obs))
+
+	for market, ob := range obs {
+
+		if len(ob.bids) == 0 || len(ob.asks) == 0 {
+			continue
+		}
+
+		bid, ask := ob.bids[0], ob.asks[0]
+
+		bm := &bookMetrics{
+			bestBid:         bid.rate,
+			bestAsk:         ask.rate,
+			bestBidQuantity: bid.quantity,
+			bestAskQuantity: ask.quantity,
+			spread:          ask.rate - bid.rate,
+			mid:             (bid.rate + ask.rate) / 2,
+			bidLevels:       len(ob.bids),
+			askLevels:       len(ob.asks),
+		}
+
+		if bm.mid != 0.0 {
+			bm.spreadBps = bm.spread / bm.mid * 10000
+		}
+
+		bm.microprice = bm.mid
+		if quantity := bid.quantity + ask.quantity; quantity != 0.0 {
+			bm.microprice = (bid.rate*ask.quantity + ask.rate*bid.quantity) /
+				quantity
+		}
+
+		mbm[market] = bm
+	}
+
+	return mbm
+}
+
+func prepareBookMetricsPoints(ind *indicator, mbm map[string]*bookMetrics) {
+
+	measurement, ok := conf.Metrics.Schema["book_metrics_measurement"]
+	if !ok {
+		return
+	}
+
+	timestamp := time.Unix(0, ind.nextRun)
+	points := make([]*ifxClient.Point, 0, len(mbm))
+
+	for market, bm := range mbm {
+
+		tags := map[string]string{
+			"market":   market,
+			"exchange": ind.exchange,
+		}
+
+		fields := map[string]interface{}{
+			"best_bid":          bm.bestBid,
+			"best_ask":          bm.bestAsk,
+			"best_bid_quantity": bm.bestBidQuantity,
+			"best_ask_quantity": bm.bestAskQuantity,
+			"spread":            bm.spread,
+			"spread_bps":        bm.spreadBps,
+			"mid":               bm.mid,
+			"microprice":        bm.microprice,
+			"bid_levels":        bm.bidLevels,
+			"ask_levels":        bm.askLevels,
+		}
+
+		pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareBookMetricsPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	sendBatchPoints(ind, "BookMetrics", points)
+}
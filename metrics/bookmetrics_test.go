@@ -0,0 +1,67 @@
+package metrics
+
+import "testing"
+
+func TestGetBookMetrics(t *testing.T) {
+
+	obs := orderBooks{
+		"BTC_ETH": {
+			bids: []*order{{rate: 10, quantity: 2}, {rate: 9, quantity: 5}},
+			asks: []*order{{rate: 11, quantity: 1}},
+		},
+		"BTC_XMR": {
+			bids: []*order{{rate: 1, quantity: 0}},
+			asks: []*order{{rate: 1.02, quantity: 0}},
+		},
+		"BTC_LTC": {
+			bids: []*order{{rate: 1, quantity: 1}},
+		},
+	}
+
+	want := map[string]*bookMetrics{
+		// microprice weighting the bid by the ask quantity
+		"BTC_ETH": {
+			bestBid:         10,
+			bestAsk:         11,
+			bestBidQuantity: 2,
+			bestAskQuantity: 1,
+			spread:          1,
+			spreadBps:       10000 / 10.5,
+			mid:             10.5,
+			microprice:      32.0 / 3,
+			bidLevels:       2,
+			askLevels:       1,
+		},
+		"BTC_XMR": {
+			bestBid:    1,
+			bestAsk:    1.02,
+			spread:     0.02,
+			spreadBps:  200 / 1.01,
+			mid:        1.01,
+			microprice: 1.01,
+			bidLevels:  1,
+			askLevels:  1,
+		},
+	}
+
+	got := getBookMetrics(obs)
+
+	if len(got) != len(want) {
+		t.Errorf("got %d markets, want %d", len(got), len(want))
+	}
+
+	for market, w := range want {
+
+		g := got[market]
+		if g == nil || g.bestBid != w.bestBid || g.bestAsk != w.bestAsk ||
+			g.bestBidQuantity != w.bestBidQuantity ||
+			g.bestAskQuantity != w.bestAskQuantity ||
+			!approxEqual(g.spread, w.spread) ||
+			!approxEqual(g.spreadBps, w.spreadBps) ||
+			!approxEqual(g.mid, w.mid) ||
+			!approxEqual(g.microprice, w.microprice) ||
+			g.bidLevels != w.bidLevels || g.askLevels != w.askLevels {
+			t.Errorf("%s: got %+v, want %+v", market, g, w)
+		}
+	}
+}
@@ -17,7 +17,10 @@ type periodsCachedMetrics map[time.Duration]*marketsCachedMetrics
 type marketsCachedMetrics struct {
 	sync.RWMutex
 	lastImohlc map[int64]map[string]*ohlc
-	lastImma   map[int64]map[string]*ma
+	lastImma   map[string]map[int64]map[string]*ma
+	lastImobv  map[string]map[int64]map[string]*obv
+	lastFields map[string]map[int64]map[string]indicatorFields
+	lastSeries map[string]map[int64]map[string]*ohlc
 }
 
 func initCachedMetrics() {
@@ -65,7 +68,7 @@ func getCachedLastMA(ind *indicator) map[int64]map[string]*ma {
 	cm[ind.exchange][ind.period].RLock()
 	defer cm[ind.exchange][ind.period].RUnlock()
 
-	return cm[ind.exchange][ind.period].lastImma
+	return cm[ind.exchange][ind.period].lastImma[ind.series]
 }
 
 func setCacheLastMA(ind *indicator, imma map[int64]map[string]*ma) {
@@ -73,21 +76,164 @@ func setCacheLastMA(ind *indicator, imma map[int64]map[string]*ma) {
 	cm[ind.exchange][ind.period].Lock()
 	defer cm[ind.exchange][ind.period].Unlock()
 
-	cm[ind.exchange][ind.period].lastImma = imma
+	if cm[ind.exchange][ind.period].lastImma == nil {
+		cm[ind.exchange][ind.period].lastImma =
+			make(map[string]map[int64]map[string]*ma)
+	}
+
+	cm[ind.exchange][ind.period].lastImma[ind.series] = imma
+}
+
+func getCachedLastOBV(ind *indicator) map[int64]map[string]*obv {
+
+	cm[ind.exchange][ind.period].RLock()
+	defer cm[ind.exchange][ind.period].RUnlock()
+
+	return cm[ind.exchange][ind.period].lastImobv[ind.series]
+}
+
+func updateCacheLastOBV(ind *indicator, imobv map[int64]map[string]*obv) {
+
+	if imobv == nil {
+		return
+	}
+
+	cm[ind.exchange][ind.period].Lock()
+	defer cm[ind.exchange][ind.period].Unlock()
+
+	if cm[ind.exchange][ind.period].lastImobv == nil {
+		cm[ind.exchange][ind.period].lastImobv =
+			make(map[string]map[int64]map[string]*obv)
+	}
+
+	cachedImobv := cm[ind.exchange][ind.period].lastImobv[ind.series]
+	if cachedImobv == nil {
+		cachedImobv = make(map[int64]map[string]*obv, len(imobv))
+	}
+
+	for interval, mobv := range imobv {
+		cachedImobv[interval] = mobv
+	}
+
+	// keeping the values preceding the first time interval to seed next runs
+	oldest := ind.timeIntervals[0] - int64(ind.period)
+	for interval := range cachedImobv {
+		if interval < oldest {
+			delete(cachedImobv, interval)
+		}
+	}
+
+	cm[ind.exchange][ind.period].lastImobv[ind.series] = cachedImobv
+}
+
+func getCachedLastFields(ind *indicator) map[int64]map[string]indicatorFields {
+
+	cm[ind.exchange][ind.period].RLock()
+	defer cm[ind.exchange][ind.period].RUnlock()
+
+	return cm[ind.exchange][ind.period].lastFields[ind.destination]
+}
+
+func updateCacheLastFields(ind *indicator,
+	imfields map[int64]map[string]indicatorFields) {
+
+	if imfields == nil {
+		return
+	}
+
+	cm[ind.exchange][ind.period].Lock()
+	defer cm[ind.exchange][ind.period].Unlock()
+
+	if cm[ind.exchange][ind.period].lastFields == nil {
+		cm[ind.exchange][ind.period].lastFields =
+			make(map[string]map[int64]map[string]indicatorFields)
+	}
+
+	cachedImfields := cm[ind.exchange][ind.period].lastFields[ind.destination]
+	if cachedImfields == nil {
+		cachedImfields = make(map[int64]map[string]indicatorFields, len(imfields))
+	}
+
+	for interval, mfields := range imfields {
+		cachedImfields[interval] = mfields
+	}
+
+	// keeping the fields preceding the first time interval to seed next runs
+	oldest := ind.timeIntervals[0] - int64(ind.period)
+	for interval := range cachedImfields {
+		if interval < oldest {
+			delete(cachedImfields, interval)
+		}
+	}
+
+	cm[ind.exchange][ind.period].lastFields[ind.destination] = cachedImfields
 }
 
+// getCachedLastOHLC returns the cached ohlc of the series of the indicator
+// (raw ohlc if none).
 func getCachedLastOHLC(ind *indicator) map[int64]map[string]*ohlc {
 
 	cm[ind.exchange][ind.period].RLock()
 	defer cm[ind.exchange][ind.period].RUnlock()
 
+	if ind.series != "" {
+		return cm[ind.exchange][ind.period].lastSeries[ind.series]
+	}
+
 	return cm[ind.exchange][ind.period].lastImohlc
 }
 
+func getCachedLastSeries(ind *indicator,
+	series string) map[int64]map[string]*ohlc {
+
+	cm[ind.exchange][ind.period].RLock()
+	defer cm[ind.exchange][ind.period].RUnlock()
+
+	return cm[ind.exchange][ind.period].lastSeries[series]
+}
+
+// updateCacheLastSeries keeps the candles of series over the same window as
+// the cached ohlc.
+func updateCacheLastSeries(ind *indicator, series string,
+	imohlc map[int64]map[string]*ohlc) {
+
+	horizon := ind.cacheHorizon()
+
+	cm[ind.exchange][ind.period].Lock()
+	defer cm[ind.exchange][ind.period].Unlock()
+
+	if cm[ind.exchange][ind.period].lastSeries == nil {
+		cm[ind.exchange][ind.period].lastSeries =
+			make(map[string]map[int64]map[string]*ohlc)
+	}
+
+	cachedImohlc := cm[ind.exchange][ind.period].lastSeries[series]
+	if cachedImohlc == nil {
+		cachedImohlc = make(map[int64]map[string]*ohlc, len(imohlc))
+	}
+
+	for interval, mohlc := range imohlc {
+		cachedImohlc[interval] = mohlc
+	}
+
+	for interval := range cachedImohlc {
+		if interval < horizon {
+			delete(cachedImohlc, interval)
+		}
+	}
+
+	cm[ind.exchange][ind.period].lastSeries[series] = cachedImohlc
+}
+
 func updateCacheLastOHLC(ind *indicator, imohlc map[int64]map[string]*ohlc) {
 
 	cachedImohlc := getCachedLastOHLC(ind)
-	ind.computeTimeIntervals(conf.Metrics.LengthMax - 1)
+
+	// the cache keeps the same window whatever the recomputed buckets
+	dirtySince := ind.dirtySince
+	ind.dirtySince = 0
+	ind.computeTimeIntervals(conf.Metrics.CacheLength - 1)
+	ind.dirtySince = dirtySince
 
 	if len(cachedImohlc) > len(ind.timeIntervals) {
 		cachedImohlc = nil
@@ -131,11 +277,11 @@ func getLastOHLC(ind *indicator) map[int64]map[string]*ohlc {
 	query := fmt.Sprintf(
 		`SELECT volume, quantity, open, high, low, close
     FROM %s
-    WHERE time >= %d AND time < %d AND exchange = '%s'
+    WHERE time >= %d AND time < %d AND exchange = '%s'%s
     GROUP BY market`,
 		ind.destination,
 		ind.timeIntervals[0], ind.nextRun,
-		ind.exchange)
+		ind.exchange, ind.marketsCondition())
 
 	var res []ifxClient.Result
 
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+)
+
+func getCCI(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "cci")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeCCI(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeCCI: no result")
+	}
+
+	prepareFieldsPoints(ind, "CCI", imfields)
+
+	return ind, nil
+}
+
+// computeCCI computes the commodity channel index of the typical price
+// (high + low + close) / 3 using Lambert's 0.015 constant.
+func computeCCI(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	lengths := conf.Metrics.Oscillators.CCI.Lengths
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, _ := range imohlc[interval] {
+
+			fields := make(indicatorFields, len(lengths))
+
+			for _, length := range lengths {
+
+				window := getOHLCWindow(imohlc, ind.period, interval, market, length)
+				if window == nil {
+					continue
+				}
+
+				typicalPrices := make([]float64, length)
+				for i, ohlc := range window {
+					typicalPrices[i] = (ohlc.high + ohlc.low + ohlc.close) / 3
+				}
+
+				sma := average(typicalPrices)
+
+				meanDeviation := 0.0
+				for _, tp := range typicalPrices {
+					meanDeviation += math.Abs(tp - sma)
+				}
+				meanDeviation /= float64(length)
+
+				cciValue := 0.0
+				if meanDeviation != 0.0 {
+					cciValue = (typicalPrices[length-1] - sma) / (0.015 * meanDeviation)
+				}
+
+				fields[fmt.Sprintf("cci_%d", length)] = cciValue
+			}
+
+			imfields[interval][market] = fields
+		}
+	}
+
+	return imfields
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeCCI(t *testing.T) {
+
+	defer func(o *oscillatorsConf) { conf.Metrics.Oscillators = o }(
+		conf.Metrics.Oscillators)
+
+	tests := []struct {
+		name    string
+		lengths []int
+		candles []*ohlc
+		want    indicatorFields
+	}{
+		{
+			// typical prices 10, 11 and 32/3: (1/9) / (0.015 * 10/27)
+			name:    "typical price above average",
+			lengths: []int{3},
+			candles: testOscillatorCandles,
+			want:    indicatorFields{"cci_3": 20},
+		},
+		{
+			name:    "no deviation",
+			lengths: []int{2},
+			candles: []*ohlc{newTestOHLC(5, 6, 4, 5, 1), newTestOHLC(5, 6, 4, 5, 1)},
+			want:    indicatorFields{"cci_2": 0},
+		},
+		{
+			name:    "window longer than the candles",
+			lengths: []int{5},
+			candles: testOscillatorCandles,
+			want:    indicatorFields{},
+		},
+	}
+
+	for _, tt := range tests {
+
+		conf.Metrics.Oscillators = &oscillatorsConf{CCI: &lengthsConf{tt.lengths}}
+
+		ind := newTestIndicator(time.Minute, 1)
+		setTestOHLC(ind.period, len(tt.candles)-1, "BTC_ETH", tt.candles)
+
+		got := computeCCI(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
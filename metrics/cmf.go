@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"fmt"
+)
+
+func getCMF(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "cmf")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeCMF(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeCMF: no result")
+	}
+
+	prepareFieldsPoints(ind, "CMF", imfields)
+
+	return ind, nil
+}
+
+// computeCMF computes the Chaikin money flow, the volume weighted average of
+// the close location within each period range.
+func computeCMF(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	lengths := conf.Metrics.Volume.CMFLengths
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, _ := range imohlc[interval] {
+
+			fields := make(indicatorFields, len(lengths))
+
+			for _, length := range lengths {
+
+				window := getOHLCWindow(imohlc, ind.period, interval, market, length)
+				if window == nil {
+					continue
+				}
+
+				moneyFlowVolume, volume := 0.0, 0.0
+
+				for _, ohlc := range window {
+
+					if ohlc.high != ohlc.low {
+						multiplier := ((ohlc.close - ohlc.low) - (ohlc.high - ohlc.close)) /
+							(ohlc.high - ohlc.low)
+						moneyFlowVolume += multiplier * ohlc.volume
+					}
+					volume += ohlc.volume
+				}
+
+				cmf := 0.0
+				if volume != 0.0 {
+					cmf = moneyFlowVolume / volume
+				}
+
+				fields[fmt.Sprintf("cmf_%d", length)] = cmf
+			}
+
+			imfields[interval][market] = fields
+		}
+	}
+
+	return imfields
+}
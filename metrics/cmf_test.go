@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeCMF(t *testing.T) {
+
+	defer func(v *volumeConf) { conf.Metrics.Volume = v }(conf.Metrics.Volume)
+
+	candles := []*ohlc{
+		newTestOHLC(10, 10, 10, 10, 50), // flat range, volume only
+		newTestOHLC(10, 12, 10, 11, 10), // close mid range
+		newTestOHLC(11, 13, 9, 10, 30),  // close location -0.5
+	}
+
+	tests := []struct {
+		name    string
+		lengths []int
+		want    indicatorFields
+	}{
+		{"single period", []int{1}, indicatorFields{"cmf_1": -0.5}},
+		{"two periods", []int{2}, indicatorFields{"cmf_2": -15.0 / 40}},
+		{"flat range", []int{3}, indicatorFields{"cmf_3": -15.0 / 90}},
+		{"window longer than the candles", []int{4}, indicatorFields{}},
+	}
+
+	for _, tt := range tests {
+
+		conf.Metrics.Volume = &volumeConf{CMFLengths: tt.lengths}
+
+		ind := newTestIndicator(time.Minute, 1)
+		setTestOHLC(ind.period, len(candles)-1, "BTC_ETH", candles)
+
+		got := computeCMF(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+	"trading/metrics"
+)
+
+func main() {
+
+	exchange := flag.String("exchange", "", "exchange to backfill")
+	markets := flag.String("markets", "", "comma separated markets (all if empty)")
+	from := flag.String("from", "", "start of the range (RFC3339)")
+	to := flag.String("to", "", "end of the range (RFC3339, now if empty)")
+	parallelism := flag.Int("parallelism", 4, "concurrent queries")
+	checkpoint := flag.String("checkpoint", "", "checkpoint file to resume from")
+	marketDepths := flag.Bool("market_depths", false, "backfill market depths")
+	flag.Parse()
+
+	opts := &metrics.BackfillOptions{
+		Exchange:       *exchange,
+		Parallelism:    *parallelism,
+		CheckpointPath: *checkpoint,
+		MarketDepths:   *marketDepths,
+		To:             time.Now(),
+	}
+
+	if *markets != "" {
+		opts.Markets = strings.Split(*markets, ",")
+	}
+
+	var err error
+
+	if opts.From, err = time.Parse(time.RFC3339, *from); err != nil {
+		log.Fatalf("invalid from: %v", err)
+	}
+
+	if *to != "" {
+		if opts.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			log.Fatalf("invalid to: %v", err)
+		}
+	}
+
+	if err := metrics.Backfill(opts); err != nil {
+		log.Fatalf("metrics.Backfill: %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"trading/metrics"
+	"trading/signals"
+)
+
+func main() {
+
+	signals.Run()
+	metrics.ComputeMetrics()
+
+	select {}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"trading/ingestion/bittrex"
+	"trading/ingestion/poloniex"
+	"trading/metrics"
+)
+
+func main() {
+
+	go poloniex.Ingest()
+	go bittrex.Ingest()
+
+	metrics.ComputeMetrics()
+
+	select {}
+}
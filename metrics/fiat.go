@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+	"trading/networking/symbols"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// fiatValuationConf values volumes and depths in USD from the price_usd of
+// the coinmarketcap ticks (source coinmarketcap) or from the price index
+// quoted in USD (source price_index). A rate is used up to max_age after
+// its timestamp, rates are kept in memory over history.
+type fiatValuationConf struct {
+	Source  string            `json:"source"`
+	Schema  map[string]string `json:"schema"`
+	MaxAge  string            `json:"max_age"`
+	History string            `json:"history"`
+	maxAge  time.Duration
+	history time.Duration
+}
+
+type timedRate struct {
+	timestamp int64
+	rate      float64
+}
+
+// fiatRates keeps the USD rates of each canonical currency (oldest first)
+// fetched over [from, to).
+type fiatRates struct {
+	sync.Mutex
+	rates map[string][]*timedRate
+	from  int64
+	to    int64
+}
+
+var usdRates = &fiatRates{rates: make(map[string][]*timedRate)}
+
+func initFiatValuation() {
+
+	fc := conf.Metrics.FiatValuation
+	if fc == nil {
+		return
+	}
+
+	if fc.Source != "coinmarketcap" && fc.Source != "price_index" {
+		logger.WithField("source", fc.Source).Fatal(
+			"initFiatValuation: unknown source")
+	}
+
+	var err error
+
+	if fc.maxAge, err = time.ParseDuration(fc.MaxAge); err != nil {
+		logger.WithField("error", err).Fatal(
+			"initFiatValuation: time.ParseDuration")
+	}
+
+	if fc.history, err = time.ParseDuration(fc.History); err != nil {
+		logger.WithField("error", err).Fatal(
+			"initFiatValuation: time.ParseDuration")
+	}
+}
+
+// getUSDRates makes the rates of [start, end) available, returning nil if
+// the valuation is disabled or the rates could not be fetched. The live rates
+// are cached over history, rates already fetched being queried again over
+// max_age as ticks are written late. Ranges preceding the cache (backfills)
+// are queried without being cached.
+func getUSDRates(start, end int64) *fiatRates {
+
+	fc := conf.Metrics.FiatValuation
+	if fc == nil || start >= end {
+		return nil
+	}
+
+	start -= int64(fc.maxAge)
+
+	usdRates.Lock()
+	cached := usdRates.to != 0
+	from, to := usdRates.from, usdRates.to
+	usdRates.Unlock()
+
+	if cached && start < from {
+
+		rates := queryUSDRates(start, end)
+		if rates == nil {
+			return nil
+		}
+
+		return &fiatRates{rates: rates, from: start, to: end}
+	}
+
+	queryStart := start
+
+	if cached && start <= to {
+
+		if end <= to-int64(fc.maxAge) {
+			return usdRates
+		}
+		queryStart = to - int64(fc.maxAge)
+	}
+
+	// queried without holding the cache, read by the other metrics
+	rates := queryUSDRates(queryStart, end)
+	if rates == nil {
+		return nil
+	}
+
+	usdRates.merge(rates, queryStart, end, end-int64(fc.history))
+
+	return usdRates
+}
+
+// merge replaces the cached rates of [start, end) by rates, the cache
+// starting at start if not contiguous and at oldest at most.
+func (fr *fiatRates) merge(rates map[string][]*timedRate,
+	start, end, oldest int64) {
+
+	fr.Lock()
+	defer fr.Unlock()
+
+	if fr.to == 0 || start > fr.to {
+		fr.from = start
+	}
+
+	if fr.from < oldest {
+		fr.from = oldest
+	}
+
+	if end > fr.to {
+		fr.to = end
+	}
+
+	keep := func(tr *timedRate) bool {
+		return tr.timestamp >= fr.from &&
+			(tr.timestamp < start || tr.timestamp >= end)
+	}
+
+	for currency, cached := range fr.rates {
+
+		kept := make([]*timedRate, 0, len(cached))
+		for _, tr := range cached {
+			if keep(tr) {
+				kept = append(kept, tr)
+			}
+		}
+		fr.rates[currency] = kept
+	}
+
+	for currency, newRates := range rates {
+
+		merged := fr.rates[currency]
+		for _, tr := range newRates {
+			if tr.timestamp >= fr.from {
+				merged = append(merged, tr)
+			}
+		}
+
+		sort.Slice(merged, func(i, j int) bool {
+			return merged[i].timestamp < merged[j].timestamp
+		})
+		fr.rates[currency] = merged
+	}
+}
+
+func queryUSDRates(start, end int64) map[string][]*timedRate {
+
+	fc := conf.Metrics.FiatValuation
+
+	var query, db, tag string
+
+	switch fc.Source {
+	case "coinmarketcap":
+		query = fmt.Sprintf(
+			`SELECT price_usd
+    FROM %s
+    WHERE time >= %d AND time < %d
+    GROUP BY symbol`,
+			fc.Schema["ticks_measurement"],
+			start, end)
+		db, tag = fc.Schema["database"], "symbol"
+
+	case "price_index":
+		query = fmt.Sprintf(
+			`SELECT price
+    FROM %s
+    WHERE time >= %d AND time < %d AND quote = 'USD'
+    GROUP BY asset`,
+			conf.Metrics.Schema["price_index_measurement"],
+			start, end)
+		db, tag = conf.Metrics.Schema["database"], "asset"
+	}
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(dbClient, query, db)
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   conf.Metrics.Frequency,
+		ErrorMsg: "queryUSDRates: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil
+	}
+
+	rates := make(map[string][]*timedRate, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		currency := serie.Tags[tag]
+		if fc.Source == "coinmarketcap" {
+			currency = symbols.Currency("coinmarketcap", currency)
+		}
+
+		for _, rateRec := range serie.Values {
+
+			if rateRec[1] == nil {
+				continue
+			}
+
+			timestamp, err := networking.ConvertJsonValueToTime(rateRec[0])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"currency": currency,
+				}).Error("queryUSDRates: networking.ConvertJsonValueToTime")
+				continue
+			}
+
+			rate, err := networking.ConvertJsonValueToFloat64(rateRec[1])
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"currency": currency,
+				}).Error("queryUSDRates: networking.ConvertJsonValueToFloat64")
+				continue
+			}
+
+			rates[currency] = append(rates[currency],
+				&timedRate{timestamp.UnixNano(), rate})
+		}
+	}
+
+	return rates
+}
+
+// usd returns amount, expressed in the price currency of market, in USD at
+// timestamp (false if no rate within max age).
+func (fr *fiatRates) usd(exchange, market string, amount float64,
+	timestamp int64) (float64, bool) {
+
+	if fr == nil {
+		return 0.0, false
+	}
+
+	pair, err := symbols.Canonical(exchange, market)
+	if err != nil {
+		return 0.0, false
+	}
+
+	if pair.Base == "USD" {
+		return amount, true
+	}
+
+	fr.Lock()
+	defer fr.Unlock()
+
+	rates := fr.rates[pair.Base]
+
+	// last rate at or before timestamp
+	i := sort.Search(len(rates), func(i int) bool {
+		return rates[i].timestamp > timestamp
+	}) - 1
+
+	if i < 0 ||
+		timestamp-rates[i].timestamp > int64(conf.Metrics.FiatValuation.maxAge) {
+		return 0.0, false
+	}
+
+	return amount * rates[i].rate, true
+}
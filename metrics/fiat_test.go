@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFiatRatesUSD(t *testing.T) {
+
+	defer func(f *fiatValuationConf) { conf.Metrics.FiatValuation = f }(
+		conf.Metrics.FiatValuation)
+	conf.Metrics.FiatValuation = &fiatValuationConf{maxAge: 10 * time.Minute}
+
+	minute := int64(time.Minute)
+	fr := &fiatRates{rates: map[string][]*timedRate{
+		"BTC": {{testStart, 4000}, {testStart + 5*minute, 4100}},
+	}}
+
+	tests := []struct {
+		name      string
+		fr        *fiatRates
+		market    string
+		timestamp int64
+		want      float64 // 0 if no rate
+	}{
+		{"first rate", fr, "BTC_ETH", testStart + minute, 8000},
+		{"at the second rate", fr, "BTC_ETH", testStart + 5*minute, 8200},
+		{"before the rates", fr, "BTC_ETH", testStart - minute, 0},
+		{"beyond max age", fr, "BTC_ETH", testStart + 16*minute, 0},
+		{"no rate of the currency", fr, "ETH_XMR", testStart, 0},
+		{"unknown market", fr, "BTCETH", testStart, 0},
+		{"disabled", nil, "BTC_ETH", testStart, 0},
+	}
+
+	for _, tt := range tests {
+
+		got, ok := tt.fr.usd(testExchange, tt.market, 2, tt.timestamp)
+		if ok != (tt.want != 0.0) || got != tt.want {
+			t.Errorf("%s: got %v (%t), want %v", tt.name, got, ok, tt.want)
+		}
+	}
+}
+
+func TestFiatRatesMerge(t *testing.T) {
+
+	minute := int64(time.Minute)
+	fr := &fiatRates{rates: make(map[string][]*timedRate)}
+
+	fr.merge(map[string][]*timedRate{
+		"BTC": {{testStart, 4000}, {testStart + minute, 4050}},
+	}, testStart, testStart+2*minute, testStart-60*minute)
+
+	// queried again from a minute, history starting at 30s
+	fr.merge(map[string][]*timedRate{
+		"BTC": {{testStart + minute, 4060}, {testStart + 2*minute, 4100}},
+	}, testStart+minute, testStart+3*minute, testStart+minute/2)
+
+	want := []timedRate{{testStart + minute, 4060}, {testStart + 2*minute, 4100}}
+
+	if fr.from != testStart+minute/2 || fr.to != testStart+3*minute ||
+		len(fr.rates["BTC"]) != len(want) {
+		t.Fatalf("got [%d, %d) %d rates, want [%d, %d) %d rates", fr.from,
+			fr.to, len(fr.rates["BTC"]), testStart+minute/2, testStart+3*minute,
+			len(want))
+	}
+
+	for i, tr := range fr.rates["BTC"] {
+		if *tr != want[i] {
+			t.Errorf("rate %d: got %+v, want %+v", i, *tr, want[i])
+		}
+	}
+
+	// a range past the cache starts a new one
+	fr.merge(map[string][]*timedRate{"BTC": {{testStart + 10*minute, 4200}}},
+		testStart+10*minute, testStart+11*minute, testStart-60*minute)
+
+	if fr.from != testStart+10*minute || fr.to != testStart+11*minute ||
+		len(fr.rates["BTC"]) != 1 {
+		t.Errorf("new range: got [%d, %d) %d rates", fr.from, fr.to,
+			len(fr.rates["BTC"]))
+	}
+}
+
+func TestGetUSDRatesCached(t *testing.T) {
+
+	defer func(f *fiatValuationConf) { conf.Metrics.FiatValuation = f }(
+		conf.Metrics.FiatValuation)
+	defer func(fr *fiatRates) { usdRates = fr }(usdRates)
+
+	conf.Metrics.FiatValuation = nil
+	if fr := getUSDRates(testStart, testStart+1); fr != nil {
+		t.Errorf("disabled: got %+v, want nil", fr)
+	}
+
+	conf.Metrics.FiatValuation = &fiatValuationConf{maxAge: time.Minute}
+	usdRates = &fiatRates{
+		rates: make(map[string][]*timedRate),
+		from:  testStart - int64(time.Hour),
+		to:    testStart + int64(10*time.Minute),
+	}
+
+	// within the cache, not queried again
+	fr := getUSDRates(testStart, testStart+int64(5*time.Minute))
+	if fr != usdRates {
+		t.Errorf("cached range: got %+v, want the cache", fr)
+	}
+}
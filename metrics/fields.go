@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// indicatorFields are the values of an indicator for a market by field name.
+// Stateful indicators persist their state as fields, cached and reloaded from
+// the database to seed the next runs.
+type indicatorFields map[string]float64
+
+// getLastMfields returns the fields of each market preceding the first time
+// interval, from cache if available or from the last persisted values.
+func getLastMfields(ind *indicator,
+	fieldNames []string) map[string]indicatorFields {
+
+	seedInterval := ind.timeIntervals[0] - int64(ind.period)
+
+	if lastImfields := getCachedLastFields(ind); lastImfields != nil {
+		if mfields, ok := lastImfields[seedInterval]; ok {
+			return copyMfields(mfields)
+		}
+	}
+
+	query := fmt.Sprintf(
+		`SELECT %s
+    FROM %s
+    WHERE time <= %d AND exchange = '%s'
+    GROUP BY market
+    ORDER BY time DESC
+    LIMIT 1`,
+		strings.Join(fieldNames, ", "),
+		ind.destination,
+		seedInterval,
+		ind.exchange)
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, conf.Metrics.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   ind.period,
+		ErrorMsg: "getLastMfields: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil
+	}
+
+	mfields := make(map[string]indicatorFields, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+		mfields[market] = make(indicatorFields, len(fieldNames))
+
+		for i, column := range serie.Columns[1:] {
+
+			value := serie.Values[0][i+1]
+			if value == nil {
+				continue
+			}
+
+			fieldValue, err := networking.ConvertJsonValueToFloat64(value)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"exchange": ind.exchange,
+					"market":   market,
+				}).Error("getLastMfields: networking.ConvertJsonValueToFloat64")
+				continue
+			}
+
+			mfields[market][column] = fieldValue
+		}
+	}
+
+	return mfields
+}
+
+func copyMfields(mfields map[string]indicatorFields) map[string]indicatorFields {
+
+	res := make(map[string]indicatorFields, len(mfields))
+
+	for market, fields := range mfields {
+
+		res[market] = make(indicatorFields, len(fields))
+		for name, value := range fields {
+			res[market][name] = value
+		}
+	}
+
+	return res
+}
+
+func prepareFieldsPoints(ind *indicator, typePoint string,
+	imfields map[int64]map[string]indicatorFields) {
+
+	measurement := ind.destination
+	points := make([]*ifxClient.Point, 0)
+
+	for interval, mfields := range imfields {
+
+		timestamp := time.Unix(0, interval)
+
+		for market, indFields := range mfields {
+
+			if len(indFields) == 0 {
+				continue
+			}
+
+			tags := map[string]string{
+				"market":   market,
+				"exchange": ind.exchange,
+			}
+
+			fields := make(map[string]interface{}, len(indFields))
+			for name, value := range indFields {
+				fields[name] = value
+			}
+
+			pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+			if err != nil {
+				logger.WithField("error", err).Error(
+					"prepareFieldsPoints: ifxClient.NewPoint")
+			}
+			points = append(points, pt)
+		}
+	}
+
+	sendBatchPoints(ind, typePoint, points)
+}
@@ -0,0 +1,302 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// metricsGraph is the dependency graph of the metrics computed at each run,
+// from the base period ohlc (ohlc_30s -> ohlc_1m -> ma_1m...). A node runs
+// once all its inputs are complete, with a bounded number of nodes running
+// concurrently.
+type metricsGraph struct {
+	nodes []*metricNode
+	sem   chan struct{}
+}
+
+// metricNode computes a metric from the indicator produced by its first
+// input (the root indicator if none). A node returning a nil indicator
+// without error has nothing to compute and its dependents are skipped.
+type metricNode struct {
+	name   string
+	inputs []*metricNode
+	run    func(from *indicator) (*indicator, error)
+}
+
+type metricDefinition struct {
+	name string
+	run  func(from *indicator) (*indicator, error)
+}
+
+type nodeResult struct {
+	done   chan struct{}
+	output *indicator
+	failed string
+}
+
+func newMetricsGraph() *metricsGraph {
+
+	g := &metricsGraph{
+		sem: make(chan struct{}, conf.Metrics.MaxConcurrentNodes),
+	}
+
+	var ohlcNode *metricNode
+
+	for indexPeriod, periodStr := range conf.Metrics.OhlcPeriodsStr {
+
+		if indexPeriod == 0 {
+			ohlcNode = g.addNode("ohlc_"+periodStr, getBaseOHLC)
+		} else {
+			ohlcNode = g.addNode("ohlc_"+periodStr, computeOHLC, ohlcNode)
+		}
+
+		for _, def := range ohlcIndicators() {
+			g.addNode(def.name+"_"+periodStr, def.run, ohlcNode)
+		}
+
+		seriesNodes := make(map[string]*metricNode)
+
+		if conf.Metrics.HeikinAshi {
+			seriesNodes["heikin_ashi"] =
+				g.addNode("heikin_ashi_"+periodStr, getHeikinAshi, ohlcNode)
+		}
+
+		if conf.Metrics.Renko != nil {
+			seriesNodes["renko"] = g.addNode("renko_"+periodStr, getRenko, ohlcNode)
+		}
+
+		// indicators computed from the candles of a series instead of the ohlc
+		for _, series := range conf.Metrics.IndicatorSeries {
+
+			seriesNode, ok := seriesNodes[series]
+			if !ok {
+				logger.WithField("series", series).Fatal(
+					"newMetricsGraph: unknown or disabled series")
+			}
+
+			for _, def := range ohlcIndicators() {
+				g.addNode(def.name+"_"+series+"_"+periodStr, def.run, seriesNode)
+			}
+		}
+	}
+
+	return g
+}
+
+// ohlcIndicators returns the configured indicators computed from the ohlc of
+// each period.
+func ohlcIndicators() []*metricDefinition {
+
+	defs := []*metricDefinition{
+		{"obv", getOBV},
+		{"ma", getMA},
+		{"rsi", getRSI},
+	}
+
+	if o := conf.Metrics.Oscillators; o != nil {
+
+		if o.Stochastic != nil {
+			defs = append(defs, &metricDefinition{"stochastic", getStochastic})
+		}
+
+		if o.WilliamsR != nil {
+			defs = append(defs, &metricDefinition{"williams_r", getWilliamsR})
+		}
+
+		if o.CCI != nil {
+			defs = append(defs, &metricDefinition{"cci", getCCI})
+		}
+	}
+
+	if t := conf.Metrics.Trend; t != nil {
+
+		if t.Ichimoku != nil {
+			defs = append(defs, &metricDefinition{"ichimoku", getIchimoku})
+		}
+
+		if t.ADX != nil {
+			defs = append(defs, &metricDefinition{"adx", getADX})
+		}
+
+		if t.ParabolicSAR != nil {
+			defs = append(defs,
+				&metricDefinition{"parabolic_sar", getParabolicSAR})
+		}
+	}
+
+	if v := conf.Metrics.Volume; v != nil {
+
+		if len(v.MFILengths) != 0 {
+			defs = append(defs, &metricDefinition{"mfi", getMFI})
+		}
+
+		if len(v.CMFLengths) != 0 {
+			defs = append(defs, &metricDefinition{"cmf", getCMF})
+		}
+
+		if len(v.MALengths) != 0 {
+			defs = append(defs, &metricDefinition{"volume_ma", getVolumeMA})
+		}
+
+		if len(v.RelativeVolumeLengths) != 0 {
+			defs = append(defs,
+				&metricDefinition{"relative_volume", getRelativeVolume})
+		}
+	}
+
+	return defs
+}
+
+func (g *metricsGraph) addNode(name string,
+	run func(*indicator) (*indicator, error),
+	inputs ...*metricNode) *metricNode {
+
+	node := &metricNode{
+		name:   name,
+		inputs: inputs,
+		run:    run,
+	}
+
+	g.nodes = append(g.nodes, node)
+
+	return node
+}
+
+// run computes every node of the graph from the root indicator and returns
+// once all of them are complete, with the names of the failed nodes.
+func (g *metricsGraph) run(root *indicator) []string {
+
+	begin := time.Now()
+	results := make(map[*metricNode]*nodeResult, len(g.nodes))
+
+	for _, node := range g.nodes {
+		results[node] = &nodeResult{done: make(chan struct{})}
+	}
+
+	var wg sync.WaitGroup
+
+	for _, node := range g.nodes {
+
+		wg.Add(1)
+
+		go func(node *metricNode) {
+			defer wg.Done()
+			g.runNode(node, root, results)
+		}(node)
+	}
+
+	wg.Wait()
+
+	failed := make([]string, 0)
+	for _, node := range g.nodes {
+		if results[node].failed == node.name {
+			failed = append(failed, node.name)
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"exchange": root.exchange,
+		"nextRun":  time.Unix(0, root.nextRun).UTC(),
+		"nodes":    len(g.nodes),
+		"failed":   len(failed),
+		"duration": time.Since(begin),
+	}).Debug("metricsGraph.run")
+
+	return failed
+}
+
+// logOverrun warns when a run scheduled every frequency ended after its next
+// tick, RunEvery skipping the ticks passed meanwhile. It returns the number
+// of skipped ticks.
+func logOverrun(root *indicator, frequency time.Duration) int64 {
+
+	late := time.Now().UnixNano() - root.nextRun
+
+	skipped := late / int64(frequency)
+	if skipped > 0 {
+		logger.WithFields(logrus.Fields{
+			"exchange": root.exchange,
+			"nextRun":  time.Unix(0, root.nextRun).UTC(),
+			"duration": time.Duration(late),
+			"skipped":  skipped,
+		}).Warn("metricsGraph.run: overrun")
+	}
+
+	return skipped
+}
+
+func (g *metricsGraph) runNode(node *metricNode, root *indicator,
+	results map[*metricNode]*nodeResult) {
+
+	res := results[node]
+	defer close(res.done)
+
+	from := root
+
+	for i, input := range node.inputs {
+
+		inputRes := results[input]
+		<-inputRes.done
+
+		// dependents of a failed node are reported rather than silently dropped
+		if inputRes.failed != "" {
+
+			res.failed = inputRes.failed
+
+			logger.WithFields(logrus.Fields{
+				"exchange": root.exchange,
+				"node":     node.name,
+				"failed":   inputRes.failed,
+			}).Warn("metricsGraph.runNode: skipped")
+			return
+		}
+
+		if inputRes.output == nil {
+			return
+		}
+
+		if i == 0 {
+			from = inputRes.output
+		}
+	}
+
+	g.sem <- struct{}{}
+	begin := time.Now()
+	output, err := runMetric(node, from)
+	<-g.sem
+
+	logger.WithFields(logrus.Fields{
+		"exchange": root.exchange,
+		"node":     node.name,
+		"duration": time.Since(begin),
+	}).Debug("metricsGraph.runNode")
+
+	if err != nil {
+
+		res.failed = node.name
+
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"exchange": root.exchange,
+			"node":     node.name,
+		}).Error("metricsGraph.runNode")
+		return
+	}
+
+	res.output = output
+}
+
+func runMetric(node *metricNode, from *indicator) (output *indicator,
+	err error) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return node.run(from)
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetricsGraphRun(t *testing.T) {
+
+	var mu sync.Mutex
+	var ran []string
+
+	// node returning an indicator named after it, or err, or nothing
+	node := func(name string, err error, skip bool) func(*indicator) (
+		*indicator, error) {
+
+		return func(from *indicator) (*indicator, error) {
+
+			mu.Lock()
+			ran = append(ran, from.destination+">"+name)
+			mu.Unlock()
+
+			if err != nil {
+				return nil, err
+			}
+			if skip {
+				return nil, nil
+			}
+			if name == "panicking" {
+				panic("index out of range")
+			}
+			return &indicator{destination: name}, nil
+		}
+	}
+
+	g := &metricsGraph{sem: make(chan struct{}, 2)}
+
+	ohlc1 := g.addNode("ohlc_1m", node("ohlc_1m", nil, false))
+	ohlc5 := g.addNode("ohlc_5m", node("ohlc_5m", nil, false), ohlc1)
+	g.addNode("ma_5m", node("ma_5m", nil, false), ohlc5)
+	failing := g.addNode("rsi_1m", node("rsi_1m", errors.New("no result"), false),
+		ohlc1)
+	g.addNode("signal_1m", node("signal_1m", nil, false), failing)
+	empty := g.addNode("renko_1m", node("renko_1m", nil, true), ohlc1)
+	g.addNode("ma_renko_1m", node("ma_renko_1m", nil, false), empty)
+	g.addNode("panicking", node("panicking", nil, false), ohlc5)
+
+	failed := g.run(&indicator{destination: "root"})
+	sort.Strings(failed)
+	sort.Strings(ran)
+
+	if want := []string{"panicking", "rsi_1m"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed: got %v, want %v", failed, want)
+	}
+
+	// dependents of failed or empty nodes are skipped
+	want := []string{
+		"ohlc_1m>ohlc_5m", "ohlc_1m>renko_1m", "ohlc_1m>rsi_1m",
+		"ohlc_5m>ma_5m", "ohlc_5m>panicking", "root>ohlc_1m",
+	}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran: got %v, want %v", ran, want)
+	}
+}
+
+func TestNewMetricsGraph(t *testing.T) {
+
+	g := newMetricsGraph()
+
+	inputs := make(map[string][]string, len(g.nodes))
+	for _, node := range g.nodes {
+		for _, input := range node.inputs {
+			inputs[node.name] = append(inputs[node.name], input.name)
+		}
+	}
+
+	tests := []struct {
+		node   string
+		inputs []string
+	}{
+		{"ohlc_1m", nil},
+		{"ohlc_5m", []string{"ohlc_1m"}},
+		{"ma_1m", []string{"ohlc_1m"}},
+		{"rsi_5m", []string{"ohlc_5m"}},
+	}
+
+	for _, tt := range tests {
+		if got := inputs[tt.node]; !reflect.DeepEqual(got, tt.inputs) {
+			t.Errorf("%s: got inputs %v, want %v", tt.node, got, tt.inputs)
+		}
+	}
+}
+
+func TestLogOverrun(t *testing.T) {
+
+	now := time.Now().UnixNano()
+
+	tests := []struct {
+		nextRun int64
+		want    int64
+	}{
+		{now, 0},
+		{now - int64(5*time.Second), 0},
+		{now - int64(25*time.Second), 2},
+	}
+
+	for _, tt := range tests {
+
+		root := &indicator{nextRun: tt.nextRun, exchange: testExchange}
+		if got := logOverrun(root, 10*time.Second); got != tt.want {
+			t.Errorf("%v late: got %d skipped, want %d",
+				time.Duration(now-tt.nextRun), got, tt.want)
+		}
+	}
+}
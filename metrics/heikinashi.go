@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+)
+
+func getHeikinAshi(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "heikin_ashi")
+
+	ind.computeTimeIntervals(0)
+
+	imohlc := computeHeikinAshi(ind)
+	if imohlc == nil {
+		return nil, fmt.Errorf("computeHeikinAshi: no result")
+	}
+
+	updateCacheLastSeries(ind, "heikin_ashi", imohlc)
+
+	points := make(map[int64]map[string]*ohlc, len(ind.timeIntervals))
+	for _, interval := range ind.timeIntervals {
+		if mohlc, ok := imohlc[interval]; ok {
+			points[interval] = mohlc
+		}
+	}
+	prepareOHLCPoints(ind, points)
+
+	// indicators depending on this node are computed from the candles
+	ind.series = "heikin_ashi"
+
+	return ind, nil
+}
+
+// computeHeikinAshi computes the candles of each interval from the cached
+// ohlc. The open of a candle depends on the previous one: without a cached
+// previous candle (start), the candles are computed from the oldest cached
+// ohlc, seeded by its own open and close.
+func computeHeikinAshi(ind *indicator) map[int64]map[string]*ohlc {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	intervals := ind.timeIntervals
+	period := int64(ind.period)
+
+	lastImohlc := getCachedLastSeries(ind, "heikin_ashi")
+	lastMohlc, ok := lastImohlc[intervals[0]-period]
+
+	if !ok {
+		cacheInd := *ind
+		cacheInd.computeTimeIntervals(conf.Metrics.CacheLength - 1)
+		intervals = cacheInd.timeIntervals
+		lastMohlc = make(map[string]*ohlc)
+	}
+
+	prevMohlc := make(map[string]*ohlc, len(lastMohlc))
+	for market, ha := range lastMohlc {
+		prevMohlc[market] = ha
+	}
+
+	res := make(map[int64]map[string]*ohlc, len(intervals))
+
+	for _, interval := range intervals {
+
+		if _, ok := imohlc[interval]; !ok {
+			continue
+		}
+
+		res[interval] = make(map[string]*ohlc, len(imohlc[interval]))
+
+		for market, o := range imohlc[interval] {
+
+			ha := &ohlc{
+				volume:   o.volume,
+				quantity: o.quantity,
+				close:    (o.open + o.high + o.low + o.close) / 4,
+				filled:   o.filled,
+			}
+
+			if prev, ok := prevMohlc[market]; ok {
+				ha.open = (prev.open + prev.close) / 2
+			} else {
+				ha.open = (o.open + o.close) / 2
+			}
+
+			ha.high = math.Max(o.high, math.Max(ha.open, ha.close))
+			ha.low = math.Min(o.low, math.Min(ha.open, ha.close))
+			ha.setDerivedFields()
+
+			res[interval][market] = ha
+			prevMohlc[market] = ha
+		}
+	}
+
+	return res
+}
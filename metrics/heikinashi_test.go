@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeHeikinAshi(t *testing.T) {
+
+	tests := []struct {
+		name string
+		seed *ohlc
+		want []*ohlc // open, high, low and close
+	}{
+		{
+			name: "from the cached candle",
+			seed: &ohlc{open: 9, close: 10},
+			want: []*ohlc{
+				{open: 9.5, high: 12, low: 9, close: 10.5},
+				{open: 10, high: 13, low: 10, close: 11.5},
+			},
+		},
+		{
+			name: "seeded by the first candle",
+			want: []*ohlc{
+				{open: 10.5, high: 12, low: 9, close: 10.5},
+				{open: 10.5, high: 13, low: 10, close: 11.5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+
+		ind := newTestIndicator(time.Minute, 2)
+		setTestOHLC(ind.period, 0, "BTC_ETH", []*ohlc{
+			newTestOHLC(10, 12, 9, 11, 10),
+			newTestOHLC(11, 13, 10, 12, 10),
+		})
+
+		if tt.seed != nil {
+			cm[testExchange][ind.period].lastSeries =
+				map[string]map[int64]map[string]*ohlc{"heikin_ashi": {
+					testStart - int64(ind.period): {"BTC_ETH": tt.seed},
+				}}
+		}
+
+		imha := computeHeikinAshi(ind)
+
+		for i, want := range tt.want {
+
+			got := imha[ind.timeIntervals[i]]["BTC_ETH"]
+			if got == nil || got.open != want.open || got.high != want.high ||
+				got.low != want.low || got.close != want.close {
+				t.Errorf("%s: interval %d: got %+v, want %+v", tt.name, i, got,
+					want)
+			}
+		}
+	}
+}
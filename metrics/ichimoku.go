@@ -0,0 +1,76 @@
+package metrics
+
+import "fmt"
+
+func getIchimoku(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "ichimoku")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeIchimoku(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeIchimoku: no result")
+	}
+
+	prepareFieldsPoints(ind, "Ichimoku", imfields)
+
+	return ind, nil
+}
+
+// computeIchimoku computes the lines of each interval from the ohlc up to this
+// interval. As usual the senkou spans are meant to be plotted kijun periods
+// ahead and the chikou span (the close) kijun periods behind.
+func computeIchimoku(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	ic := conf.Metrics.Trend.Ichimoku
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	midpoint := func(interval int64, market string, length int) (float64, bool) {
+
+		window := getOHLCWindow(imohlc, ind.period, interval, market, length)
+		if window == nil {
+			return 0.0, false
+		}
+
+		high, low := highestHighLowestLow(window)
+		return (high + low) / 2, true
+	}
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, ohlc := range imohlc[interval] {
+
+			fields := indicatorFields{"chikou_span": ohlc.close}
+
+			tenkan, tenkanOk := midpoint(interval, market, ic.Tenkan)
+			if tenkanOk {
+				fields["tenkan_sen"] = tenkan
+			}
+
+			kijun, kijunOk := midpoint(interval, market, ic.Kijun)
+			if kijunOk {
+				fields["kijun_sen"] = kijun
+			}
+
+			if tenkanOk && kijunOk {
+				fields["senkou_span_a"] = (tenkan + kijun) / 2
+			}
+
+			if senkouB, ok := midpoint(interval, market, ic.SenkouB); ok {
+				fields["senkou_span_b"] = senkouB
+			}
+
+			imfields[interval][market] = fields
+		}
+	}
+
+	return imfields
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeIchimoku(t *testing.T) {
+
+	defer func(tc *trendConf) { conf.Metrics.Trend = tc }(conf.Metrics.Trend)
+
+	tests := []struct {
+		name     string
+		ichimoku *ichimokuConf
+		want     indicatorFields
+	}{
+		{
+			name:     "all lines",
+			ichimoku: &ichimokuConf{Tenkan: 2, Kijun: 3, SenkouB: 4},
+			want: indicatorFields{
+				"chikou_span": 10, "tenkan_sen": 11, "kijun_sen": 11,
+				"senkou_span_a": 11, "senkou_span_b": 10.5,
+			},
+		},
+		{
+			name:     "senkou b window longer than the candles",
+			ichimoku: &ichimokuConf{Tenkan: 1, Kijun: 4, SenkouB: 5},
+			want: indicatorFields{
+				"chikou_span": 10, "tenkan_sen": 11, "kijun_sen": 10.5,
+				"senkou_span_a": 10.75,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+
+		conf.Metrics.Trend = &trendConf{Ichimoku: tt.ichimoku}
+
+		ind := newTestIndicator(time.Minute, 1)
+		setTestOHLC(ind.period, 3, "BTC_ETH", testOscillatorCandles)
+
+		got := computeIchimoku(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
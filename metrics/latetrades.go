@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"fmt"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// lateTrades polls the markers written by the ingestion when trades land in
+// buckets possibly already computed (missing trades recovered, backfills).
+type lateTrades struct {
+	checkedUntil int64
+}
+
+// checkStart returns the start of the markers checked at the run of ind,
+// overlapping the previous check by a run and the update lag of the source:
+// markers are timestamped when ingested but only written once flushed by
+// the ingestion, within the update lag.
+func (lt *lateTrades) checkStart(ind *indicator) int64 {
+
+	overlap := int64(conf.Metrics.Frequency + ind.dataSource.UpdateLag)
+
+	if lt.checkedUntil == 0 {
+		return ind.nextRun - overlap
+	}
+
+	return lt.checkedUntil - overlap
+}
+
+// getDirtySince returns the timestamp of the oldest late trade ingested since
+// the last check (0 if none), capped at the ohlc cache horizon as higher
+// periods are recomputed from the cached ohlc.
+func (lt *lateTrades) getDirtySince(ind *indicator) int64 {
+
+	measurement, ok := ind.dataSource.Schema["late_trades_measurement"]
+	if !ok {
+		return 0
+	}
+
+	start := lt.checkStart(ind)
+
+	query := fmt.Sprintf(
+		`SELECT MIN(oldest)
+    FROM %s
+    WHERE time >= %d AND time < %d%s`,
+		measurement,
+		start, ind.nextRun, ind.marketsCondition())
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, ind.dataSource.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   conf.Metrics.Frequency,
+		ErrorMsg: "getDirtySince: database.QueryDB",
+		Request:  request,
+	})
+
+	// checking the same markers again at next run
+	if !success {
+		return 0
+	}
+	lt.checkedUntil = ind.nextRun
+
+	if len(res[0].Series) == 0 || res[0].Series[0].Values[0][1] == nil {
+		return 0
+	}
+
+	oldest, err := networking.ConvertJsonValueToInt64(
+		res[0].Series[0].Values[0][1])
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"exchange": ind.exchange,
+		}).Error("getDirtySince: networking.ConvertJsonValueToInt64")
+		return 0
+	}
+
+	horizon := ind.cacheHorizon()
+
+	if oldest < horizon {
+
+		logger.WithFields(logrus.Fields{
+			"exchange": ind.exchange,
+			"oldest":   time.Unix(0, oldest).UTC(),
+			"horizon":  time.Unix(0, horizon).UTC(),
+		}).Warn("getDirtySince: late trades beyond cache horizon (backfill needed)")
+
+		oldest = horizon
+	}
+
+	return oldest
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeTimeIntervalsDirty(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		dirtySince int64
+		want       int // intervals before the one of nextRun
+	}{
+		{"clean", 0, 1},
+		{"within update lag", testStart + int64(55*time.Second), 1},
+		{"late trades", testStart - int64(3*time.Minute+30*time.Second), 5},
+	}
+
+	for _, tt := range tests {
+
+		// 5 seconds into the minute following testStart
+		ind := newTestIndicator(time.Minute, 0)
+		ind.nextRun = testStart + int64(time.Minute+5*time.Second)
+		ind.dirtySince = tt.dirtySince
+
+		ind.computeTimeIntervals(0)
+
+		want := tt.want + 1
+		first := testStart - int64(tt.want-1)*int64(time.Minute)
+
+		if len(ind.timeIntervals) != want || ind.timeIntervals[0] != first {
+			t.Errorf("%s: got %d intervals from %d, want %d from %d", tt.name,
+				len(ind.timeIntervals), ind.timeIntervals[0], want, first)
+		}
+	}
+}
+
+func TestComputeOHLCUncached(t *testing.T) {
+
+	from := newTestIndicator(time.Minute, 0)
+	from.indexPeriod = 0
+	from.nextRun = testStart + int64(2*time.Minute)
+	// late trades reaching the 5m bucket preceding the cached sub ohlc
+	from.dirtySince = testStart - int64(4*time.Minute)
+
+	setTestOHLC(time.Minute, 0, "BTC_ETH", []*ohlc{
+		newTestOHLC(10, 11, 9.5, 10.5, 100),
+	})
+	cm[testExchange][5*time.Minute].lastImohlc =
+		make(map[int64]map[string]*ohlc)
+
+	if _, err := computeOHLC(from); err != nil {
+		t.Fatalf("computeOHLC: %v", err)
+	}
+
+	imohlc := cm[testExchange][5*time.Minute].lastImohlc
+	if _, ok := imohlc[testStart-int64(5*time.Minute)]; ok {
+		t.Errorf("uncached bucket computed")
+	}
+	if imohlc[testStart]["BTC_ETH"] == nil {
+		t.Errorf("cached bucket not computed")
+	}
+}
+
+func TestLateTradesCheckStart(t *testing.T) {
+
+	// 10s frequency and update lag
+	ind := newTestIndicator(time.Minute, 0)
+	ind.nextRun = testStart
+
+	lt := &lateTrades{}
+	want := testStart - int64(20*time.Second)
+	if got := lt.checkStart(ind); got != want {
+		t.Errorf("first check: got %d, want %d", got, want)
+	}
+
+	// markers flushed up to the update lag after the previous check
+	lt.checkedUntil = testStart - int64(10*time.Second)
+	want = testStart - int64(30*time.Second)
+	if got := lt.checkStart(ind); got != want {
+		t.Errorf("next check: got %d, want %d", got, want)
+	}
+}
@@ -17,23 +17,21 @@ type ma struct {
 	emas map[int]float64
 }
 
-func getMA(from *indicator) {
-
-	ind := &indicator{
-		nextRun:     from.nextRun,
-		period:      conf.Metrics.OhlcPeriods[from.indexPeriod],
-		indexPeriod: from.indexPeriod,
-		dataSource:  from.dataSource,
-		source:      from.destination,
-		destination: "ma_" + conf.Metrics.OhlcPeriodsStr[from.indexPeriod],
-		exchange:    from.exchange,
-	}
+func getMA(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "ma")
 
 	ind.computeTimeIntervals(conf.Metrics.LengthMax - 1)
 
 	imma := computeMA(ind)
+	if imma == nil {
+		return nil, fmt.Errorf("computeMA: no result")
+	}
+
 	setCacheLastMA(ind, imma)
 	prepareMAPoints(ind, imma)
+
+	return ind, nil
 }
 
 func computeMA(ind *indicator) map[int64]map[string]*ma {
@@ -243,13 +241,5 @@ func prepareMAPoints(ind *indicator, imma map[int64]map[string]*ma) {
 		}
 	}
 
-	if len(points) == 0 {
-		return
-	}
-
-	batchsToWrite <- &database.BatchPoints{
-		TypePoint: ind.exchange + "MA",
-		Points:    points,
-		Callback:  ind.callback,
-	}
+	sendBatchPoints(ind, "MA", points)
 }
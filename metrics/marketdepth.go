@@ -5,7 +5,6 @@ import (
 	"strconv"
 	"time"
 	"trading/networking"
-	"trading/networking/database"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 	"github.com/sirupsen/logrus"
@@ -56,6 +55,7 @@ func computeMarketDepths() {
 func computeMarketDepthsBittrex(ind *indicator) {
 
 	ind.dataSource = conf.Metrics.Sources[ind.exchange]
+	walls := newBookWalls()
 
 	go networking.RunEvery(ind.period, func(nextRun int64) {
 
@@ -65,6 +65,11 @@ func computeMarketDepthsBittrex(ind *indicator) {
 		// printOrderBook(obs["BTC-STRAT"], 10)
 		mds := getMarketDepths(obs)
 		prepareMarketDepthsPoints(ind, mds)
+		prepareBookMetricsPoints(ind, getBookMetrics(obs))
+		prepareSlippagesPoints(ind, obs)
+		prepareBookHeatmapsPoints(ind, obs)
+		walls.update(ind, obs)
+		setLastBooks(ind, obs)
 	})
 }
 
@@ -73,6 +78,7 @@ func computeMarketDepthsPoloniex(ind *indicator) {
 	ind.dataSource = conf.Metrics.Sources[ind.exchange]
 
 	var obs orderBooks
+	walls := newBookWalls()
 	i := 0
 
 	go networking.RunEvery(ind.period, func(nextRun int64) {
@@ -93,6 +99,11 @@ func computeMarketDepthsPoloniex(ind *indicator) {
 
 		mds := getMarketDepths(obs)
 		prepareMarketDepthsPoints(ind, mds)
+		prepareBookMetricsPoints(ind, getBookMetrics(obs))
+		prepareSlippagesPoints(ind, obs)
+		prepareBookHeatmapsPoints(ind, obs)
+		walls.update(ind, obs)
+		setLastBooks(ind, obs)
 	})
 
 }
@@ -252,6 +263,7 @@ func prepareMarketDepthsPoints(ind *indicator, mds marketDepths) {
 	measurement := conf.Metrics.Schema["market_depths_measurement"]
 	timestamp := time.Unix(0, ind.nextRun)
 	points := make([]*ifxClient.Point, 0, len(mds)*2)
+	rates := getUSDRates(ind.nextRun, ind.nextRun+1)
 
 	for market, md := range mds {
 
@@ -264,9 +276,26 @@ func prepareMarketDepthsPoints(ind *indicator, mds marketDepths) {
 
 			tags["interval"] = strconv.FormatFloat(interval, 'f', 2, 64)
 
+			bidDepth := md.bidsDepth[interval]
+			askDepth := md.asksDepth[interval]
+
+			// share of the depth on the bid side, from -1 (asks) to 1 (bids)
+			imbalance := 0.0
+			if bidDepth+askDepth != 0.0 {
+				imbalance = (bidDepth - askDepth) / (bidDepth + askDepth)
+			}
+
 			fields := map[string]interface{}{
-				"bid_depth": md.bidsDepth[interval],
-				"ask_depth": md.asksDepth[interval],
+				"bid_depth": bidDepth,
+				"ask_depth": askDepth,
+				"imbalance": imbalance,
+			}
+
+			if bidDepthUSD, ok := rates.usd(ind.exchange, market, bidDepth,
+				ind.nextRun); ok {
+				fields["bid_depth_usd"] = bidDepthUSD
+				fields["ask_depth_usd"], _ = rates.usd(ind.exchange, market,
+					askDepth, ind.nextRun)
 			}
 
 			pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
@@ -278,14 +307,7 @@ func prepareMarketDepthsPoints(ind *indicator, mds marketDepths) {
 		}
 	}
 
-	if len(points) == 0 {
-		return
-	}
-
-	batchsToWrite <- &database.BatchPoints{
-		TypePoint: ind.dataSource.Schema["database"] + "MarketDepth",
-		Points:    points,
-	}
+	sendBatchPoints(ind, "MarketDepth", points)
 }
 
 func printOrderBook(orderBook *orderBook, limit int) {
@@ -66,9 +66,10 @@ func getLastOrderBooksBittrex(ind *indicator, markets []string) orderBooks {
 func getLastOrderBookTimestampsBittrex(ind *indicator,
 	markets []string) []ifxClient.Result {
 
-	where := ""
+	// bounding to the run time allows to rebuild past order books
+	where := fmt.Sprintf("WHERE time < %d", ind.nextRun)
 	if len(markets) != 0 {
-		where = fmt.Sprintf("WHERE market = '%s'",
+		where += fmt.Sprintf(" AND (market = '%s')",
 			strings.Join(markets, "' OR market = '"))
 	}
 
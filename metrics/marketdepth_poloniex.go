@@ -112,9 +112,10 @@ func getLastOrderBooksPoloniex(ind *indicator, markets []string) orderBooks {
 func getLastOrderBookSequencesPoloniex(ind *indicator,
 	markets []string) []ifxClient.Result {
 
-	where := ""
+	// bounding to the run time allows to rebuild past order books
+	where := fmt.Sprintf("WHERE time < %d", ind.nextRun)
 	if len(markets) != 0 {
-		where = fmt.Sprintf("WHERE market = '%s'",
+		where += fmt.Sprintf(" AND (market = '%s')",
 			strings.Join(markets, "' OR market = '"))
 	}
 
@@ -152,10 +153,10 @@ func getBookUpdates(obs orderBooks, ind *indicator) map[string]bookUpdates {
 		query += fmt.Sprintf(
 			`SELECT sequence, rate, quantity, total, order_type
       FROM %s
-      WHERE market = '%s' AND sequence > %d
+      WHERE market = '%s' AND sequence > %d AND time < %d
       GROUP BY market;`,
 			ind.dataSource.Schema["book_updates_measurement"],
-			market, ob.sequence)
+			market, ob.sequence, ind.nextRun)
 	}
 
 	if query == "" {
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"strings"
 	"time"
+	"trading/networking/bus"
 	"trading/networking/database"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
@@ -19,6 +21,7 @@ var (
 	dbClient      ifxClient.Client
 	batchsToWrite chan *database.BatchPoints
 	cm            dataSourceCachedMetrics
+	metricsDAG    *metricsGraph
 )
 
 type configuration struct {
@@ -30,12 +33,31 @@ type metricsConf struct {
 	Schema              map[string]string `json:"schema"`
 	FlushBatchsPeriodMs int               `json:"flush_batchs_period_ms"`
 	FlushCapacity       int               `json:"flush_capacity"`
+	MaxConcurrentNodes  int               `json:"max_concurrent_nodes"`
 	Frequency           time.Duration
 	OhlcPeriodsStr      []string `json:"ohlc_periods"`
 	OhlcPeriods         []time.Duration
 	LengthMax           int                      `json:"length_max"`
 	MarketDepths        *marketDepthsConf        `json:"market_depths"`
+	Slippage            *slippageConf            `json:"slippage"`
+	BookHeatmap         *bookHeatmapConf         `json:"book_heatmap"`
+	Arbitrage           *arbitrageConf           `json:"arbitrage"`
+	Triangular          *triangularConf          `json:"triangular_arbitrage"`
+	PriceIndex          *priceIndexConf          `json:"price_index"`
+	FiatValuation       *fiatValuationConf       `json:"fiat_valuation"`
+	Alerts              *alertsConf              `json:"alerts"`
+	Anomalies           *anomaliesConf           `json:"anomalies"`
+	Oscillators         *oscillatorsConf         `json:"oscillators"`
+	VWAP                *vwapConf                `json:"vwap"`
+	Trend               *trendConf               `json:"trend"`
+	Volume              *volumeConf              `json:"volume"`
+	Streaming           *streamingConf           `json:"streaming"`
+	Bars                *barsConf                `json:"bars"`
+	HeikinAshi          bool                     `json:"heikin_ashi"`
+	Renko               *renkoConf               `json:"renko"`
+	IndicatorSeries     []string                 `json:"indicator_series"`
 	Sources             map[string]*exchangeConf `json:"sources"`
+	CacheLength         int
 }
 
 type marketDepthsConf struct {
@@ -44,9 +66,66 @@ type marketDepthsConf struct {
 	PoloniexHardFetchFrequency int       `json:"poloniex_hard_fetch_frequency"`
 }
 
+type oscillatorsConf struct {
+	Stochastic *stochasticConf `json:"stochastic"`
+	WilliamsR  *lengthsConf    `json:"williams_r"`
+	CCI        *lengthsConf    `json:"cci"`
+}
+
+type stochasticConf struct {
+	Lengths    []int `json:"lengths"`
+	KSmoothing int   `json:"k_smoothing"`
+	DSmoothing int   `json:"d_smoothing"`
+}
+
+type lengthsConf struct {
+	Lengths []int `json:"lengths"`
+}
+
+type trendConf struct {
+	Ichimoku     *ichimokuConf     `json:"ichimoku"`
+	ADX          *lengthsConf      `json:"adx"`
+	ParabolicSAR *parabolicSARConf `json:"parabolic_sar"`
+}
+
+type ichimokuConf struct {
+	Tenkan  int `json:"tenkan"`
+	Kijun   int `json:"kijun"`
+	SenkouB int `json:"senkou_b"`
+}
+
+type parabolicSARConf struct {
+	Start float64 `json:"start"`
+	Step  float64 `json:"step"`
+	Max   float64 `json:"max"`
+}
+
+type volumeConf struct {
+	MFILengths            []int `json:"mfi_lengths"`
+	CMFLengths            []int `json:"cmf_lengths"`
+	MALengths             []int `json:"ma_lengths"`
+	RelativeVolumeLengths []int `json:"relative_volume_lengths"`
+}
+
+type streamingConf struct {
+	Capacity int `json:"capacity"`
+}
+
+// gap policies of the buckets without trades: flat candle at the last close
+// (forward_fill, default), no candle (empty) or flat candle with an
+// is_filled field set on every candle (mark). Markets are filled until their
+// last trade is older than the gap lookback.
+const (
+	gapForwardFill = "forward_fill"
+	gapEmpty       = "empty"
+	gapMark        = "mark"
+)
+
 type exchangeConf struct {
-	Schema    map[string]string `json:"schema"`
-	UpdateLag time.Duration
+	Schema      map[string]string `json:"schema"`
+	GapPolicy   string            `json:"gap_policy"`
+	UpdateLag   time.Duration
+	GapLookback time.Duration
 }
 
 type indicators map[string]*indicator
@@ -58,9 +137,58 @@ type indicator struct {
 	dataSource    *exchangeConf
 	source        string
 	destination   string
-	callback      func()
 	timeIntervals []int64
 	exchange      string
+	markets       []string
+	dirtySince    int64
+	prefetched    map[int64]map[string]*ohlc
+	series        string
+	step          *backfillStep
+}
+
+// deriveIndicator returns the indicator name computed from the ohlc (or the
+// candle series) of from, written to name_period (name_series_period).
+func deriveIndicator(from *indicator, name string) *indicator {
+
+	if from.series != "" {
+		name += "_" + from.series
+	}
+
+	return &indicator{
+		nextRun:     from.nextRun,
+		period:      conf.Metrics.OhlcPeriods[from.indexPeriod],
+		indexPeriod: from.indexPeriod,
+		dataSource:  from.dataSource,
+		source:      from.destination,
+		destination: name + "_" + conf.Metrics.OhlcPeriodsStr[from.indexPeriod],
+		exchange:    from.exchange,
+		markets:     from.markets,
+		dirtySince:  from.dirtySince,
+		series:      from.series,
+		step:        from.step,
+	}
+}
+
+// marketsCondition returns the where clause restricting a query to the
+// markets of the indicator (all markets if none).
+func (ind *indicator) marketsCondition() string {
+
+	if len(ind.markets) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" AND (market = '%s')",
+		strings.Join(ind.markets, "' OR market = '"))
+}
+
+// cacheHorizon returns the oldest time interval kept in cache.
+func (ind *indicator) cacheHorizon() int64 {
+
+	cacheInd := *ind
+	cacheInd.dirtySince = 0
+	cacheInd.computeTimeIntervals(conf.Metrics.CacheLength - 1)
+
+	return cacheInd.timeIntervals[0]
 }
 
 func (ind *indicator) computeTimeIntervals(offset int) {
@@ -69,6 +197,11 @@ func (ind *indicator) computeTimeIntervals(offset int) {
 	delta := ind.nextRun % int64(ind.period)
 	lag := int64(ind.dataSource.UpdateLag)
 
+	// reaching back to the oldest bucket having received late trades
+	if ind.dirtySince != 0 && ind.nextRun-ind.dirtySince > lag {
+		lag = ind.nextRun - ind.dirtySince
+	}
+
 	if delta < lag {
 		periodCount += int64(math.Ceil(float64(lag-delta) / float64(ind.period)))
 	}
@@ -128,6 +261,10 @@ func init() {
 	batchsToWrite = make(chan *database.BatchPoints, conf.Metrics.FlushCapacity)
 
 	initCachedMetrics()
+
+	initFiatValuation()
+	initAlerts()
+	metricsDAG = newMetricsGraph()
 }
 
 func ComputeMetrics() {
@@ -142,33 +279,69 @@ func ComputeMetrics() {
 	})
 
 	go computeMarketDepths()
-	go computeBaseOHLC()
+
+	if conf.Metrics.Streaming != nil {
+		go streamBaseOHLC()
+	} else {
+		go computeBaseOHLC()
+	}
+
+	go computeVWAPs()
+	go computeBars()
+	go computeArbitrage()
+	go computeTriangularArbitrages()
+	go computePriceIndexes()
+	go computeAnomalies()
+	go deliverAlerts()
 }
 
-func applyMetrics(from, to time.Time, dataSources []*exchangeConf,
-	apply func(ind *indicator)) {
+func sendBatchPoints(ind *indicator, typePoint string,
+	points []*ifxClient.Point) {
 
-	period := conf.Metrics.OhlcPeriods[0]
-	fromDuration := from.UnixNano()
-	firstRun := fromDuration - (fromDuration % int64(period)) + int64(period)
-	sleep := 200 * time.Millisecond
+	if len(points) == 0 {
+		return
+	}
 
-	for start := firstRun; start < to.UnixNano(); start += int64(period) {
+	var callback func(error)
 
-		for _, dataSource := range dataSources {
+	// backfills keep track of the writes to checkpoint their progress
+	if ind.step != nil {
+		ind.step.writes.Add(1)
+		callback = ind.step.writes.done
+	} else {
+		evaluateAlerts(points)
+		publishPoints(points)
+	}
 
-			indFrom := &indicator{
-				nextRun:     start,
-				period:      period,
-				indexPeriod: 0,
-				dataSource:  dataSource,
-				destination: "ohlc_" + conf.Metrics.OhlcPeriodsStr[0],
-				exchange:    dataSource.Schema["database"],
-			}
+	batchsToWrite <- &database.BatchPoints{
+		TypePoint: ind.exchange + typePoint,
+		Points:    points,
+		Callback:  callback,
+	}
+}
+
+// publishPoints publishes the points of the subscribed measurements on the
+// bus.
+func publishPoints(points []*ifxClient.Point) {
 
-			apply(indFrom)
-			time.Sleep(sleep)
+	for _, pt := range points {
+
+		if pt == nil || !bus.Subscribed(pt.Name()) {
+			continue
 		}
+
+		fields, err := pt.Fields()
+		if err != nil {
+			logger.WithField("error", err).Error("publishPoints: pt.Fields")
+			continue
+		}
+
+		bus.PublishPoint(&bus.Point{
+			Measurement: pt.Name(),
+			Tags:        pt.Tags(),
+			Fields:      fields,
+			Time:        pt.Time(),
+		})
 	}
 }
 
@@ -176,10 +349,12 @@ func (e *exchangeConf) UnmarshalJSON(data []byte) error {
 
 	type alias exchangeConf
 	aux := struct {
-		UpdateLag string `json:"update_lag"`
+		UpdateLag   string `json:"update_lag"`
+		GapLookback string `json:"gap_lookback"`
 		*alias
 	}{
-		alias: (*alias)(e),
+		GapLookback: "1h",
+		alias:       (*alias)(e),
 	}
 
 	if err := json.Unmarshal(data, &aux); err != nil {
@@ -192,6 +367,18 @@ func (e *exchangeConf) UnmarshalJSON(data []byte) error {
 		return fmt.Errorf("time.ParseDuration: %v", err)
 	}
 
+	if e.GapLookback, err = time.ParseDuration(aux.GapLookback); err != nil {
+		return fmt.Errorf("time.ParseDuration: %v", err)
+	}
+
+	switch e.GapPolicy {
+	case "":
+		e.GapPolicy = gapForwardFill
+	case gapForwardFill, gapEmpty, gapMark:
+	default:
+		return fmt.Errorf("unknown gap_policy: %s", e.GapPolicy)
+	}
+
 	return nil
 }
 
@@ -225,5 +412,201 @@ func (m *metricsConf) UnmarshalJSON(data []byte) error {
 		m.OhlcPeriods[i] = period
 	}
 
+	if m.MaxConcurrentNodes < 1 {
+		m.MaxConcurrentNodes = 1
+	}
+
+	if err := m.Oscillators.validate(); err != nil {
+		return fmt.Errorf("oscillators: %v", err)
+	}
+
+	if err := m.Trend.validate(); err != nil {
+		return fmt.Errorf("trend: %v", err)
+	}
+
+	if err := m.Volume.validate(); err != nil {
+		return fmt.Errorf("volume: %v", err)
+	}
+
+	if h := m.BookHeatmap; h != nil && (h.RangePercent <= 0.0 ||
+		h.StepPercent <= 0.0) {
+		return fmt.Errorf("book_heatmap: invalid range or step: %v %v",
+			h.RangePercent, h.StepPercent)
+	}
+
+	if m.Renko != nil && m.Renko.ATRLength < 1 {
+		return fmt.Errorf("renko: invalid atr_length: %d", m.Renko.ATRLength)
+	}
+
+	if err := m.Anomalies.validate(); err != nil {
+		return fmt.Errorf("anomalies: %v", err)
+	}
+
+	m.CacheLength = m.computeCacheLength()
+
 	return nil
 }
+
+func (o *oscillatorsConf) validate() error {
+
+	if o == nil {
+		return nil
+	}
+
+	if o.Stochastic != nil {
+		if err := validateLengths(o.Stochastic.Lengths); err != nil {
+			return fmt.Errorf("stochastic: %v", err)
+		}
+	}
+
+	if o.WilliamsR != nil {
+		if err := validateLengths(o.WilliamsR.Lengths); err != nil {
+			return fmt.Errorf("williams_r: %v", err)
+		}
+	}
+
+	if o.CCI != nil {
+		if err := validateLengths(o.CCI.Lengths); err != nil {
+			return fmt.Errorf("cci: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *trendConf) validate() error {
+
+	if t == nil {
+		return nil
+	}
+
+	if i := t.Ichimoku; i != nil {
+		spans := []int{i.Tenkan, i.Kijun, i.SenkouB}
+		if err := validateLengths(spans); err != nil {
+			return fmt.Errorf("ichimoku: %v", err)
+		}
+	}
+
+	if t.ADX != nil {
+		if err := validateLengths(t.ADX.Lengths); err != nil {
+			return fmt.Errorf("adx: %v", err)
+		}
+	}
+
+	if p := t.ParabolicSAR; p != nil {
+		if p.Start <= 0.0 || p.Step <= 0.0 || p.Max < p.Start {
+			return fmt.Errorf("parabolic_sar: invalid factors: %v %v %v",
+				p.Start, p.Step, p.Max)
+		}
+	}
+
+	return nil
+}
+
+func (v *volumeConf) validate() error {
+
+	if v == nil {
+		return nil
+	}
+
+	lengths := map[string][]int{
+		"mfi_lengths":             v.MFILengths,
+		"cmf_lengths":             v.CMFLengths,
+		"ma_lengths":              v.MALengths,
+		"relative_volume_lengths": v.RelativeVolumeLengths,
+	}
+
+	for name, l := range lengths {
+		if err := validateLengths(l); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateLengths(lengths []int) error {
+
+	for _, length := range lengths {
+		if length < 1 {
+			return fmt.Errorf("invalid length: %d", length)
+		}
+	}
+
+	return nil
+}
+
+// computeCacheLength returns the number of ohlc to keep in cache for each
+// period so that every configured indicator has its full window available.
+func (m *metricsConf) computeCacheLength() int {
+
+	length := m.LengthMax
+
+	if m.Oscillators != nil {
+
+		if s := m.Oscillators.Stochastic; s != nil {
+			ks, ds := maxInt(s.KSmoothing, 1), maxInt(s.DSmoothing, 1)
+			for _, l := range s.Lengths {
+				length = maxInt(length, l+ks+ds-2)
+			}
+		}
+
+		if w := m.Oscillators.WilliamsR; w != nil {
+			for _, l := range w.Lengths {
+				length = maxInt(length, l)
+			}
+		}
+
+		if c := m.Oscillators.CCI; c != nil {
+			for _, l := range c.Lengths {
+				length = maxInt(length, l)
+			}
+		}
+	}
+
+	if m.Trend != nil {
+
+		if i := m.Trend.Ichimoku; i != nil {
+			length = maxInt(length, maxInt(i.Tenkan, maxInt(i.Kijun, i.SenkouB)))
+		}
+
+		if a := m.Trend.ADX; a != nil {
+			for _, l := range a.Lengths {
+				length = maxInt(length, l+1)
+			}
+		}
+	}
+
+	if v := m.Volume; v != nil {
+
+		for _, l := range v.MFILengths {
+			length = maxInt(length, l+1)
+		}
+
+		for _, l := range v.CMFLengths {
+			length = maxInt(length, l)
+		}
+
+		for _, l := range v.MALengths {
+			length = maxInt(length, l)
+		}
+
+		for _, l := range v.RelativeVolumeLengths {
+			length = maxInt(length, l+1)
+		}
+	}
+
+	if m.Renko != nil {
+		length = maxInt(length, m.Renko.ATRLength+1)
+	}
+
+	return length
+}
+
+func maxInt(a, b int) int {
+
+	if a > b {
+		return a
+	}
+	return b
+}
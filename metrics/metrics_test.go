@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// the tests run on the sources and periods of conf.json
+const testExchange = "poloniex"
+
+var testStart = time.Date(2017, 10, 2, 0, 0, 0, 0, time.UTC).UnixNano()
+
+// newTestIndicator returns an indicator of period over count intervals from
+// testStart, the caches being reset.
+func newTestIndicator(period time.Duration, count int) *indicator {
+
+	initCachedMetrics()
+
+	ind := &indicator{
+		period:     period,
+		dataSource: conf.Metrics.Sources[testExchange],
+		exchange:   testExchange,
+		nextRun:    testStart + int64(count)*int64(period),
+	}
+
+	for i := 0; i < count; i++ {
+		ind.timeIntervals = append(ind.timeIntervals,
+			testStart+int64(i)*int64(period))
+	}
+
+	return ind
+}
+
+// setTestOHLC caches candles of market for period, the first one starting at
+// testStart - offset periods.
+func setTestOHLC(period time.Duration, offset int, market string,
+	candles []*ohlc) map[int64]map[string]*ohlc {
+
+	imohlc := make(map[int64]map[string]*ohlc, len(candles))
+
+	for i, c := range candles {
+		interval := testStart + int64(i-offset)*int64(period)
+		imohlc[interval] = map[string]*ohlc{market: c}
+	}
+
+	cm[testExchange][period].lastImohlc = imohlc
+
+	return imohlc
+}
+
+// setTestFields caches the fields of the interval preceding the first one of
+// ind (none if mfields is empty).
+func setTestFields(ind *indicator, mfields map[string]indicatorFields) {
+
+	seedInterval := ind.timeIntervals[0] - int64(ind.period)
+
+	cm[testExchange][ind.period].lastFields =
+		map[string]map[int64]map[string]indicatorFields{
+			ind.destination: {seedInterval: mfields},
+		}
+}
+
+// newTestOHLC returns a candle with its derived fields.
+func newTestOHLC(open, high, low, close, volume float64) *ohlc {
+
+	o := &ohlc{
+		volume:   volume,
+		quantity: volume / close,
+		open:     open,
+		high:     high,
+		low:      low,
+		close:    close,
+	}
+	o.setDerivedFields()
+
+	return o
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+func TestComputeCacheLength(t *testing.T) {
+
+	tests := []struct {
+		name string
+		conf *metricsConf
+		want int
+	}{
+		{"length max", &metricsConf{LengthMax: 10}, 10},
+		{
+			name: "smoothed stochastic",
+			conf: &metricsConf{LengthMax: 10, Oscillators: &oscillatorsConf{
+				Stochastic: &stochasticConf{[]int{14}, 3, 3},
+			}},
+			want: 18,
+		},
+		{
+			name: "unsmoothed stochastic",
+			conf: &metricsConf{LengthMax: 10, Oscillators: &oscillatorsConf{
+				Stochastic: &stochasticConf{[]int{14}, 0, 0},
+			}},
+			want: 14,
+		},
+		{
+			name: "adx and mfi lookback",
+			conf: &metricsConf{
+				Trend:  &trendConf{ADX: &lengthsConf{[]int{14}}},
+				Volume: &volumeConf{MFILengths: []int{20}},
+			},
+			want: 21,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.conf.computeCacheLength(); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMetricsConfLengths(t *testing.T) {
+
+	tests := []struct {
+		conf  string
+		valid bool
+	}{
+		{`"oscillators": {"stochastic": {"lengths": [14], "k_smoothing": 3}}`,
+			true},
+		{`"oscillators": {"stochastic": {"lengths": [0]}}`, false},
+		{`"oscillators": {"williams_r": {"lengths": [14, -1]}}`, false},
+		{`"oscillators": {"cci": {"lengths": [0]}}`, false},
+		{`"trend": {"ichimoku": {"tenkan": 9, "kijun": 26, "senkou_b": 52}}`,
+			true},
+		{`"trend": {"ichimoku": {"tenkan": 9, "kijun": 0, "senkou_b": 52}}`,
+			false},
+		{`"trend": {"adx": {"lengths": [0]}}`, false},
+		{`"trend": {"parabolic_sar": {"start": 0.02, "step": 0.02, "max": 0.2}}`,
+			true},
+		{`"trend": {"parabolic_sar": {"start": 0.02, "step": 0, "max": 0.2}}`,
+			false},
+		{`"trend": {"parabolic_sar": {"start": 0.2, "step": 0.02, "max": 0.1}}`,
+			false},
+		{`"volume": {"mfi_lengths": [14], "cmf_lengths": [20]}`, true},
+		{`"volume": {"mfi_lengths": [0]}`, false},
+		{`"volume": {"cmf_lengths": [-20]}`, false},
+		{`"volume": {"ma_lengths": [10, 0]}`, false},
+		{`"volume": {"relative_volume_lengths": [0]}`, false},
+		{`"book_heatmap": {"range_percent": 5, "step_percent": 0.1}`, true},
+		{`"book_heatmap": {"range_percent": 5, "step_percent": 0}`, false},
+		{`"book_heatmap": {"range_percent": -5, "step_percent": 0.1}`, false},
+		{`"renko": {"atr_length": 14}`, true},
+		{`"renko": {"atr_length": 0, "brick_sizes": {"USDT_BTC": 50}}`, false},
+		{`"anomalies": {"window": 120, "return_z_threshold": 4,
+			"volume_z_threshold": 4, "end_z_threshold": 2}`, true},
+		{`"anomalies": {"window": 1, "return_z_threshold": 4,
+			"volume_z_threshold": 4, "end_z_threshold": 2}`, false},
+		{`"anomalies": {"window": 120, "return_z_threshold": 4,
+			"volume_z_threshold": 0, "end_z_threshold": 2}`, false},
+		{`"anomalies": {"window": 120, "return_z_threshold": 4,
+			"volume_z_threshold": 2, "end_z_threshold": 2}`, false},
+	}
+
+	for _, tt := range tests {
+
+		data := `{"frequency": "10s", ` + tt.conf + `}`
+
+		var m metricsConf
+		if err := json.Unmarshal([]byte(data), &m); (err == nil) != tt.valid {
+			t.Errorf("%s: got error %v, want valid %t", tt.conf, err, tt.valid)
+		}
+	}
+}
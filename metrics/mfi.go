@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"fmt"
+)
+
+func getMFI(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "mfi")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeMFI(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeMFI: no result")
+	}
+
+	prepareFieldsPoints(ind, "MFI", imfields)
+
+	return ind, nil
+}
+
+// computeMFI computes the money flow index, the raw money flow of a period
+// being its volume (as for the Chaikin money flow and the A/D line) signed by
+// the change of its typical price (high + low + close) / 3. Without any flow
+// the index is neutral (50).
+func computeMFI(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	lengths := conf.Metrics.Volume.MFILengths
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	typicalPrice := func(ohlc *ohlc) float64 {
+		return (ohlc.high + ohlc.low + ohlc.close) / 3
+	}
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, _ := range imohlc[interval] {
+
+			fields := make(indicatorFields, len(lengths))
+
+			for _, length := range lengths {
+
+				window := getOHLCWindow(imohlc, ind.period, interval, market,
+					length+1)
+				if window == nil {
+					continue
+				}
+
+				positiveFlow, negativeFlow := 0.0, 0.0
+
+				for i := 1; i < len(window); i++ {
+
+					tp, prevTp := typicalPrice(window[i]), typicalPrice(window[i-1])
+
+					if tp > prevTp {
+						positiveFlow += window[i].volume
+
+					} else if tp < prevTp {
+						negativeFlow += window[i].volume
+					}
+				}
+
+				mfi := 50.0
+				if negativeFlow != 0.0 {
+					mfi = 100.0 - 100.0/(1+positiveFlow/negativeFlow)
+				} else if positiveFlow != 0.0 {
+					mfi = 100.0
+				}
+
+				fields[fmt.Sprintf("mfi_%d", length)] = mfi
+			}
+
+			imfields[interval][market] = fields
+		}
+	}
+
+	return imfields
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeMFI(t *testing.T) {
+
+	defer func(v *volumeConf) { conf.Metrics.Volume = v }(conf.Metrics.Volume)
+	conf.Metrics.Volume = &volumeConf{MFILengths: []int{2, 3}}
+
+	tests := []struct {
+		name    string
+		candles []*ohlc
+		want    indicatorFields
+	}{
+		{
+			// typical prices 9, 10 then 9: positive flow 20, negative flow 27
+			name: "up then down",
+			candles: []*ohlc{
+				{high: 10, low: 8, close: 9, volume: 9},
+				{high: 11, low: 9, close: 10, volume: 20},
+				{high: 10, low: 8, close: 9, volume: 27},
+			},
+			want: indicatorFields{"mfi_2": 100 * 20.0 / 47},
+		},
+		{
+			name: "no negative flow",
+			candles: []*ohlc{
+				{high: 10, low: 8, close: 9, volume: 9},
+				{high: 10, low: 8, close: 9, volume: 9},
+				{high: 11, low: 9, close: 10, volume: 20},
+				{high: 12, low: 10, close: 11, volume: 33},
+			},
+			want: indicatorFields{"mfi_2": 100, "mfi_3": 100},
+		},
+		{
+			name: "no flow",
+			candles: []*ohlc{
+				{high: 10, low: 8, close: 9, volume: 9},
+				{high: 10, low: 8, close: 9, volume: 9},
+				{high: 10, low: 8, close: 9, volume: 9},
+			},
+			want: indicatorFields{"mfi_2": 50},
+		},
+	}
+
+	for _, tt := range tests {
+
+		ind := newTestIndicator(time.Minute, 1)
+		setTestOHLC(ind.period, len(tt.candles)-1, "BTC_ETH", tt.candles)
+
+		got := computeMFI(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
@@ -1,68 +1,180 @@
 package metrics
 
 import (
+	"fmt"
 	"time"
+	"trading/networking"
 	"trading/networking/database"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
 )
 
-func getOBV(from *indicator) {
+type obv struct {
+	obv float64
+	ad  float64
+}
 
-	ind := &indicator{
-		nextRun:     from.nextRun,
-		period:      conf.Metrics.OhlcPeriods[from.indexPeriod],
-		indexPeriod: from.indexPeriod,
-		dataSource:  from.dataSource,
-		source:      from.destination,
-		destination: "obv_" + conf.Metrics.OhlcPeriodsStr[from.indexPeriod],
-		exchange:    from.exchange,
-	}
+func getOBV(from *indicator) (*indicator, error) {
 
-	ind.computeTimeIntervals(1)
+	ind := deriveIndicator(from, "obv")
+
+	ind.computeTimeIntervals(0)
 
 	imobv := computeOBV(ind)
+	if imobv == nil {
+		return nil, fmt.Errorf("computeOBV: no result")
+	}
+
+	updateCacheLastOBV(ind, imobv)
 	prepareOBVPoints(ind, imobv)
+
+	return ind, nil
 }
 
-func computeOBV(ind *indicator) map[int64]map[string]float64 {
+// computeOBV accumulates the on-balance volume (volume signed by the close
+// price direction) and the accumulation/distribution line (volume weighted
+// by the close location within the bucket range) for each time interval,
+// starting from the last values computed before the first interval.
+func computeOBV(ind *indicator) map[int64]map[string]*obv {
 
 	imohlc := getCachedLastOHLC(ind)
 	if imohlc == nil {
 		return nil
 	}
 
-	imobv := make(map[int64]map[string]float64, len(ind.timeIntervals))
+	lastMobv := getLastMobv(ind)
+	if lastMobv == nil {
+		return nil
+	}
+
+	imobv := make(map[int64]map[string]*obv, len(ind.timeIntervals))
 
 	for _, interval := range ind.timeIntervals {
 
-		imobv[interval] = make(map[string]float64, len(imohlc[interval]))
+		imobv[interval] = make(map[string]*obv, len(imohlc[interval]))
 
 		for market, ohlc := range imohlc[interval] {
 
-			if prevOhlc, ok := imohlc[interval-int64(ind.period)][market]; ok {
-
-				obvValue := 0.0
+			obvVal := &obv{}
+			if last, ok := lastMobv[market]; ok {
+				*obvVal = *last
+			}
 
-				if ohlc.volume > prevOhlc.volume {
-					obvValue = prevOhlc.volume + ohlc.volume
+			if prevOhlc, ok := imohlc[interval-int64(ind.period)][market]; ok {
 
-				} else if ohlc.volume == prevOhlc.volume {
-					obvValue = ohlc.volume
+				if ohlc.close > prevOhlc.close {
+					obvVal.obv += ohlc.volume
 
-				} else {
-					obvValue = prevOhlc.volume - ohlc.volume
+				} else if ohlc.close < prevOhlc.close {
+					obvVal.obv -= ohlc.volume
 				}
+			}
 
-				imobv[interval][market] = obvValue
+			if ohlc.high != ohlc.low {
+				clv := ((ohlc.close - ohlc.low) - (ohlc.high - ohlc.close)) /
+					(ohlc.high - ohlc.low)
+				obvVal.ad += clv * ohlc.volume
 			}
+
+			imobv[interval][market] = obvVal
+			lastMobv[market] = obvVal
 		}
 	}
 
 	return imobv
 }
 
-func prepareOBVPoints(ind *indicator, imobv map[int64]map[string]float64) {
+// getLastMobv returns the obv values of each market preceding the first time
+// interval, from cache if available or from the last persisted values.
+func getLastMobv(ind *indicator) map[string]*obv {
+
+	seedInterval := ind.timeIntervals[0] - int64(ind.period)
+
+	if lastImobv := getCachedLastOBV(ind); lastImobv != nil {
+		if mobv, ok := lastImobv[seedInterval]; ok {
+			return copyMobv(mobv)
+		}
+	}
+
+	query := fmt.Sprintf(
+		`SELECT obv, ad
+    FROM %s
+    WHERE time <= %d AND exchange = '%s'
+    GROUP BY market
+    ORDER BY time DESC
+    LIMIT 1`,
+		ind.destination,
+		seedInterval,
+		ind.exchange)
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, conf.Metrics.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   ind.period,
+		ErrorMsg: "getLastMobv: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil
+	}
+
+	mobv := make(map[string]*obv, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+		obvRec := serie.Values[0]
+
+		if obvRec[1] == nil || obvRec[2] == nil {
+			continue
+		}
+
+		obvValue, err := networking.ConvertJsonValueToFloat64(obvRec[1])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": ind.exchange,
+				"market":   market,
+			}).Error("getLastMobv: networking.ConvertJsonValueToFloat64")
+			continue
+		}
+
+		ad, err := networking.ConvertJsonValueToFloat64(obvRec[2])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": ind.exchange,
+				"market":   market,
+			}).Error("getLastMobv: networking.ConvertJsonValueToFloat64")
+			continue
+		}
+
+		mobv[market] = &obv{obvValue, ad}
+	}
+
+	return mobv
+}
+
+func copyMobv(mobv map[string]*obv) map[string]*obv {
+
+	res := make(map[string]*obv, len(mobv))
+	for market, obvVal := range mobv {
+		res[market] = &obv{obvVal.obv, obvVal.ad}
+	}
+
+	return res
+}
+
+func prepareOBVPoints(ind *indicator, imobv map[int64]map[string]*obv) {
 
 	measurement := ind.destination
 	points := make([]*ifxClient.Point, 0)
@@ -79,7 +191,8 @@ func prepareOBVPoints(ind *indicator, imobv map[int64]map[string]float64) {
 			}
 
 			fields := map[string]interface{}{
-				"obv": obv,
+				"obv": obv.obv,
+				"ad":  obv.ad,
 			}
 
 			pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
@@ -91,13 +204,5 @@ func prepareOBVPoints(ind *indicator, imobv map[int64]map[string]float64) {
 		}
 	}
 
-	if len(points) == 0 {
-		return
-	}
-
-	batchsToWrite <- &database.BatchPoints{
-		TypePoint: ind.exchange + "OBV",
-		Points:    points,
-		Callback:  ind.callback,
-	}
+	sendBatchPoints(ind, "OBV", points)
 }
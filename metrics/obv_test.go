@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeOBV(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		seed    *obv
+		candles []*ohlc // from the interval preceding the first one
+		want    []obv
+	}{
+		{
+			name: "close up then down",
+			seed: &obv{10, 5},
+			candles: []*ohlc{
+				newTestOHLC(10, 10, 10, 10, 50),
+				newTestOHLC(10, 12, 9, 11, 100),
+				newTestOHLC(11, 11, 10, 10.25, 40),
+			},
+			// clv of the first candle: ((11-9) - (12-11)) / (12-9)
+			want: []obv{{110, 5 + 100.0/3}, {70, 5 + 100.0/3 - 40.0/2}},
+		},
+		{
+			name: "unchanged close, flat range",
+			seed: &obv{10, 5},
+			candles: []*ohlc{
+				newTestOHLC(10, 10, 10, 10, 50),
+				newTestOHLC(10, 10, 10, 10, 100),
+			},
+			want: []obv{{10, 5}},
+		},
+		{
+			name: "close at high without seed",
+			candles: []*ohlc{
+				newTestOHLC(10, 10, 10, 10, 50),
+				newTestOHLC(10, 12, 9, 12, 100),
+			},
+			want: []obv{{100, 100}},
+		},
+	}
+
+	for _, tt := range tests {
+
+		ind := newTestIndicator(time.Minute, len(tt.want))
+		setTestOHLC(ind.period, 1, "BTC_ETH", tt.candles)
+
+		seedInterval := testStart - int64(ind.period)
+		mobv := map[string]*obv{}
+		if tt.seed != nil {
+			mobv["BTC_ETH"] = tt.seed
+		}
+		cm[testExchange][ind.period].lastImobv =
+			map[string]map[int64]map[string]*obv{"": {seedInterval: mobv}}
+
+		imobv := computeOBV(ind)
+
+		for i, want := range tt.want {
+
+			got := imobv[ind.timeIntervals[i]]["BTC_ETH"]
+			if got == nil || !approxEqual(got.obv, want.obv) ||
+				!approxEqual(got.ad, want.ad) {
+				t.Errorf("%s: interval %d: got %+v, want %+v",
+					tt.name, i, got, want)
+			}
+		}
+	}
+}
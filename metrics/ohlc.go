@@ -21,41 +21,109 @@ type ohlc struct {
 	close           float64
 	change          float64
 	changePercent   float64
+	filled          bool
+	traded          int64
+}
+
+// lastTrade is the close of a market and the start of the last bucket in
+// which it traded.
+type lastTrade struct {
+	close  float64
+	traded int64
+}
+
+// newFilledOHLC returns the candle of a bucket without trades, flat at the
+// last close and carrying the bucket of the last trade.
+func newFilledOHLC(last *lastTrade) *ohlc {
+
+	return &ohlc{0.0, 0.0, 0.0, last.close, last.close, last.close,
+		last.close, 0.0, 0.0, true, last.traded}
+}
+
+// lastTrade returns the last trade known at the candle of interval.
+func (o *ohlc) lastTrade(interval int64) *lastTrade {
+
+	if o.filled {
+		return &lastTrade{o.close, o.traded}
+	}
+
+	return &lastTrade{o.close, interval}
+}
+
+// fillGap returns the candle of a bucket without trades of a market last
+// traded at last, nil once that trade is older than the gap lookback.
+func fillGap(dataSource *exchangeConf, interval int64,
+	last *lastTrade) *ohlc {
+
+	if interval-last.traded > int64(dataSource.GapLookback) {
+		return nil
+	}
+
+	return newFilledOHLC(last)
 }
 
 func computeBaseOHLC() {
 
 	indexPeriod := 0
 
-	for exchange, _ := range conf.Metrics.Sources {
+	for exchange, dataSource := range conf.Metrics.Sources {
 
-		ind := &indicator{
-			period:      conf.Metrics.OhlcPeriods[indexPeriod],
-			indexPeriod: indexPeriod,
-			dataSource:  conf.Metrics.Sources[exchange],
-			destination: "ohlc_" + conf.Metrics.OhlcPeriodsStr[indexPeriod],
-			exchange:    exchange,
-		}
+		exchange, dataSource := exchange, dataSource
+		lt := &lateTrades{}
 
 		go networking.RunEvery(conf.Metrics.Frequency, func(nextRun int64) {
 
-			ind.nextRun = nextRun
-			ind.computeTimeIntervals(0)
+			ind := &indicator{
+				nextRun:     nextRun,
+				period:      conf.Metrics.OhlcPeriods[indexPeriod],
+				indexPeriod: indexPeriod,
+				dataSource:  dataSource,
+				destination: "ohlc_" + conf.Metrics.OhlcPeriodsStr[indexPeriod],
+				exchange:    exchange,
+			}
 
-			imohlc := getOHLCFromTrades(ind)
-			updateCacheLastOHLC(ind, imohlc)
-			triggerDependencies(ind)
-			prepareOHLCPoints(ind, imohlc)
+			ind.dirtySince = lt.getDirtySince(ind)
+			metricsDAG.run(ind)
+			logOverrun(ind, conf.Metrics.Frequency)
 		})
 	}
 }
 
-func computeOHLC(from *indicator) {
+// getBaseOHLC computes the ohlc of the base period from trades (or uses the
+// closed buckets provided by a backfill or the streaming), root of the
+// metrics graph.
+func getBaseOHLC(ind *indicator) (*indicator, error) {
+
+	ind.computeTimeIntervals(0)
+
+	imohlc := ind.prefetched
+
+	// buckets having received late trades are recomputed from trades
+	if imohlc == nil || ind.dirtySince != 0 {
+
+		if imohlc = getOHLCFromTrades(ind); imohlc == nil {
+			return nil, fmt.Errorf("getOHLCFromTrades: no result")
+		}
+
+		for interval, mohlc := range ind.prefetched {
+			imohlc[interval] = mohlc
+		}
+	}
+
+	updateCacheLastOHLC(ind, imohlc)
+	prepareOHLCPoints(ind, imohlc)
+
+	return ind, nil
+}
+
+func computeOHLC(from *indicator) (*indicator, error) {
 
 	indexPeriod := from.indexPeriod + 1
 
-	if len(conf.Metrics.OhlcPeriods) <= indexPeriod {
-		return
+	// backfills only compute closed buckets
+	if from.step != nil &&
+		from.nextRun%int64(conf.Metrics.OhlcPeriods[indexPeriod]) != 0 {
+		return nil, nil
 	}
 
 	ind := &indicator{
@@ -66,15 +134,27 @@ func computeOHLC(from *indicator) {
 		source:      "ohlc_" + conf.Metrics.OhlcPeriodsStr[from.indexPeriod],
 		destination: "ohlc_" + conf.Metrics.OhlcPeriodsStr[indexPeriod],
 		exchange:    from.exchange,
+		markets:     from.markets,
+		dirtySince:  from.dirtySince,
+		step:        from.step,
 	}
 
 	ind.computeTimeIntervals(0)
 
 	subimohlc := getCachedLastOHLC(from)
+	if subimohlc == nil {
+		return nil, fmt.Errorf("getCachedLastOHLC: no result")
+	}
+
 	imohlc := make(map[int64]map[string]*ohlc, len(ind.timeIntervals))
 
 	for _, interval := range ind.timeIntervals {
 
+		// late trades may reach buckets whose sub ohlc are no longer cached
+		if _, ok := subimohlc[interval]; !ok {
+			continue
+		}
+
 		imohlc[interval] = make(map[string]*ohlc)
 
 		for subi := interval; subi < interval+int64(ind.period) &&
@@ -82,11 +162,18 @@ func computeOHLC(from *indicator) {
 
 			for market, subohlc := range subimohlc[subi] {
 
+				// seeding from the first sub ohlc of the interval
 				if _, ok := imohlc[interval][market]; !ok {
-					imohlc[interval][market] = &ohlc{}
+					imohlc[interval][market] = &ohlc{
+						open:   subohlc.open,
+						high:   subohlc.high,
+						low:    subohlc.low,
+						filled: true,
+					}
 				}
 				ohlcVal := imohlc[interval][market]
 
+				ohlcVal.filled = ohlcVal.filled && subohlc.filled
 				ohlcVal.volume += subohlc.volume
 				ohlcVal.quantity += subohlc.quantity
 
@@ -98,6 +185,7 @@ func computeOHLC(from *indicator) {
 				ohlcVal.high = math.Max(ohlcVal.high, subohlc.high)
 				ohlcVal.low = math.Min(ohlcVal.low, subohlc.low)
 				ohlcVal.close = subohlc.close
+				ohlcVal.traded = subohlc.traded
 				ohlcVal.change = ohlcVal.close - ohlcVal.open
 
 				ohlcVal.changePercent = 0.0
@@ -109,15 +197,59 @@ func computeOHLC(from *indicator) {
 	}
 
 	updateCacheLastOHLC(ind, imohlc)
-	triggerDependencies(ind)
 	prepareOHLCPoints(ind, imohlc)
+
+	return ind, nil
+}
+
+// setDerivedFields sets the weighted average and the changes from the
+// volume, quantity, open and close.
+func (o *ohlc) setDerivedFields() {
+
+	o.weightedAverage = 0.0
+	if o.quantity != 0.0 {
+		o.weightedAverage = o.volume / o.quantity
+	}
+
+	o.change = o.close - o.open
+
+	o.changePercent = 0.0
+	if o.open != 0.0 {
+		o.changePercent = o.change * 100 / o.open
+	}
+}
+
+// getOHLCWindow returns the length ohlc of market ending at interval (oldest
+// first), or nil if any of them is missing.
+func getOHLCWindow(imohlc map[int64]map[string]*ohlc, period time.Duration,
+	interval int64, market string, length int) []*ohlc {
+
+	window := make([]*ohlc, length)
+
+	for i := 0; i < length; i++ {
+
+		offset := interval - int64(length-1-i)*int64(period)
+
+		ohlc, ok := imohlc[offset][market]
+		if !ok {
+			return nil
+		}
+		window[i] = ohlc
+	}
+
+	return window
 }
 
-func triggerDependencies(ind *indicator) {
-	go computeOHLC(ind)
-	go getOBV(ind)
-	go getMA(ind)
-	go getRSI(ind)
+func highestHighLowestLow(window []*ohlc) (float64, float64) {
+
+	high, low := window[0].high, window[0].low
+
+	for _, ohlc := range window[1:] {
+		high = math.Max(high, ohlc.high)
+		low = math.Min(low, ohlc.low)
+	}
+
+	return high, low
 }
 
 func getOHLCFromTrades(ind *indicator) map[int64]map[string]*ohlc {
@@ -130,22 +262,27 @@ func getOHLCFromTrades(ind *indicator) map[int64]map[string]*ohlc {
       MIN(rate) AS low,
       LAST(rate) AS close
     FROM %s
-    WHERE time >= %d AND time < %d
+    WHERE time >= %d AND time < %d%s
     GROUP BY time(%s), market;`,
 		ind.dataSource.Schema["trades_measurement"],
-		ind.timeIntervals[0], ind.nextRun,
+		ind.timeIntervals[0], ind.nextRun, ind.marketsCondition(),
 		ind.period)
 
+	// last close preceding the first bucket, so that recomputing past buckets
+	// fills them as they were live
 	subQuery2 := fmt.Sprintf(
-		`SELECT last
+		`SELECT LAST(rate)
     FROM %s
-    WHERE time >= now() - 1h
-    GROUP BY market
-    ORDER BY time DESC
-    LIMIT 1`,
-		ind.dataSource.Schema["ticks_measurement"])
+    WHERE time >= %d AND time < %d%s
+    GROUP BY market`,
+		ind.dataSource.Schema["trades_measurement"],
+		ind.timeIntervals[0]-int64(ind.dataSource.GapLookback),
+		ind.timeIntervals[0], ind.marketsCondition())
 
-	query := subQuery1 + subQuery2
+	query := subQuery1
+	if ind.dataSource.GapPolicy != gapEmpty {
+		query += subQuery2
+	}
 
 	var res []ifxClient.Result
 
@@ -167,7 +304,9 @@ func getOHLCFromTrades(ind *indicator) map[int64]map[string]*ohlc {
 	}
 
 	imohlc := formatOHLC(ind, res)
-	addLastIfNoVolume(ind, res, imohlc)
+	if ind.dataSource.GapPolicy != gapEmpty {
+		fillGaps(ind, res, imohlc)
+	}
 
 	return imohlc
 }
@@ -302,55 +441,141 @@ func formatOHLC(ind *indicator,
 	return imohlc
 }
 
-func addLastIfNoVolume(ind *indicator, res []ifxClient.Result,
+// fillGaps adds a flat candle at the last close for each market without
+// trades in a bucket, as long as its last trade is within the gap lookback.
+func fillGaps(ind *indicator, res []ifxClient.Result,
 	imohlc map[int64]map[string]*ohlc) {
 
-	lastTicks := make(map[string]float64, len(res[1].Series))
+	lastTrades := getLastTrades(ind)
 
 	for _, serie := range res[1].Series {
 
 		market := serie.Tags["market"]
 
-		last, err := networking.ConvertJsonValueToFloat64(serie.Values[0][1])
-		if err != nil {
-			logger.WithFields(logrus.Fields{
-				"error": err,
-			}).Error("formatLasts: networking.ConvertJsonValueToFloat64")
-			continue
+		if last := formatLastTrade(ind, market, serie.Values[0],
+			"fillGaps"); last != nil {
+			lastTrades[market] = last
 		}
-
-		lastTicks[market] = last
 	}
 
 	for _, interval := range ind.timeIntervals {
 
 		mohlc := imohlc[interval]
 
-		for market, last := range lastTicks {
+		for market, ohlc := range mohlc {
+			lastTrades[market] = ohlc.lastTrade(interval)
+		}
+
+		for market, last := range lastTrades {
 
-			if _, ok := mohlc[market]; !ok {
-				mohlc[market] = &ohlc{
-					0.0, 0.0, 0.0, last, last, last, last, 0.0, 0.0,
-				}
+			if _, ok := mohlc[market]; ok {
+				continue
+			}
+
+			if filled := fillGap(ind.dataSource, interval, last); filled != nil {
+				mohlc[market] = filled
 			} else {
-				lastTicks[market] = mohlc[market].close
+				delete(lastTrades, market)
 			}
 		}
+	}
+}
 
-		for _, serie := range res[0].Series {
+// getLastTrades returns the last trade of each market preceding the first
+// time interval, from cache if available or from the last candle with trades
+// written within the gap lookback.
+func getLastTrades(ind *indicator) map[string]*lastTrade {
 
-			market := serie.Tags["market"]
-			last := lastTicks[market]
+	seedInterval := ind.timeIntervals[0] - int64(ind.period)
 
-			if _, ok := mohlc[market]; !ok {
-				mohlc[market] = &ohlc{
-					0.0, 0.0, 0.0, last, last, last, last, 0.0, 0.0,
-				}
-			} else {
-				lastTicks[market] = mohlc[market].close
+	if imohlc := getCachedLastOHLC(ind); imohlc != nil {
+		if mohlc, ok := imohlc[seedInterval]; ok {
+
+			lastTrades := make(map[string]*lastTrade, len(mohlc))
+			for market, ohlc := range mohlc {
+				lastTrades[market] = ohlc.lastTrade(seedInterval)
 			}
+
+			return lastTrades
 		}
 	}
+
+	// filled candles have no volume
+	query := fmt.Sprintf(
+		`SELECT LAST(close)
+    FROM %s
+    WHERE time >= %d AND time < %d AND volume > 0 AND exchange = '%s'%s
+    GROUP BY market`,
+		ind.destination,
+		ind.timeIntervals[0]-int64(ind.dataSource.GapLookback),
+		ind.timeIntervals[0], ind.exchange, ind.marketsCondition())
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, conf.Metrics.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   ind.period,
+		ErrorMsg: "getLastTrades: database.QueryDB",
+		Request:  request,
+	})
+
+	lastTrades := make(map[string]*lastTrade)
+
+	if !success {
+		return lastTrades
+	}
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+
+		if last := formatLastTrade(ind, market, serie.Values[0],
+			"getLastTrades"); last != nil {
+			lastTrades[market] = last
+		}
+	}
+
+	return lastTrades
+}
+
+// formatLastTrade returns the last trade of a LAST() record, its time being
+// truncated to the bucket, or nil if the record can't be converted.
+func formatLastTrade(ind *indicator, market string, rec []interface{},
+	caller string) *lastTrade {
+
+	if rec[0] == nil || rec[1] == nil {
+		return nil
+	}
+
+	timestamp, err := networking.ConvertJsonValueToTime(rec[0])
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"exchange": ind.exchange,
+			"market":   market,
+		}).Error(caller + ": networking.ConvertJsonValueToTime")
+		return nil
+	}
+
+	last, err := networking.ConvertJsonValueToFloat64(rec[1])
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"exchange": ind.exchange,
+			"market":   market,
+		}).Error(caller + ": networking.ConvertJsonValueToFloat64")
+		return nil
+	}
+
+	traded := timestamp.UnixNano()
+
+	return &lastTrade{last, traded - traded%int64(ind.period)}
 }
 
 func prepareOHLCPoints(ind *indicator, imohlc map[int64]map[string]*ohlc) {
@@ -358,6 +583,17 @@ func prepareOHLCPoints(ind *indicator, imohlc map[int64]map[string]*ohlc) {
 	measurement := ind.destination
 	points := make([]*ifxClient.Point, 0)
 
+	var start, end int64
+	for interval := range imohlc {
+		if start == 0 || interval < start {
+			start = interval
+		}
+		if interval+int64(ind.period) > end {
+			end = interval + int64(ind.period)
+		}
+	}
+	rates := getUSDRates(start, end)
+
 	for interval, mohlc := range imohlc {
 
 		timestamp := time.Unix(0, interval)
@@ -381,6 +617,15 @@ func prepareOHLCPoints(ind *indicator, imohlc map[int64]map[string]*ohlc) {
 				"change_percent":   ohlc.changePercent,
 			}
 
+			if ind.dataSource.GapPolicy == gapMark {
+				fields["is_filled"] = ohlc.filled
+			}
+
+			if volumeUSD, ok := rates.usd(ind.exchange, market, ohlc.volume,
+				interval); ok {
+				fields["volume_usd"] = volumeUSD
+			}
+
 			pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
 			if err != nil {
 				logger.WithField("error", err).Error(
@@ -390,13 +635,5 @@ func prepareOHLCPoints(ind *indicator, imohlc map[int64]map[string]*ohlc) {
 		}
 	}
 
-	if len(points) == 0 {
-		return
-	}
-
-	batchsToWrite <- &database.BatchPoints{
-		TypePoint: ind.exchange + "OHLC",
-		Points:    points,
-		Callback:  ind.callback,
-	}
+	sendBatchPoints(ind, "OHLC", points)
 }
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
+)
+
+func TestFillGaps(t *testing.T) {
+
+	ind := newTestIndicator(time.Minute, 3)
+
+	source := *ind.dataSource
+	source.GapLookback = 2 * time.Minute
+	ind.dataSource = &source
+
+	// cached closes of the interval preceding the first one
+	imohlc := setTestOHLC(ind.period, 1, "BTC_ETH", []*ohlc{
+		newTestOHLC(10, 10, 10, 10, 10),
+	})
+	imohlc[testStart-int64(ind.period)]["BTC_XMR"] =
+		newTestOHLC(0.02, 0.02, 0.02, 0.02, 1)
+
+	// last trades within the gap lookback
+	at := func(offset time.Duration) string {
+		return time.Unix(0, testStart).Add(offset).UTC().Format(time.RFC3339)
+	}
+	res := []ifxClient.Result{{}, {Series: []models.Row{
+		{
+			Tags:   map[string]string{"market": "BTC_ETH"},
+			Values: [][]interface{}{{at(-30 * time.Second), json.Number("10.5")}},
+		},
+		{
+			Tags:   map[string]string{"market": "BTC_LTC"},
+			Values: [][]interface{}{{at(-2 * time.Minute), json.Number("0.01")}},
+		},
+	}}}
+
+	got := map[int64]map[string]*ohlc{
+		ind.timeIntervals[0]: {"BTC_ETH": newTestOHLC(10.5, 11, 10.5, 11, 10)},
+		ind.timeIntervals[1]: {},
+		ind.timeIntervals[2]: {"BTC_XMR": newTestOHLC(0.02, 0.03, 0.02, 0.03, 1)},
+	}
+
+	fillGaps(ind, res, got)
+
+	// BTC_LTC last traded more than the gap lookback before the second one
+	want := []map[string]float64{
+		{"BTC_ETH": 11, "BTC_XMR": 0.02, "BTC_LTC": 0.01},
+		{"BTC_ETH": 11, "BTC_XMR": 0.02},
+		{"BTC_ETH": 11, "BTC_XMR": 0.03},
+	}
+	traded := []string{"BTC_ETH", "", "BTC_XMR"}
+
+	for i, interval := range ind.timeIntervals {
+
+		if len(got[interval]) != len(want[i]) {
+			t.Errorf("interval %d: got %d markets, want %d", i,
+				len(got[interval]), len(want[i]))
+		}
+
+		for market, close := range want[i] {
+
+			o := got[interval][market]
+			if o == nil || o.close != close || o.filled != (market != traded[i]) {
+				t.Errorf("interval %d: %s: got %+v, want close %v", i, market, o,
+					close)
+			}
+		}
+	}
+
+	// filled candles keep the bucket of the last trade
+	if o := got[ind.timeIntervals[2]]["BTC_ETH"]; o.traded != testStart {
+		t.Errorf("filled: got traded %d, want %d", o.traded, testStart)
+	}
+}
+
+func TestComputeOHLC(t *testing.T) {
+
+	from := newTestIndicator(time.Minute, 0)
+	from.indexPeriod = 0
+	// 2 minutes into the 5m bucket starting at testStart
+	from.nextRun = testStart + int64(2*time.Minute)
+
+	setTestOHLC(time.Minute, 0, "BTC_ETH", []*ohlc{
+		newTestOHLC(10, 11, 9.5, 10.5, 100),
+		newTestOHLC(10.5, 12, 10, 11, 50),
+	})
+	cm[testExchange][5*time.Minute].lastImohlc =
+		make(map[int64]map[string]*ohlc)
+
+	if _, err := computeOHLC(from); err != nil {
+		t.Fatalf("computeOHLC: %v", err)
+	}
+
+	got := cm[testExchange][5*time.Minute].lastImohlc[testStart]["BTC_ETH"]
+	want := newTestOHLC(10, 12, 9.5, 11, 150)
+
+	if got == nil || got.open != want.open || got.high != want.high ||
+		got.low != want.low || got.close != want.close ||
+		got.volume != want.volume || !approxEqual(got.change, want.change) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
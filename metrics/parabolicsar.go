@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+)
+
+func getParabolicSAR(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "parabolic_sar")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeParabolicSAR(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeParabolicSAR: no result")
+	}
+
+	updateCacheLastFields(ind, imfields)
+	prepareFieldsPoints(ind, "ParabolicSAR", imfields)
+
+	return ind, nil
+}
+
+// computeParabolicSAR computes the stop and reverse of each interval. The
+// extreme point (ep), the acceleration factor (af) and the trend (1 for
+// long, -1 for short) are persisted to carry the computation over the next
+// runs. Without previous values the trend is seeded from the last change.
+func computeParabolicSAR(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	lastMfields := getLastMfields(ind, []string{"sar", "ep", "af", "trend"})
+	if lastMfields == nil {
+		return nil
+	}
+
+	sc := conf.Metrics.Trend.ParabolicSAR
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, ohlc := range imohlc[interval] {
+
+			window := getOHLCWindow(imohlc, ind.period, interval, market, 2)
+			if window == nil {
+				continue
+			}
+			prev := window[0]
+
+			lastFields := lastMfields[market]
+			sar, ok1 := lastFields["sar"]
+			ep, ok2 := lastFields["ep"]
+			af, ok3 := lastFields["af"]
+			trend, ok4 := lastFields["trend"]
+
+			if !(ok1 && ok2 && ok3 && ok4) {
+
+				if ohlc.close >= prev.close {
+					trend, sar, ep = 1.0, prev.low, ohlc.high
+				} else {
+					trend, sar, ep = -1.0, prev.high, ohlc.low
+				}
+				af = sc.Start
+
+			} else {
+
+				sar += af * (ep - sar)
+
+				// the sar cannot be set beyond the two previous periods range
+				prev2, hasPrev2 := imohlc[interval-2*int64(ind.period)][market]
+
+				if trend > 0.0 {
+
+					sar = math.Min(sar, prev.low)
+					if hasPrev2 {
+						sar = math.Min(sar, prev2.low)
+					}
+
+					if ohlc.low < sar {
+						trend, sar, ep, af = -1.0, ep, ohlc.low, sc.Start
+
+					} else if ohlc.high > ep {
+						ep = ohlc.high
+						af = math.Min(af+sc.Step, sc.Max)
+					}
+
+				} else {
+
+					sar = math.Max(sar, prev.high)
+					if hasPrev2 {
+						sar = math.Max(sar, prev2.high)
+					}
+
+					if ohlc.high > sar {
+						trend, sar, ep, af = 1.0, ep, ohlc.high, sc.Start
+
+					} else if ohlc.low < ep {
+						ep = ohlc.low
+						af = math.Min(af+sc.Step, sc.Max)
+					}
+				}
+			}
+
+			fields := indicatorFields{
+				"sar":   sar,
+				"ep":    ep,
+				"af":    af,
+				"trend": trend,
+			}
+
+			imfields[interval][market] = fields
+			lastMfields[market] = fields
+		}
+	}
+
+	return imfields
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeParabolicSAR(t *testing.T) {
+
+	defer func(tc *trendConf) { conf.Metrics.Trend = tc }(conf.Metrics.Trend)
+	conf.Metrics.Trend = &trendConf{
+		ParabolicSAR: &parabolicSARConf{Start: 0.02, Step: 0.02, Max: 0.2},
+	}
+
+	tests := []struct {
+		name string
+		last indicatorFields
+		want indicatorFields
+	}{
+		{
+			name: "seeded short on a lower close",
+			want: indicatorFields{"sar": 12, "ep": 9, "af": 0.02, "trend": -1},
+		},
+		{
+			name: "long with a new extreme point",
+			last: indicatorFields{"sar": 8, "ep": 12, "af": 0.02, "trend": 1},
+			want: indicatorFields{"sar": 8.08, "ep": 13, "af": 0.04, "trend": 1},
+		},
+		{
+			name: "short continuing",
+			last: indicatorFields{"sar": 14, "ep": 9, "af": 0.02, "trend": -1},
+			want: indicatorFields{"sar": 13.9, "ep": 9, "af": 0.02, "trend": -1},
+		},
+		{
+			name: "short reversed",
+			last: indicatorFields{"sar": 13, "ep": 9, "af": 0.2, "trend": -1},
+			want: indicatorFields{"sar": 9, "ep": 13, "af": 0.02, "trend": 1},
+		},
+		{
+			// capped by the low of the two previous periods
+			name: "long capped",
+			last: indicatorFields{"sar": 8.5, "ep": 12, "af": 0.2, "trend": 1},
+			want: indicatorFields{"sar": 9, "ep": 13, "af": 0.2, "trend": 1},
+		},
+	}
+
+	for _, tt := range tests {
+
+		ind := newTestIndicator(time.Minute, 1)
+		ind.destination = "parabolic_sar_1m"
+		setTestOHLC(ind.period, 3, "BTC_ETH", testOscillatorCandles)
+
+		mfields := map[string]indicatorFields{}
+		if tt.last != nil {
+			mfields["BTC_ETH"] = tt.last
+		}
+		setTestFields(ind, mfields)
+
+		got := computeParabolicSAR(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
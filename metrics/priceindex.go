@@ -0,0 +1,416 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+	"trading/networking/symbols"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// priceIndexConf computes the price of each asset in quote (canonical
+// currency, markets priced in one of the equivalents count as quote) from
+// the trades of the sources over window and from coinmarketcap. Method is
+// vwap (exchanges weighted by volume, coinmarketcap blended with its weight)
+// or median (of the venues). Venues deviating from the median by more than
+// max_deviation_percent are excluded (3 venues at least).
+type priceIndexConf struct {
+	Frequency           string             `json:"frequency"`
+	Window              string             `json:"window"`
+	Quote               string             `json:"quote"`
+	Equivalents         []string           `json:"equivalents"`
+	Method              string             `json:"method"`
+	MaxDeviationPercent float64            `json:"max_deviation_percent"`
+	Coinmarketcap       *coinmarketcapConf `json:"coinmarketcap"`
+}
+
+// coinmarketcapConf reads field (price_btc, price_usd) of the last ticks
+// within max_age.
+type coinmarketcapConf struct {
+	Schema map[string]string `json:"schema"`
+	Field  string            `json:"field"`
+	MaxAge string            `json:"max_age"`
+	Weight float64           `json:"weight"`
+}
+
+type venuePrice struct {
+	venue    string
+	price    float64
+	volume   float64
+	excluded bool
+}
+
+type assetIndex struct {
+	price    float64
+	venues   []*venuePrice
+	used     int
+	excluded int
+}
+
+func computePriceIndexes() {
+
+	pc := conf.Metrics.PriceIndex
+	if pc == nil {
+		return
+	}
+
+	f, err := time.ParseDuration(pc.Frequency)
+	if err != nil {
+		logger.WithField("error", err).Fatal(
+			"computePriceIndexes: time.ParseDuration")
+	}
+
+	window, err := time.ParseDuration(pc.Window)
+	if err != nil {
+		logger.WithField("error", err).Fatal(
+			"computePriceIndexes: time.ParseDuration")
+	}
+
+	if pc.Method != "vwap" && pc.Method != "median" {
+		logger.WithField("method", pc.Method).Fatal(
+			"computePriceIndexes: unknown method")
+	}
+
+	var maxAge time.Duration
+	if pc.Coinmarketcap != nil {
+		if maxAge, err = time.ParseDuration(pc.Coinmarketcap.MaxAge); err != nil {
+			logger.WithField("error", err).Fatal(
+				"computePriceIndexes: time.ParseDuration")
+		}
+	}
+
+	ind := &indicator{
+		period:   f,
+		exchange: "index",
+	}
+
+	go networking.RunEvery(f, func(nextRun int64) {
+
+		ind.nextRun = nextRun
+
+		// venue prices by asset
+		prices := make(map[string][]*venuePrice)
+
+		for exchange, dataSource := range conf.Metrics.Sources {
+
+			end := nextRun - int64(dataSource.UpdateLag)
+
+			for asset, vp := range getExchangePrices(exchange, dataSource,
+				end-int64(window), end) {
+				prices[asset] = append(prices[asset], vp)
+			}
+		}
+
+		if pc.Coinmarketcap != nil {
+			for asset, vp := range getCoinmarketcapPrices(nextRun-int64(maxAge),
+				nextRun) {
+				prices[asset] = append(prices[asset], vp)
+			}
+		}
+
+		indexes := make(map[string]*assetIndex, len(prices))
+		for asset, venues := range prices {
+			if ai := computeAssetIndex(venues); ai != nil {
+				indexes[asset] = ai
+			}
+		}
+
+		preparePriceIndexPoints(ind, indexes)
+	})
+}
+
+// getExchangePrices returns the volume weighted price of each asset traded
+// against the quote on exchange, its markets combined.
+func getExchangePrices(exchange string, dataSource *exchangeConf,
+	start, end int64) map[string]*venuePrice {
+
+	query := fmt.Sprintf(
+		`SELECT SUM(total) AS volume, SUM(quantity) AS quantity
+    FROM %s
+    WHERE time >= %d AND time < %d
+    GROUP BY market`,
+		dataSource.Schema["trades_measurement"],
+		start, end)
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, dataSource.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   conf.Metrics.Frequency,
+		ErrorMsg: "getExchangePrices: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil
+	}
+
+	volumes := make(map[string]float64)
+	quantities := make(map[string]float64)
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+
+		pair, err := symbols.Canonical(exchange, market)
+		if err != nil || !isIndexQuote(pair.Base) {
+			continue
+		}
+
+		if serie.Values[0][1] == nil || serie.Values[0][2] == nil {
+			continue
+		}
+
+		volume, err := networking.ConvertJsonValueToFloat64(serie.Values[0][1])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": exchange,
+				"market":   market,
+			}).Error("getExchangePrices: networking.ConvertJsonValueToFloat64")
+			continue
+		}
+
+		quantity, err := networking.ConvertJsonValueToFloat64(serie.Values[0][2])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": exchange,
+				"market":   market,
+			}).Error("getExchangePrices: networking.ConvertJsonValueToFloat64")
+			continue
+		}
+
+		volumes[pair.Quote] += volume
+		quantities[pair.Quote] += quantity
+	}
+
+	prices := make(map[string]*venuePrice, len(volumes))
+
+	for asset, volume := range volumes {
+
+		if quantities[asset] == 0.0 {
+			continue
+		}
+
+		prices[asset] = &venuePrice{
+			venue:  exchange,
+			price:  volume / quantities[asset],
+			volume: volume,
+		}
+	}
+
+	return prices
+}
+
+// getCoinmarketcapPrices returns the last price of each asset ticked within
+// [start, end).
+func getCoinmarketcapPrices(start, end int64) map[string]*venuePrice {
+
+	cc := conf.Metrics.PriceIndex.Coinmarketcap
+
+	query := fmt.Sprintf(
+		`SELECT LAST(%s)
+    FROM %s
+    WHERE time >= %d AND time < %d
+    GROUP BY symbol`,
+		cc.Field,
+		cc.Schema["ticks_measurement"],
+		start, end)
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(dbClient, query, cc.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   conf.Metrics.Frequency,
+		ErrorMsg: "getCoinmarketcapPrices: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil
+	}
+
+	prices := make(map[string]*venuePrice, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		symbol := serie.Tags["symbol"]
+
+		if serie.Values[0][1] == nil {
+			continue
+		}
+
+		price, err := networking.ConvertJsonValueToFloat64(serie.Values[0][1])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":  err,
+				"symbol": symbol,
+			}).Error("getCoinmarketcapPrices: networking.ConvertJsonValueToFloat64")
+			continue
+		}
+
+		if price == 0.0 {
+			continue
+		}
+
+		prices[symbols.Currency("coinmarketcap", symbol)] = &venuePrice{
+			venue: "coinmarketcap",
+			price: price,
+		}
+	}
+
+	return prices
+}
+
+func isIndexQuote(currency string) bool {
+
+	if currency == conf.Metrics.PriceIndex.Quote {
+		return true
+	}
+
+	for _, equivalent := range conf.Metrics.PriceIndex.Equivalents {
+		if currency == equivalent {
+			return true
+		}
+	}
+
+	return false
+}
+
+// computeAssetIndex returns the index of the venue prices of an asset, nil
+// if every venue is excluded.
+func computeAssetIndex(venues []*venuePrice) *assetIndex {
+
+	pc := conf.Metrics.PriceIndex
+	ai := &assetIndex{venues: venues}
+
+	prices := make([]float64, 0, len(venues))
+	for _, vp := range venues {
+		prices = append(prices, vp.price)
+	}
+	med := median(prices)
+
+	if len(venues) >= 3 && pc.MaxDeviationPercent > 0.0 {
+		for _, vp := range venues {
+			if math.Abs(vp.price-med)/med*100 > pc.MaxDeviationPercent {
+				vp.excluded = true
+				ai.excluded++
+			}
+		}
+	}
+
+	remaining := make([]float64, 0, len(venues))
+	volume, weighted := 0.0, 0.0
+	var cmc *venuePrice
+
+	for _, vp := range venues {
+
+		if vp.excluded {
+			continue
+		}
+
+		ai.used++
+		remaining = append(remaining, vp.price)
+
+		if vp.venue == "coinmarketcap" {
+			cmc = vp
+			continue
+		}
+
+		volume += vp.volume
+		weighted += vp.price * vp.volume
+	}
+
+	if ai.used == 0 {
+		return nil
+	}
+
+	switch {
+	case pc.Method == "median":
+		ai.price = median(remaining)
+
+	case volume == 0.0 && cmc == nil:
+		return nil
+
+	case volume == 0.0:
+		ai.price = cmc.price
+
+	case cmc != nil:
+		w := pc.Coinmarketcap.Weight
+		ai.price = (1-w)*weighted/volume + w*cmc.price
+
+	default:
+		ai.price = weighted / volume
+	}
+
+	return ai
+}
+
+func median(values []float64) float64 {
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func preparePriceIndexPoints(ind *indicator, indexes map[string]*assetIndex) {
+
+	measurement, ok := conf.Metrics.Schema["price_index_measurement"]
+	if !ok {
+		return
+	}
+
+	timestamp := time.Unix(0, ind.nextRun)
+	points := make([]*ifxClient.Point, 0, len(indexes))
+
+	for asset, ai := range indexes {
+
+		tags := map[string]string{
+			"asset": asset,
+			"quote": conf.Metrics.PriceIndex.Quote,
+		}
+
+		fields := map[string]interface{}{
+			"price":    ai.price,
+			"venues":   ai.used,
+			"excluded": ai.excluded,
+		}
+
+		for _, vp := range ai.venues {
+			fields[vp.venue] = vp.price
+		}
+
+		pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"preparePriceIndexPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	sendBatchPoints(ind, "PriceIndex", points)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import "testing"
+
+func TestComputeAssetIndex(t *testing.T) {
+
+	defer func(p *priceIndexConf) { conf.Metrics.PriceIndex = p }(
+		conf.Metrics.PriceIndex)
+
+	venue := func(name string, price, volume float64) *venuePrice {
+		return &venuePrice{venue: name, price: price, volume: volume}
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		venues   []*venuePrice
+		price    float64 // 0 if no index
+		excluded int
+	}{
+		{
+			name: "weighted by volume",
+			venues: []*venuePrice{venue("poloniex", 100, 1),
+				venue("bittrex", 103, 2)},
+			price: 102,
+		},
+		{
+			name: "blended with coinmarketcap",
+			venues: []*venuePrice{venue("poloniex", 100, 1),
+				venue("bittrex", 103, 2), venue("coinmarketcap", 101, 0)},
+			price: 0.8*102 + 0.2*101,
+		},
+		{
+			name: "outlier excluded",
+			venues: []*venuePrice{venue("poloniex", 100, 1),
+				venue("bittrex", 120, 1), venue("coinmarketcap", 101, 0)},
+			price:    0.8*100 + 0.2*101,
+			excluded: 1,
+		},
+		{
+			name: "outliers kept under 3 venues",
+			venues: []*venuePrice{venue("poloniex", 100, 1),
+				venue("bittrex", 120, 1)},
+			price: 110,
+		},
+		{
+			name:   "coinmarketcap only",
+			venues: []*venuePrice{venue("coinmarketcap", 101, 0)},
+			price:  101,
+		},
+		{
+			name:   "no volume",
+			venues: []*venuePrice{venue("poloniex", 100, 0)},
+		},
+		{
+			name:   "median",
+			method: "median",
+			venues: []*venuePrice{venue("poloniex", 100, 1),
+				venue("bittrex", 103, 2), venue("coinmarketcap", 101, 0)},
+			price: 101,
+		},
+		{
+			name:   "median of two venues",
+			method: "median",
+			venues: []*venuePrice{venue("poloniex", 100, 1),
+				venue("bittrex", 103, 2)},
+			price: 101.5,
+		},
+	}
+
+	for _, tt := range tests {
+
+		method := tt.method
+		if method == "" {
+			method = "vwap"
+		}
+
+		conf.Metrics.PriceIndex = &priceIndexConf{
+			Method:              method,
+			MaxDeviationPercent: 5,
+			Coinmarketcap:       &coinmarketcapConf{Weight: 0.2},
+		}
+
+		ai := computeAssetIndex(tt.venues)
+
+		if tt.price == 0.0 {
+			if ai != nil {
+				t.Errorf("%s: got %+v, want no index", tt.name, ai)
+			}
+			continue
+		}
+
+		if ai == nil || !approxEqual(ai.price, tt.price) ||
+			ai.excluded != tt.excluded ||
+			ai.used != len(tt.venues)-tt.excluded {
+			t.Errorf("%s: got %+v, want %v with %d excluded", tt.name, ai,
+				tt.price, tt.excluded)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// renkoConf sets the brick size of each market, fixed (brick_sizes) or the
+// average true range over atr_length periods otherwise.
+type renkoConf struct {
+	ATRLength  int                `json:"atr_length"`
+	BrickSizes map[string]float64 `json:"brick_sizes"`
+}
+
+type brick struct {
+	open      float64
+	close     float64
+	direction float64
+	size      float64
+}
+
+func getRenko(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "renko")
+
+	ind.computeTimeIntervals(0)
+
+	imbricks, imfields, imohlc := computeRenko(ind)
+	if imbricks == nil {
+		return nil, fmt.Errorf("computeRenko: no result")
+	}
+
+	updateCacheLastFields(ind, imfields)
+	updateCacheLastSeries(ind, "renko", imohlc)
+	prepareRenkoPoints(ind, imbricks, imfields, imohlc)
+
+	// indicators depending on this node are computed from the candles
+	ind.series = "renko"
+
+	return ind, nil
+}
+
+// computeRenko computes the bricks formed by the close of each closed
+// interval. The last brick (box) of each market is cached to carry the
+// computation over the next runs. A time aligned candle is also returned for
+// each interval, folding its bricks (flat at the box close if none).
+func computeRenko(ind *indicator) (map[int64]map[string][]*brick,
+	map[int64]map[string]indicatorFields, map[int64]map[string]*ohlc) {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil, nil, nil
+	}
+
+	lastMfields := getLastRenkoBoxes(ind)
+	if lastMfields == nil {
+		return nil, nil, nil
+	}
+
+	period := int64(ind.period)
+	imbricks := make(map[int64]map[string][]*brick, len(ind.timeIntervals))
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+	imrenko := make(map[int64]map[string]*ohlc, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		// bricks are only formed once the interval is closed
+		if interval+period > ind.nextRun {
+			break
+		}
+
+		imbricks[interval] = make(map[string][]*brick)
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+		imrenko[interval] = make(map[string]*ohlc, len(imohlc[interval]))
+
+		for market, o := range imohlc[interval] {
+
+			size := getBrickSize(ind, imohlc, interval, market)
+			if size <= 0.0 {
+				continue
+			}
+
+			box, ok := lastMfields[market]
+			if !ok {
+				box = indicatorFields{"open": o.close, "close": o.close}
+			}
+
+			top := math.Max(box["open"], box["close"])
+			bottom := math.Min(box["open"], box["close"])
+			bricks := make([]*brick, 0)
+
+			for o.close >= top+size {
+				bricks = append(bricks, &brick{top, top + size, 1.0, size})
+				bottom, top = top, top+size
+			}
+
+			for o.close <= bottom-size {
+				bricks = append(bricks, &brick{bottom, bottom - size, -1.0, size})
+				top, bottom = bottom, bottom-size
+			}
+
+			renko := &ohlc{
+				volume:   o.volume,
+				quantity: o.quantity,
+				open:     box["close"],
+				high:     box["close"],
+				low:      box["close"],
+				close:    box["close"],
+			}
+
+			if len(bricks) != 0 {
+
+				renko.open = bricks[0].open
+				for _, b := range bricks {
+					renko.high = math.Max(renko.high, math.Max(b.open, b.close))
+					renko.low = math.Min(renko.low, math.Min(b.open, b.close))
+				}
+
+				last := bricks[len(bricks)-1]
+				renko.close = last.close
+				box = indicatorFields{"open": last.open, "close": last.close}
+				imbricks[interval][market] = bricks
+			}
+
+			renko.setDerivedFields()
+
+			imfields[interval][market] = box
+			imrenko[interval][market] = renko
+			lastMfields[market] = box
+		}
+	}
+
+	return imbricks, imfields, imrenko
+}
+
+// getBrickSize returns the fixed brick size of market or its average true
+// range ending at interval (0 if not available yet).
+func getBrickSize(ind *indicator, imohlc map[int64]map[string]*ohlc,
+	interval int64, market string) float64 {
+
+	rc := conf.Metrics.Renko
+
+	if size, ok := rc.BrickSizes[market]; ok {
+		return size
+	}
+
+	window := getOHLCWindow(imohlc, ind.period, interval, market,
+		rc.ATRLength+1)
+	if window == nil {
+		return 0.0
+	}
+
+	sum := 0.0
+
+	for i, o := range window[1:] {
+
+		prevClose := window[i].close
+		sum += math.Max(o.high-o.low,
+			math.Max(math.Abs(o.high-prevClose), math.Abs(o.low-prevClose)))
+	}
+
+	return sum / float64(rc.ATRLength)
+}
+
+// getLastRenkoBoxes returns the last brick of each market preceding the
+// first time interval, from cache if available or from the box of the last
+// interval written.
+func getLastRenkoBoxes(ind *indicator) map[string]indicatorFields {
+
+	seedInterval := ind.timeIntervals[0] - int64(ind.period)
+
+	if lastImfields := getCachedLastFields(ind); lastImfields != nil {
+		if mfields, ok := lastImfields[seedInterval]; ok {
+			return copyMfields(mfields)
+		}
+	}
+
+	query := fmt.Sprintf(
+		`SELECT box_open, box_close
+    FROM %s
+    WHERE time < %d AND exchange = '%s'
+    GROUP BY market
+    ORDER BY time DESC
+    LIMIT 1`,
+		ind.destination,
+		ind.timeIntervals[0],
+		ind.exchange)
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, conf.Metrics.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   ind.period,
+		ErrorMsg: "getLastRenkoBoxes: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil
+	}
+
+	mfields := make(map[string]indicatorFields, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+
+		if serie.Values[0][1] == nil || serie.Values[0][2] == nil {
+			continue
+		}
+
+		open, err := networking.ConvertJsonValueToFloat64(serie.Values[0][1])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": ind.exchange,
+				"market":   market,
+			}).Error("getLastRenkoBoxes: networking.ConvertJsonValueToFloat64")
+			continue
+		}
+
+		close, err := networking.ConvertJsonValueToFloat64(serie.Values[0][2])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": ind.exchange,
+				"market":   market,
+			}).Error("getLastRenkoBoxes: networking.ConvertJsonValueToFloat64")
+			continue
+		}
+
+		mfields[market] = indicatorFields{"open": open, "close": close}
+	}
+
+	return mfields
+}
+
+// prepareRenkoPoints writes a point for each closed interval of a market,
+// folding its bricks (none if flat) with the box it leaves, so that a
+// recomputation forming fewer bricks overwrites it in place.
+func prepareRenkoPoints(ind *indicator,
+	imbricks map[int64]map[string][]*brick,
+	imfields map[int64]map[string]indicatorFields,
+	imrenko map[int64]map[string]*ohlc) {
+
+	measurement := ind.destination
+	points := make([]*ifxClient.Point, 0)
+
+	for interval, mfields := range imfields {
+
+		for market, box := range mfields {
+
+			tags := map[string]string{
+				"market":   market,
+				"exchange": ind.exchange,
+			}
+
+			renko := imrenko[interval][market]
+			bricks := imbricks[interval][market]
+
+			direction, size := 0.0, 0.0
+			if len(bricks) != 0 {
+				direction = bricks[len(bricks)-1].direction
+				size = bricks[len(bricks)-1].size
+			}
+
+			fields := map[string]interface{}{
+				"open":       renko.open,
+				"high":       renko.high,
+				"low":        renko.low,
+				"close":      renko.close,
+				"bricks":     len(bricks),
+				"direction":  direction,
+				"brick_size": size,
+				"box_open":   box["open"],
+				"box_close":  box["close"],
+			}
+
+			pt, err := ifxClient.NewPoint(measurement, tags, fields,
+				time.Unix(0, interval))
+			if err != nil {
+				logger.WithField("error", err).Error(
+					"prepareRenkoPoints: ifxClient.NewPoint")
+				continue
+			}
+			points = append(points, pt)
+		}
+	}
+
+	sendBatchPoints(ind, "Renko", points)
+}
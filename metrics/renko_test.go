@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestComputeRenko(t *testing.T) {
+
+	defer func(r *renkoConf) { conf.Metrics.Renko = r }(conf.Metrics.Renko)
+	conf.Metrics.Renko = &renkoConf{
+		ATRLength:  2,
+		BrickSizes: map[string]float64{"BTC_ETH": 1},
+	}
+
+	ind := newTestIndicator(time.Minute, 3)
+	ind.destination = "renko_1m"
+
+	imohlc := setTestOHLC(ind.period, 0, "BTC_ETH", []*ohlc{
+		newTestOHLC(10, 12.5, 10, 12.5, 10),
+		newTestOHLC(12.5, 12.5, 11.5, 11.5, 10),
+		newTestOHLC(11.5, 11.5, 9, 9, 10),
+	})
+	// average true range not available yet
+	imohlc[testStart]["BTC_XMR"] = newTestOHLC(1, 1, 1, 1, 10)
+
+	setTestFields(ind, map[string]indicatorFields{
+		"BTC_ETH": {"open": 9, "close": 10},
+	})
+
+	imbricks, imfields, imrenko := computeRenko(ind)
+
+	want := [][]brick{
+		{{10, 11, 1, 1}, {11, 12, 1, 1}},
+		nil,
+		{{11, 10, -1, 1}, {10, 9, -1, 1}},
+	}
+
+	for i, interval := range ind.timeIntervals {
+
+		got := imbricks[interval]["BTC_ETH"]
+		if len(got) != len(want[i]) {
+			t.Errorf("interval %d: got %d bricks, want %d", i, len(got),
+				len(want[i]))
+			continue
+		}
+
+		for j, b := range got {
+			if *b != want[i][j] {
+				t.Errorf("interval %d brick %d: got %+v, want %+v", i, j, *b,
+					want[i][j])
+			}
+		}
+	}
+
+	if box := imfields[ind.timeIntervals[1]]["BTC_ETH"]; box["open"] != 11 ||
+		box["close"] != 12 {
+		t.Errorf("box without bricks: got %v, want 11 to 12", box)
+	}
+
+	// candle of the second interval flat at the box close
+	if r := imrenko[ind.timeIntervals[1]]["BTC_ETH"]; r.open != 12 ||
+		r.close != 12 || r.high != 12 || r.low != 12 {
+		t.Errorf("flat candle: got %+v, want 12", r)
+	}
+
+	// reversal from the box close, the first brick opening a brick below
+	if r := imrenko[ind.timeIntervals[2]]["BTC_ETH"]; r.open != 11 ||
+		r.close != 9 || r.high != 12 || r.low != 9 {
+		t.Errorf("down candle: got %+v, want 11 to 9 from 12", r)
+	}
+
+	if _, ok := imfields[testStart]["BTC_XMR"]; ok {
+		t.Errorf("market without brick size computed")
+	}
+}
+
+func TestPrepareRenkoPoints(t *testing.T) {
+
+	ind := newTestIndicator(time.Minute, 2)
+	ind.destination = "renko_1m"
+
+	imbricks := map[int64]map[string][]*brick{
+		ind.timeIntervals[0]: {"BTC_ETH": {{10, 11, 1, 1}, {11, 12, 1, 1}}},
+		ind.timeIntervals[1]: {},
+	}
+	imfields := map[int64]map[string]indicatorFields{
+		ind.timeIntervals[0]: {"BTC_ETH": {"open": 11, "close": 12}},
+		ind.timeIntervals[1]: {"BTC_ETH": {"open": 11, "close": 12}},
+	}
+	imrenko := map[int64]map[string]*ohlc{
+		ind.timeIntervals[0]: {"BTC_ETH": newTestOHLC(10, 12, 10, 12, 10)},
+		ind.timeIntervals[1]: {"BTC_ETH": newTestOHLC(12, 12, 12, 12, 10)},
+	}
+
+	// batches left by the other tests
+	for len(batchsToWrite) > 0 {
+		<-batchsToWrite
+	}
+
+	prepareRenkoPoints(ind, imbricks, imfields, imrenko)
+
+	// one point per interval, flat intervals overwriting bricks recomputed
+	bricks := make(map[int64]string)
+	select {
+	case bp := <-batchsToWrite:
+		for _, pt := range bp.Points {
+			fields, _ := pt.Fields()
+			bricks[pt.Time().UnixNano()] = fmt.Sprint(fields["bricks"])
+		}
+	default:
+	}
+
+	if len(bricks) != 2 || bricks[ind.timeIntervals[0]] != "2" ||
+		bricks[ind.timeIntervals[1]] != "0" {
+		t.Errorf("got bricks %v, want 2 then 0", bricks)
+	}
+}
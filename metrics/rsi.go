@@ -3,7 +3,6 @@ package metrics
 import (
 	"fmt"
 	"time"
-	"trading/networking/database"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
 )
@@ -12,22 +11,20 @@ type rsi struct {
 	rsis map[int]float64
 }
 
-func getRSI(from *indicator) {
+func getRSI(from *indicator) (*indicator, error) {
 
-	ind := &indicator{
-		nextRun:     from.nextRun,
-		period:      conf.Metrics.OhlcPeriods[from.indexPeriod],
-		indexPeriod: from.indexPeriod,
-		dataSource:  from.dataSource,
-		source:      from.destination,
-		destination: "rsi_" + conf.Metrics.OhlcPeriodsStr[from.indexPeriod],
-		exchange:    from.exchange,
-	}
+	ind := deriveIndicator(from, "rsi")
 
 	ind.computeTimeIntervals(conf.Metrics.LengthMax - 1)
 
 	imobv := computeRSI(ind)
+	if imobv == nil {
+		return nil, fmt.Errorf("computeRSI: no result")
+	}
+
 	prepareRSIPoints(ind, imobv)
+
+	return ind, nil
 }
 
 func computeRSI(ind *indicator) map[int64]map[string]*rsi {
@@ -114,13 +111,5 @@ func prepareRSIPoints(ind *indicator, imrsi map[int64]map[string]*rsi) {
 		}
 	}
 
-	if len(points) == 0 {
-		return
-	}
-
-	batchsToWrite <- &database.BatchPoints{
-		TypePoint: ind.exchange + "RSI",
-		Points:    points,
-		Callback:  ind.callback,
-	}
+	sendBatchPoints(ind, "RSI", points)
 }
@@ -0,0 +1,284 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+)
+
+// Sides of an order walking the book: buying walks the asks, selling the
+// bids.
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+type slippageConf struct {
+	Notionals []float64 `json:"notionals"`
+}
+
+// SlippageEstimate is the execution of a market order of Notional (base
+// currency) against an order book. Slippages are costs (positive when the
+// average price is worse), in basis points from the best price (SlippageBps)
+// and from the mid price (ImpactBps). Filled is false when the book is not
+// deep enough, the estimate then covering FilledNotional only.
+type SlippageEstimate struct {
+	Exchange       string
+	Market         string
+	Side           string
+	Notional       float64
+	FilledNotional float64
+	Quantity       float64
+	AveragePrice   float64
+	BestPrice      float64
+	Mid            float64
+	SlippageBps    float64
+	ImpactBps      float64
+	Levels         int
+	Filled         bool
+	Time           time.Time
+}
+
+// latestBooks keeps the last order books reconstructed by the market depths
+// of each exchange.
+type latestBooks struct {
+	sync.RWMutex
+	books      map[string]orderBooks
+	timestamps map[string]int64
+}
+
+var lastBooks = &latestBooks{
+	books:      make(map[string]orderBooks),
+	timestamps: make(map[string]int64),
+}
+
+// EstimateSlippage estimates the execution of a market order of notional
+// (base currency) on market from its last order book. Books are those
+// reconstructed by the market depths, ComputeMetrics must be running in the
+// same process.
+func EstimateSlippage(exchange, market, side string,
+	notional float64) (*SlippageEstimate, error) {
+
+	if side != SideBuy && side != SideSell {
+		return nil, fmt.Errorf("unknown side: %s", side)
+	}
+
+	if notional <= 0.0 {
+		return nil, fmt.Errorf("invalid notional: %f", notional)
+	}
+
+	lastBooks.RLock()
+	defer lastBooks.RUnlock()
+
+	ob, ok := lastBooks.books[exchange][market]
+	if !ok {
+		return nil, fmt.Errorf("no order book for %s %s", exchange, market)
+	}
+
+	se := estimateSlippage(ob, side, notional)
+	se.Exchange = exchange
+	se.Market = market
+	se.Time = time.Unix(0, lastBooks.timestamps[exchange])
+
+	return se, nil
+}
+
+// setLastBooks stores a copy of the order books, those of poloniex being
+// updated in place by the next runs.
+func setLastBooks(ind *indicator, obs orderBooks) {
+
+	copies := make(orderBooks, len(obs))
+
+	for market, ob := range obs {
+
+		copies[market] = &orderBook{
+			sequence: ob.sequence,
+			bids:     copyOrders(ob.bids),
+			asks:     copyOrders(ob.asks),
+		}
+	}
+
+	lastBooks.Lock()
+	defer lastBooks.Unlock()
+
+	lastBooks.books[ind.exchange] = copies
+	lastBooks.timestamps[ind.exchange] = ind.nextRun
+}
+
+// getLastBooks returns the last order books and their timestamps by
+// exchange. Stored books are not modified afterwards.
+func getLastBooks() (map[string]orderBooks, map[string]int64) {
+
+	lastBooks.RLock()
+	defer lastBooks.RUnlock()
+
+	books := make(map[string]orderBooks, len(lastBooks.books))
+	timestamps := make(map[string]int64, len(lastBooks.timestamps))
+
+	for exchange, obs := range lastBooks.books {
+		books[exchange] = obs
+		timestamps[exchange] = lastBooks.timestamps[exchange]
+	}
+
+	return books, timestamps
+}
+
+func copyOrders(orders []*order) []*order {
+
+	copies := make([]*order, len(orders))
+
+	for i, o := range orders {
+		copied := *o
+		copies[i] = &copied
+	}
+
+	return copies
+}
+
+// estimateSlippage walks the orders (best first) of the side of the book
+// until notional is reached.
+func estimateSlippage(ob *orderBook, side string,
+	notional float64) *SlippageEstimate {
+
+	return walkBook(ob, side, notional, 0.0)
+}
+
+// estimateSlippageQuantity walks the orders of the side of the book until
+// quantity is reached, Notional being the notional traded.
+func estimateSlippageQuantity(ob *orderBook, side string,
+	quantity float64) *SlippageEstimate {
+
+	se := walkBook(ob, side, 0.0, quantity)
+	se.Notional = se.FilledNotional
+
+	return se
+}
+
+// walkBook walks the orders of the side of the book until notional or
+// quantity (the one not 0) is reached.
+func walkBook(ob *orderBook, side string,
+	notional, quantity float64) *SlippageEstimate {
+
+	orders := ob.asks
+	if side == SideSell {
+		orders = ob.bids
+	}
+
+	se := &SlippageEstimate{
+		Side:     side,
+		Notional: notional,
+	}
+
+	if len(orders) == 0 {
+		return se
+	}
+
+	se.BestPrice = orders[0].rate
+	if len(ob.bids) != 0 && len(ob.asks) != 0 {
+		se.Mid = (ob.bids[0].rate + ob.asks[0].rate) / 2
+	}
+
+	for _, o := range orders {
+
+		if o.rate == 0.0 {
+			continue
+		}
+
+		se.Levels++
+
+		total := o.rate * o.quantity
+		if notional > 0.0 && se.FilledNotional+total >= notional {
+			se.Quantity += (notional - se.FilledNotional) / o.rate
+			se.FilledNotional = notional
+			se.Filled = true
+			break
+		}
+
+		if quantity > 0.0 && se.Quantity+o.quantity >= quantity {
+			se.FilledNotional += (quantity - se.Quantity) * o.rate
+			se.Quantity = quantity
+			se.Filled = true
+			break
+		}
+
+		se.Quantity += o.quantity
+		se.FilledNotional += total
+	}
+
+	if se.Quantity == 0.0 {
+		return se
+	}
+
+	se.AveragePrice = se.FilledNotional / se.Quantity
+
+	sign := 1.0
+	if side == SideSell {
+		sign = -1.0
+	}
+
+	se.SlippageBps =
+		sign * (se.AveragePrice - se.BestPrice) / se.BestPrice * 10000
+
+	if se.Mid != 0.0 {
+		se.ImpactBps = sign * (se.AveragePrice - se.Mid) / se.Mid * 10000
+	}
+
+	return se
+}
+
+func prepareSlippagesPoints(ind *indicator, obs orderBooks) {
+
+	measurement, ok := conf.Metrics.Schema["slippages_measurement"]
+	if !ok || conf.Metrics.Slippage == nil {
+		return
+	}
+
+	timestamp := time.Unix(0, ind.nextRun)
+	points := make([]*ifxClient.Point, 0)
+
+	for market, ob := range obs {
+
+		for _, side := range []string{SideBuy, SideSell} {
+
+			for _, notional := range conf.Metrics.Slippage.Notionals {
+
+				se := estimateSlippage(ob, side, notional)
+				if se.Quantity == 0.0 {
+					continue
+				}
+
+				tags := map[string]string{
+					"market":   market,
+					"exchange": ind.exchange,
+					"side":     side,
+					"notional": strconv.FormatFloat(notional, 'f', -1, 64),
+				}
+
+				fields := map[string]interface{}{
+					"filled_notional": se.FilledNotional,
+					"quantity":        se.Quantity,
+					"average_price":   se.AveragePrice,
+					"best_price":      se.BestPrice,
+					"mid":             se.Mid,
+					"slippage_bps":    se.SlippageBps,
+					"impact_bps":      se.ImpactBps,
+					"levels":          se.Levels,
+					"filled":          se.Filled,
+				}
+
+				pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+				if err != nil {
+					logger.WithField("error", err).Error(
+						"prepareSlippagesPoints: ifxClient.NewPoint")
+					continue
+				}
+				points = append(points, pt)
+			}
+		}
+	}
+
+	sendBatchPoints(ind, "Slippages", points)
+}
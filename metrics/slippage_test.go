@@ -0,0 +1,86 @@
+package metrics
+
+import "testing"
+
+func TestEstimateSlippage(t *testing.T) {
+
+	ob := &orderBook{
+		bids: []*order{{rate: 10, quantity: 1}, {rate: 9, quantity: 2}},
+		asks: []*order{{rate: 11, quantity: 1}, {rate: 12, quantity: 2}},
+	}
+
+	tests := []struct {
+		name     string
+		ob       *orderBook
+		side     string
+		notional float64
+		want     SlippageEstimate
+	}{
+		{
+			name: "best ask", ob: ob, side: SideBuy, notional: 11,
+			want: SlippageEstimate{FilledNotional: 11, Quantity: 1,
+				AveragePrice: 11, BestPrice: 11, Mid: 10.5,
+				ImpactBps: 0.5 / 10.5 * 10000, Levels: 1, Filled: true},
+		},
+		{
+			name: "two asks", ob: ob, side: SideBuy, notional: 23,
+			want: SlippageEstimate{FilledNotional: 23, Quantity: 2,
+				AveragePrice: 11.5, BestPrice: 11, Mid: 10.5,
+				SlippageBps: 0.5 / 11 * 10000, ImpactBps: 1 / 10.5 * 10000,
+				Levels: 2, Filled: true},
+		},
+		{
+			name: "book not deep enough", ob: ob, side: SideBuy, notional: 100,
+			want: SlippageEstimate{FilledNotional: 35, Quantity: 3,
+				AveragePrice: 35.0 / 3, BestPrice: 11, Mid: 10.5,
+				SlippageBps: (35.0/3 - 11) / 11 * 10000,
+				ImpactBps:   (35.0/3 - 10.5) / 10.5 * 10000, Levels: 2},
+		},
+		{
+			name: "two bids", ob: ob, side: SideSell, notional: 19,
+			want: SlippageEstimate{FilledNotional: 19, Quantity: 2,
+				AveragePrice: 9.5, BestPrice: 10, Mid: 10.5,
+				SlippageBps: 500, ImpactBps: 1 / 10.5 * 10000, Levels: 2,
+				Filled: true},
+		},
+		{
+			name: "no bids", ob: &orderBook{asks: ob.asks}, side: SideSell,
+			notional: 10,
+		},
+	}
+
+	for _, tt := range tests {
+
+		got := estimateSlippage(tt.ob, tt.side, tt.notional)
+		w := tt.want
+
+		if got.Side != tt.side || got.Notional != tt.notional ||
+			!approxEqual(got.FilledNotional, w.FilledNotional) ||
+			!approxEqual(got.Quantity, w.Quantity) ||
+			!approxEqual(got.AveragePrice, w.AveragePrice) ||
+			got.BestPrice != w.BestPrice || got.Mid != w.Mid ||
+			!approxEqual(got.SlippageBps, w.SlippageBps) ||
+			!approxEqual(got.ImpactBps, w.ImpactBps) ||
+			got.Levels != w.Levels || got.Filled != w.Filled {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, w)
+		}
+	}
+}
+
+func TestEstimateSlippageArguments(t *testing.T) {
+
+	_, err := EstimateSlippage(testExchange, "BTC_ETH", "hold", 1)
+	if err == nil {
+		t.Errorf("unknown side: got no error")
+	}
+
+	_, err = EstimateSlippage(testExchange, "BTC_ETH", SideBuy, 0)
+	if err == nil {
+		t.Errorf("zero notional: got no error")
+	}
+
+	_, err = EstimateSlippage("test", "BTC_ETH", SideBuy, 1)
+	if err == nil {
+		t.Errorf("no order book: got no error")
+	}
+}
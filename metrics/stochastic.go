@@ -0,0 +1,94 @@
+package metrics
+
+import "fmt"
+
+func getStochastic(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "stochastic")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeStochastic(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeStochastic: no result")
+	}
+
+	prepareFieldsPoints(ind, "Stochastic", imfields)
+
+	return ind, nil
+}
+
+// computeStochastic computes for each configured length the fast %K, its
+// d_smoothing average (fast %D), the k_smoothing average of the fast %K
+// (slow %K) and the d_smoothing average of the slow %K (slow %D).
+func computeStochastic(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	sc := conf.Metrics.Oscillators.Stochastic
+	ks, ds := maxInt(sc.KSmoothing, 1), maxInt(sc.DSmoothing, 1)
+
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, _ := range imohlc[interval] {
+
+			fields := make(indicatorFields, 4*len(sc.Lengths))
+
+			for _, length := range sc.Lengths {
+
+				window := getOHLCWindow(imohlc, ind.period, interval, market,
+					length+ks+ds-2)
+				if window == nil {
+					continue
+				}
+
+				fastKs := make([]float64, ks+ds-1)
+				for i := range fastKs {
+					fastKs[i] = fastK(window[i : i+length])
+				}
+
+				slowKs := make([]float64, ds)
+				for i := range slowKs {
+					slowKs[i] = average(fastKs[i : i+ks])
+				}
+
+				fields[fmt.Sprintf("fast_k_%d", length)] = fastKs[len(fastKs)-1]
+				fields[fmt.Sprintf("fast_d_%d", length)] =
+					average(fastKs[len(fastKs)-ds:])
+				fields[fmt.Sprintf("slow_k_%d", length)] = slowKs[len(slowKs)-1]
+				fields[fmt.Sprintf("slow_d_%d", length)] = average(slowKs)
+			}
+
+			imfields[interval][market] = fields
+		}
+	}
+
+	return imfields
+}
+
+func fastK(window []*ohlc) float64 {
+
+	high, low := highestHighLowestLow(window)
+	if high == low {
+		return 50.0
+	}
+
+	return 100.0 * (window[len(window)-1].close - low) / (high - low)
+}
+
+func average(values []float64) float64 {
+
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+
+	return sum / float64(len(values))
+}
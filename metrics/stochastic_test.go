@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+// testOscillatorCandles end at testStart (high, low, close).
+var testOscillatorCandles = []*ohlc{
+	newTestOHLC(9, 10, 8, 9, 1),
+	newTestOHLC(9, 11, 9, 10, 1),
+	newTestOHLC(10, 12, 10, 11, 1),
+	newTestOHLC(11, 13, 9, 10, 1),
+}
+
+func TestFastK(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		window []*ohlc
+		want   float64
+	}{
+		{"close mid range", testOscillatorCandles[:1], 50},
+		{"close within range", testOscillatorCandles[1:], 25},
+		{"close at highest high", testOscillatorCandles[:3], 75},
+		{"flat range", []*ohlc{newTestOHLC(5, 5, 5, 5, 1)}, 50},
+	}
+
+	for _, tt := range tests {
+		if got := fastK(tt.window); !approxEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestComputeStochastic(t *testing.T) {
+
+	defer func(o *oscillatorsConf) { conf.Metrics.Oscillators = o }(
+		conf.Metrics.Oscillators)
+
+	tests := []struct {
+		name       string
+		stochastic *stochasticConf
+		want       indicatorFields
+	}{
+		{
+			name:       "no smoothing",
+			stochastic: &stochasticConf{Lengths: []int{3}},
+			want: indicatorFields{
+				"fast_k_3": 25, "fast_d_3": 25, "slow_k_3": 25, "slow_d_3": 25,
+			},
+		},
+		{
+			name:       "k smoothing",
+			stochastic: &stochasticConf{Lengths: []int{3}, KSmoothing: 2},
+			want: indicatorFields{
+				"fast_k_3": 25, "fast_d_3": 25, "slow_k_3": 50, "slow_d_3": 50,
+			},
+		},
+		{
+			name:       "d smoothing",
+			stochastic: &stochasticConf{Lengths: []int{3}, DSmoothing: 2},
+			want: indicatorFields{
+				"fast_k_3": 25, "fast_d_3": 50, "slow_k_3": 25, "slow_d_3": 50,
+			},
+		},
+		{
+			name:       "window longer than the candles",
+			stochastic: &stochasticConf{Lengths: []int{3}, KSmoothing: 3},
+			want:       indicatorFields{},
+		},
+	}
+
+	for _, tt := range tests {
+
+		conf.Metrics.Oscillators = &oscillatorsConf{Stochastic: tt.stochastic}
+
+		ind := newTestIndicator(time.Minute, 1)
+		setTestOHLC(ind.period, 3, "BTC_ETH", testOscillatorCandles)
+
+		got := computeStochastic(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
+
+func assertFields(t *testing.T, name string, got, want indicatorFields) {
+
+	if len(got) != len(want) {
+		t.Errorf("%s: got %v, want %v", name, got, want)
+		return
+	}
+
+	for field, value := range want {
+		if v, ok := got[field]; !ok || !approxEqual(v, value) {
+			t.Errorf("%s: %s: got %v, want %v", name, field, got[field], value)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"time"
+	"trading/networking"
+	"trading/networking/bus"
+)
+
+// ohlcStream maintains the open candles of the base period of an exchange
+// from the trades published by the ingestion (same process). Closed buckets
+// are emitted right away while buckets that may be incomplete (start, late
+// or dropped trades, skipped runs) are recomputed from the database at the
+// next close, once the update lag of the source has passed since they were
+// marked (the trades being flushed to the database by the ingestion).
+type ohlcStream struct {
+	sync.Mutex
+	exchange     string
+	dataSource   *exchangeConf
+	subscription *bus.TradeSubscription
+	candles      map[int64]map[string]*streamedCandle
+	lastTrades   map[string]*lastTrade
+	closedUntil  int64
+	dirtySince   int64
+	dirtyAt      int64
+	updateLag    int64
+	dropped      int64
+}
+
+type streamedCandle struct {
+	*ohlc
+	first int64
+	last  int64
+}
+
+func streamBaseOHLC() {
+
+	for exchange, dataSource := range conf.Metrics.Sources {
+
+		// a lag of one period makes each run compute its closed bucket only
+		source := *dataSource
+		source.UpdateLag = conf.Metrics.OhlcPeriods[0]
+
+		s := &ohlcStream{
+			exchange:   exchange,
+			dataSource: &source,
+			subscription: bus.SubscribeTrades(
+				exchange, conf.Metrics.Streaming.Capacity),
+			candles:    make(map[int64]map[string]*streamedCandle),
+			lastTrades: make(map[string]*lastTrade),
+			updateLag:  int64(dataSource.UpdateLag),
+		}
+
+		go s.consume()
+		go networking.RunEvery(conf.Metrics.OhlcPeriods[0], s.closeBucket)
+	}
+}
+
+func (s *ohlcStream) consume() {
+
+	for trade := range s.subscription.C {
+		s.addTrade(trade)
+	}
+}
+
+func (s *ohlcStream) addTrade(trade *bus.Trade) {
+
+	period := int64(conf.Metrics.OhlcPeriods[0])
+	timestamp := trade.Time.UnixNano()
+	bucket := timestamp - timestamp%period
+
+	s.Lock()
+	defer s.Unlock()
+
+	// trades of emitted buckets are recomputed from the database
+	if bucket < s.closedUntil {
+		s.markDirty(bucket, time.Now().UnixNano())
+		return
+	}
+
+	if _, ok := s.candles[bucket]; !ok {
+		s.candles[bucket] = make(map[string]*streamedCandle)
+	}
+
+	candle, ok := s.candles[bucket][trade.Market]
+	if !ok {
+		candle = &streamedCandle{
+			ohlc: &ohlc{
+				open:  trade.Rate,
+				high:  trade.Rate,
+				low:   trade.Rate,
+				close: trade.Rate,
+			},
+			first: timestamp,
+			last:  timestamp,
+		}
+		s.candles[bucket][trade.Market] = candle
+	}
+
+	candle.volume += trade.Total
+	candle.quantity += trade.Quantity
+	candle.high = math.Max(candle.high, trade.Rate)
+	candle.low = math.Min(candle.low, trade.Rate)
+
+	if timestamp < candle.first {
+		candle.first = timestamp
+		candle.open = trade.Rate
+	}
+
+	if timestamp >= candle.last {
+		candle.last = timestamp
+		candle.close = trade.Rate
+	}
+}
+
+// markDirty sets bucket to be recomputed, the update lag running from at.
+func (s *ohlcStream) markDirty(bucket, at int64) {
+
+	if s.dirtySince == 0 || bucket < s.dirtySince {
+		s.dirtySince = bucket
+	}
+
+	if at > s.dirtyAt {
+		s.dirtyAt = at
+	}
+}
+
+func (s *ohlcStream) closeBucket(nextRun int64) {
+
+	imohlc, dirtySince := s.popClosedBucket(nextRun)
+	if imohlc == nil {
+		return
+	}
+
+	ind := &indicator{
+		nextRun:     nextRun,
+		period:      conf.Metrics.OhlcPeriods[0],
+		indexPeriod: 0,
+		dataSource:  s.dataSource,
+		destination: "ohlc_" + conf.Metrics.OhlcPeriodsStr[0],
+		exchange:    s.exchange,
+		dirtySince:  dirtySince,
+		prefetched:  imohlc,
+	}
+
+	// skipped buckets are recomputed at the next close
+	metricsDAG.run(ind)
+	logOverrun(ind, ind.period)
+}
+
+// popClosedBucket returns the candles of the bucket closing at nextRun and
+// the oldest bucket to recompute from the database (0 if none).
+func (s *ohlcStream) popClosedBucket(
+	nextRun int64) (map[int64]map[string]*ohlc, int64) {
+
+	period := int64(conf.Metrics.OhlcPeriods[0])
+	bucket := nextRun - period
+
+	s.Lock()
+	defer s.Unlock()
+
+	closed := s.candles[bucket]
+	for interval := range s.candles {
+		if interval <= bucket {
+			delete(s.candles, interval)
+		}
+	}
+
+	mohlc := make(map[string]*ohlc, len(s.lastTrades))
+
+	for market, candle := range closed {
+
+		candle.setDerivedFields()
+		mohlc[market] = candle.ohlc
+		s.lastTrades[market] = &lastTrade{candle.close, bucket}
+	}
+
+	// markets without trades keep their last close within the gap lookback
+	for market, last := range s.lastTrades {
+
+		if _, ok := mohlc[market]; ok || s.dataSource.GapPolicy == gapEmpty {
+			continue
+		}
+
+		if filled := fillGap(s.dataSource, bucket, last); filled != nil {
+			mohlc[market] = filled
+		} else {
+			delete(s.lastTrades, market)
+		}
+	}
+
+	// the first bucket only holds the trades published since the start
+	if s.closedUntil == 0 {
+		s.closedUntil = nextRun
+		s.markDirty(bucket, nextRun)
+		return nil, 0
+	}
+
+	var dirtySince int64
+
+	// marked buckets are kept until their trades are in the database
+	if s.dirtySince != 0 && nextRun-s.dirtyAt >= s.updateLag {
+		dirtySince = s.dirtySince
+		s.dirtySince = 0
+	}
+
+	// buckets skipped by a run longer than the period
+	if s.closedUntil < bucket &&
+		(dirtySince == 0 || s.closedUntil < dirtySince) {
+		dirtySince = s.closedUntil
+	}
+
+	s.closedUntil = nextRun
+
+	// dropped trades may belong to the closed bucket, recomputed at next close
+	if dropped := s.subscription.Dropped(); dropped != s.dropped {
+		s.dropped = dropped
+		s.markDirty(bucket, nextRun)
+	}
+
+	return map[int64]map[string]*ohlc{bucket: mohlc}, dirtySince
+}
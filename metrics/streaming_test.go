@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+	"trading/networking/bus"
+)
+
+func newTestStream() *ohlcStream {
+
+	source := *conf.Metrics.Sources[testExchange]
+	source.UpdateLag = conf.Metrics.OhlcPeriods[0]
+
+	return &ohlcStream{
+		exchange:     testExchange,
+		dataSource:   &source,
+		subscription: bus.SubscribeTrades("test", 1),
+		candles:      make(map[int64]map[string]*streamedCandle),
+		lastTrades:   make(map[string]*lastTrade),
+		updateLag:    int64(conf.Metrics.Sources[testExchange].UpdateLag),
+	}
+}
+
+func newTestTrade(market string, offset time.Duration, rate,
+	quantity float64) *bus.Trade {
+
+	return &bus.Trade{
+		Exchange: testExchange,
+		Market:   market,
+		Time:     time.Unix(0, testStart).Add(offset),
+		Rate:     rate,
+		Quantity: quantity,
+		Total:    rate * quantity,
+	}
+}
+
+func TestOHLCStream(t *testing.T) {
+
+	s := newTestStream()
+	defer bus.UnsubscribeTrades(s.subscription)
+
+	minute := int64(time.Minute)
+
+	// the first bucket is left to the database
+	s.addTrade(newTestTrade("BTC_ETH", 10*time.Second, 10, 1))
+	if imohlc, _ := s.popClosedBucket(testStart + minute); imohlc != nil {
+		t.Errorf("first bucket emitted")
+	}
+
+	// out of order trades of the second bucket
+	s.addTrade(newTestTrade("BTC_ETH", 70*time.Second, 11, 1))
+	s.addTrade(newTestTrade("BTC_ETH", 65*time.Second, 10.5, 2))
+	s.addTrade(newTestTrade("BTC_ETH", 80*time.Second, 10, 1))
+
+	imohlc, dirtySince := s.popClosedBucket(testStart + 2*minute)
+	if dirtySince != testStart {
+		t.Errorf("second bucket: got dirty since %d, want %d", dirtySince,
+			testStart)
+	}
+
+	got := imohlc[testStart+minute]["BTC_ETH"]
+	want := newTestOHLC(10.5, 11, 10, 10, 42)
+	if got == nil || got.open != want.open || got.high != want.high ||
+		got.low != want.low || got.close != want.close ||
+		got.volume != want.volume || got.quantity != 4 {
+		t.Errorf("second bucket: got %+v, want %+v", got, want)
+	}
+
+	// forward filled without trades, late trade marked for recomputation
+	s.addTrade(newTestTrade("BTC_ETH", 30*time.Second, 9, 1))
+
+	imohlc, _ = s.popClosedBucket(testStart + 3*minute)
+	if got := imohlc[testStart+2*minute]["BTC_ETH"]; got == nil ||
+		got.close != 10 || !got.filled {
+		t.Errorf("third bucket: got %+v, want filled at 10", got)
+	}
+	if s.dirtySince != testStart {
+		t.Errorf("late trade: got dirty since %d, want %d", s.dirtySince,
+			testStart)
+	}
+
+	// no longer filled once the last trade is older than the gap lookback
+	s.dataSource.GapLookback = time.Minute
+
+	imohlc, _ = s.popClosedBucket(testStart + 4*minute)
+	if got, ok := imohlc[testStart+3*minute]["BTC_ETH"]; ok {
+		t.Errorf("fourth bucket: got %+v, want no candle", got)
+	}
+	if _, ok := s.lastTrades["BTC_ETH"]; ok {
+		t.Errorf("fourth bucket: last trade of BTC_ETH kept")
+	}
+}
+
+func TestOHLCStreamUpdateLag(t *testing.T) {
+
+	s := newTestStream()
+	defer bus.UnsubscribeTrades(s.subscription)
+
+	minute := int64(time.Minute)
+	s.closedUntil = testStart
+
+	// marked 5s before the close, the trades may not be flushed yet
+	s.markDirty(testStart-2*minute, testStart+minute-int64(5*time.Second))
+
+	if _, dirtySince := s.popClosedBucket(testStart + minute); dirtySince != 0 {
+		t.Errorf("within update lag: got dirty since %d, want 0", dirtySince)
+	}
+
+	_, dirtySince := s.popClosedBucket(testStart + 2*minute)
+	if dirtySince != testStart-2*minute {
+		t.Errorf("after update lag: got dirty since %d, want %d", dirtySince,
+			testStart-2*minute)
+	}
+
+	if _, dirtySince := s.popClosedBucket(testStart + 3*minute); dirtySince != 0 {
+		t.Errorf("recomputed: got dirty since %d, want 0", dirtySince)
+	}
+}
@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"trading/networking"
+	"trading/networking/symbols"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// triangularConf sets the exchanges scanned for three legs cycles starting
+// and ending in one of the start currencies. Cycles returning at least
+// min_return_bps after the taker fees (rate by exchange) are written.
+type triangularConf struct {
+	Frequency       string             `json:"frequency"`
+	Exchanges       []string           `json:"exchanges"`
+	StartCurrencies []string           `json:"start_currencies"`
+	TakerFees       map[string]float64 `json:"taker_fees"`
+	MinReturnBps    float64            `json:"min_return_bps"`
+}
+
+// conversionLeg converts from into to on market at the best price of the
+// book. Capacity is the amount of from the best level can absorb.
+type conversionLeg struct {
+	market   string
+	from     string
+	to       string
+	side     string
+	rate     float64
+	capacity float64
+}
+
+type triangularArbitrage struct {
+	exchange    string
+	legs        []*conversionLeg
+	returnBps   float64
+	maxNotional float64
+}
+
+func computeTriangularArbitrages() {
+
+	if conf.Metrics.Triangular == nil {
+		return
+	}
+
+	f, err := time.ParseDuration(conf.Metrics.Triangular.Frequency)
+	if err != nil {
+		logger.WithField("error", err).Fatal(
+			"computeTriangularArbitrages: time.ParseDuration")
+	}
+
+	go networking.RunEvery(f, func(nextRun int64) {
+
+		books, _ := getLastBooks()
+
+		for _, exchange := range conf.Metrics.Triangular.Exchanges {
+
+			obs, ok := books[exchange]
+			if !ok {
+				continue
+			}
+
+			ind := &indicator{
+				nextRun:  nextRun,
+				period:   f,
+				exchange: exchange,
+			}
+
+			tas := getTriangularArbitrages(exchange, obs)
+			prepareTriangularArbitragesPoints(ind, tas)
+		}
+	})
+}
+
+// getConversionLegs returns the legs leaving each currency of the books:
+// buying the quote currency with the base at the best ask, selling it for
+// the base at the best bid (fees deducted from the rates).
+func getConversionLegs(exchange string,
+	obs orderBooks) map[string][]*conversionLeg {
+
+	fee := conf.Metrics.Triangular.TakerFees[exchange]
+	legs := make(map[string][]*conversionLeg)
+
+	for market, ob := range obs {
+
+		if len(ob.bids) == 0 || len(ob.asks) == 0 || ob.asks[0].rate == 0.0 {
+			continue
+		}
+
+		pair, err := symbols.Canonical(exchange, market)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": exchange,
+				"market":   market,
+			}).Debug("getConversionLegs: symbols.Canonical")
+			continue
+		}
+
+		ask, bid := ob.asks[0], ob.bids[0]
+
+		legs[pair.Base] = append(legs[pair.Base], &conversionLeg{
+			market:   market,
+			from:     pair.Base,
+			to:       pair.Quote,
+			side:     SideBuy,
+			rate:     (1 - fee) / ask.rate,
+			capacity: ask.rate * ask.quantity,
+		})
+
+		legs[pair.Quote] = append(legs[pair.Quote], &conversionLeg{
+			market:   market,
+			from:     pair.Quote,
+			to:       pair.Base,
+			side:     SideSell,
+			rate:     (1 - fee) * bid.rate,
+			capacity: bid.quantity,
+		})
+	}
+
+	return legs
+}
+
+// getTriangularArbitrages returns the profitable cycles of three legs from
+// each start currency. The max notional (start currency) is bounded by the
+// best level of each leg.
+func getTriangularArbitrages(exchange string,
+	obs orderBooks) []*triangularArbitrage {
+
+	tc := conf.Metrics.Triangular
+	legs := getConversionLegs(exchange, obs)
+	tas := make([]*triangularArbitrage, 0)
+
+	for _, start := range tc.StartCurrencies {
+		for _, leg1 := range legs[start] {
+			for _, leg2 := range legs[leg1.to] {
+
+				if leg2.to == start {
+					continue
+				}
+
+				for _, leg3 := range legs[leg2.to] {
+
+					if leg3.to != start {
+						continue
+					}
+
+					cycle := []*conversionLeg{leg1, leg2, leg3}
+
+					// amount of start currency converted so far per unit
+					converted := 1.0
+					maxNotional := math.MaxFloat64
+
+					for _, leg := range cycle {
+						maxNotional = math.Min(maxNotional, leg.capacity/converted)
+						converted *= leg.rate
+					}
+
+					returnBps := (converted - 1) * 10000
+					if returnBps < tc.MinReturnBps {
+						continue
+					}
+
+					tas = append(tas, &triangularArbitrage{
+						exchange:    exchange,
+						legs:        cycle,
+						returnBps:   returnBps,
+						maxNotional: maxNotional,
+					})
+				}
+			}
+		}
+	}
+
+	return tas
+}
+
+func (ta *triangularArbitrage) path() string {
+
+	currencies := []string{ta.legs[0].from}
+	for _, leg := range ta.legs {
+		currencies = append(currencies, leg.to)
+	}
+
+	return strings.Join(currencies, ">")
+}
+
+func prepareTriangularArbitragesPoints(ind *indicator,
+	tas []*triangularArbitrage) {
+
+	measurement, ok := conf.Metrics.Schema["triangular_arbitrages_measurement"]
+	if !ok {
+		return
+	}
+
+	timestamp := time.Unix(0, ind.nextRun)
+	points := make([]*ifxClient.Point, 0, len(tas))
+
+	for _, ta := range tas {
+
+		tags := map[string]string{
+			"exchange": ta.exchange,
+			"path":     ta.path(),
+			"start":    ta.legs[0].from,
+		}
+
+		fields := map[string]interface{}{
+			"return_bps":   ta.returnBps,
+			"max_notional": ta.maxNotional,
+		}
+
+		for i, leg := range ta.legs {
+			prefix := "leg" + strconv.Itoa(i+1) + "_"
+			fields[prefix+"market"] = leg.market
+			fields[prefix+"side"] = leg.side
+			fields[prefix+"rate"] = leg.rate
+		}
+
+		pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareTriangularArbitragesPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	sendBatchPoints(ind, "TriangularArbitrages", points)
+}
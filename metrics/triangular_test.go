@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGetTriangularArbitrages(t *testing.T) {
+
+	defer func(c *triangularConf) { conf.Metrics.Triangular = c }(
+		conf.Metrics.Triangular)
+
+	book := func(bid, ask float64) *orderBook {
+		return &orderBook{
+			bids: []*order{{rate: bid, quantity: 10}},
+			asks: []*order{{rate: ask, quantity: 10}},
+		}
+	}
+
+	// BTC to ETH at 0.05, ETH to XMR at 0.2 and back to BTC at 0.0102
+	obs := orderBooks{
+		"BTC_ETH": book(0.049, 0.05),
+		"ETH_XMR": book(0.19, 0.2),
+		"BTC_XMR": book(0.0102, 0.0105),
+		"BTC_LTC": {bids: []*order{{rate: 0.01, quantity: 1}}},
+	}
+
+	fee := 0.001
+	converted := 1.02 * math.Pow(1-fee, 3)
+
+	tests := []struct {
+		name         string
+		minReturnBps float64
+		want         int
+	}{
+		{"above min return", 150, 1},
+		{"below min return", 200, 0},
+	}
+
+	for _, tt := range tests {
+
+		conf.Metrics.Triangular = &triangularConf{
+			StartCurrencies: []string{"BTC"},
+			TakerFees:       map[string]float64{testExchange: fee},
+			MinReturnBps:    tt.minReturnBps,
+		}
+
+		tas := getTriangularArbitrages(testExchange, obs)
+		if len(tas) != tt.want {
+			t.Errorf("%s: got %d cycles, want %d", tt.name, len(tas), tt.want)
+			continue
+		}
+
+		if tt.want == 0 {
+			continue
+		}
+
+		// bounded by the best ask of ETH_XMR: 2 ETH for 19.98 ETH per BTC
+		ta := tas[0]
+		if ta.path() != "BTC>ETH>XMR>BTC" ||
+			!approxEqual(ta.returnBps, (converted-1)*10000) ||
+			!approxEqual(ta.maxNotional, 2/(20*(1-fee))) {
+			t.Errorf("%s: got %s %v bps up to %v", tt.name, ta.path(),
+				ta.returnBps, ta.maxNotional)
+		}
+
+		if ta.legs[0].side != SideBuy || ta.legs[1].side != SideBuy ||
+			ta.legs[2].side != SideSell {
+			t.Errorf("%s: got sides %s, %s, %s", tt.name, ta.legs[0].side,
+				ta.legs[1].side, ta.legs[2].side)
+		}
+	}
+}
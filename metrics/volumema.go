@@ -0,0 +1,148 @@
+package metrics
+
+import (
+	"fmt"
+)
+
+func getVolumeMA(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "volume_ma")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeVolumeMA(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeVolumeMA: no result")
+	}
+
+	updateCacheLastFields(ind, imfields)
+	prepareFieldsPoints(ind, "VolumeMA", imfields)
+
+	return ind, nil
+}
+
+// computeVolumeMA computes the simple and exponential moving averages of the
+// volume. Without a previous ema, the ema is seeded with the sma.
+func computeVolumeMA(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	lengths := conf.Metrics.Volume.MALengths
+
+	emaNames := make([]string, len(lengths))
+	for i, length := range lengths {
+		emaNames[i] = fmt.Sprintf("ema_%d", length)
+	}
+
+	lastMfields := getLastMfields(ind, emaNames)
+	if lastMfields == nil {
+		return nil
+	}
+
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, ohlc := range imohlc[interval] {
+
+			fields := make(indicatorFields, 2*len(lengths))
+
+			for i, length := range lengths {
+
+				var sma float64
+				window := getOHLCWindow(imohlc, ind.period, interval, market, length)
+
+				if window != nil {
+					sma = averageVolume(window)
+					fields[fmt.Sprintf("sma_%d", length)] = sma
+				}
+
+				if emaSeed, ok := lastMfields[market][emaNames[i]]; ok {
+
+					multiplier := 2.0 / float64(length+1)
+					fields[emaNames[i]] = multiplier*ohlc.volume + (1-multiplier)*emaSeed
+
+				} else if window != nil {
+					fields[emaNames[i]] = sma
+				}
+			}
+
+			imfields[interval][market] = fields
+			lastMfields[market] = fields
+		}
+	}
+
+	return imfields
+}
+
+func getRelativeVolume(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "relative_volume")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeRelativeVolume(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeRelativeVolume: no result")
+	}
+
+	prepareFieldsPoints(ind, "RelativeVolume", imfields)
+
+	return ind, nil
+}
+
+// computeRelativeVolume computes the ratio of the volume of each interval to
+// the average volume of the length preceding intervals.
+func computeRelativeVolume(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	lengths := conf.Metrics.Volume.RelativeVolumeLengths
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, ohlc := range imohlc[interval] {
+
+			fields := make(indicatorFields, len(lengths))
+
+			for _, length := range lengths {
+
+				window := getOHLCWindow(imohlc, ind.period,
+					interval-int64(ind.period), market, length)
+				if window == nil {
+					continue
+				}
+
+				if average := averageVolume(window); average != 0.0 {
+					fields[fmt.Sprintf("relative_volume_%d", length)] =
+						ohlc.volume / average
+				}
+			}
+
+			imfields[interval][market] = fields
+		}
+	}
+
+	return imfields
+}
+
+func averageVolume(window []*ohlc) float64 {
+
+	sum := 0.0
+	for _, ohlc := range window {
+		sum += ohlc.volume
+	}
+
+	return sum / float64(len(window))
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+var testVolumeCandles = []*ohlc{
+	newTestOHLC(10, 10, 10, 10, 10),
+	newTestOHLC(10, 10, 10, 10, 20),
+	newTestOHLC(10, 10, 10, 10, 30),
+	newTestOHLC(10, 10, 10, 10, 60),
+}
+
+func TestComputeVolumeMA(t *testing.T) {
+
+	defer func(v *volumeConf) { conf.Metrics.Volume = v }(conf.Metrics.Volume)
+	conf.Metrics.Volume = &volumeConf{MALengths: []int{2, 5}}
+
+	tests := []struct {
+		name string
+		last indicatorFields
+		want indicatorFields
+	}{
+		{
+			name: "ema seeded with the sma",
+			want: indicatorFields{"sma_2": 45, "ema_2": 45},
+		},
+		{
+			// 2/3 * 60 + 1/3 * 30 and 1/3 * 60 + 2/3 * 30
+			name: "ema from the last values",
+			last: indicatorFields{"ema_2": 30, "ema_5": 30},
+			want: indicatorFields{"sma_2": 45, "ema_2": 50, "ema_5": 40},
+		},
+	}
+
+	for _, tt := range tests {
+
+		ind := newTestIndicator(time.Minute, 1)
+		ind.destination = "volume_ma_1m"
+		setTestOHLC(ind.period, 3, "BTC_ETH", testVolumeCandles)
+
+		mfields := map[string]indicatorFields{}
+		if tt.last != nil {
+			mfields["BTC_ETH"] = tt.last
+		}
+		setTestFields(ind, mfields)
+
+		got := computeVolumeMA(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
+
+func TestComputeRelativeVolume(t *testing.T) {
+
+	defer func(v *volumeConf) { conf.Metrics.Volume = v }(conf.Metrics.Volume)
+	conf.Metrics.Volume = &volumeConf{RelativeVolumeLengths: []int{2, 3, 4}}
+
+	ind := newTestIndicator(time.Minute, 1)
+	setTestOHLC(ind.period, 3, "BTC_ETH", testVolumeCandles)
+
+	got := computeRelativeVolume(ind)[testStart]["BTC_ETH"]
+	assertFields(t, "relative volume", got,
+		indicatorFields{"relative_volume_2": 2.4, "relative_volume_3": 3})
+}
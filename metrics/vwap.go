@@ -0,0 +1,509 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+type vwapConf struct {
+	WindowsStr      []string `json:"windows"`
+	Windows         []time.Duration
+	Anchors         []string  `json:"anchors"`
+	BandMultipliers []float64 `json:"band_multipliers"`
+}
+
+// vwapBucket holds the trade sums of a market over a base period bucket:
+// volume is sum(rate * quantity) and volumeRate is sum(rate^2 * quantity).
+type vwapBucket struct {
+	volume     float64
+	quantity   float64
+	volumeRate float64
+}
+
+type vwap struct {
+	vwap     float64
+	stdDev   float64
+	volume   float64
+	quantity float64
+}
+
+type vwapState struct {
+	buckets  map[int64]map[string]*vwapBucket
+	anchored map[string]*anchoredVWAPState
+}
+
+// anchoredVWAPState holds the sums of the buckets in [start, sealed), sealed
+// being the first time interval that may still be updated.
+type anchoredVWAPState struct {
+	start  int64
+	sealed int64
+	sums   map[string]*vwapBucket
+}
+
+func computeVWAPs() {
+
+	if conf.Metrics.VWAP == nil {
+		return
+	}
+
+	indexPeriod := 0
+
+	for exchange, _ := range conf.Metrics.Sources {
+
+		ind := &indicator{
+			period:      conf.Metrics.OhlcPeriods[indexPeriod],
+			indexPeriod: indexPeriod,
+			dataSource:  conf.Metrics.Sources[exchange],
+			destination: "vwap",
+			exchange:    exchange,
+		}
+
+		state := &vwapState{
+			anchored: make(map[string]*anchoredVWAPState,
+				len(conf.Metrics.VWAP.Anchors)),
+		}
+
+		go networking.RunEvery(conf.Metrics.Frequency, func(nextRun int64) {
+
+			ind.nextRun = nextRun
+			ind.computeTimeIntervals(0)
+
+			if !updateVWAPBuckets(ind, state) {
+				return
+			}
+
+			for i, window := range conf.Metrics.VWAP.Windows {
+
+				imvwap := computeRollingVWAP(ind, state, window)
+				measurement := "vwap_" + conf.Metrics.VWAP.WindowsStr[i]
+				prepareVWAPPoints(ind, measurement, nil, imvwap)
+			}
+
+			for _, anchor := range conf.Metrics.VWAP.Anchors {
+
+				imvwap := computeAnchoredVWAP(ind, state, anchor)
+				tags := map[string]string{"anchor": anchor}
+				prepareVWAPPoints(ind, "anchored_vwap", tags, imvwap)
+			}
+
+			trimVWAPBuckets(ind, state)
+		})
+	}
+}
+
+// updateVWAPBuckets replaces the buckets of the time intervals that may still
+// be updated, loading the buckets of the longest window on the first run.
+func updateVWAPBuckets(ind *indicator, state *vwapState) bool {
+
+	start := ind.timeIntervals[0]
+	if state.buckets == nil {
+		start -= int64(maxVWAPWindow())
+	}
+
+	imbucket := getVWAPBuckets(ind, start, ind.nextRun)
+	if imbucket == nil {
+		return false
+	}
+
+	if state.buckets == nil {
+		state.buckets = make(map[int64]map[string]*vwapBucket, len(imbucket))
+	}
+
+	for _, interval := range ind.timeIntervals {
+		state.buckets[interval] = make(map[string]*vwapBucket)
+	}
+
+	for interval, mbucket := range imbucket {
+		state.buckets[interval] = mbucket
+	}
+
+	return true
+}
+
+func trimVWAPBuckets(ind *indicator, state *vwapState) {
+
+	oldest := ind.timeIntervals[0] - int64(maxVWAPWindow())
+
+	for interval, _ := range state.buckets {
+		if interval < oldest {
+			delete(state.buckets, interval)
+		}
+	}
+}
+
+func maxVWAPWindow() time.Duration {
+
+	var window time.Duration
+	for _, w := range conf.Metrics.VWAP.Windows {
+		if w > window {
+			window = w
+		}
+	}
+
+	return window
+}
+
+func computeRollingVWAP(ind *indicator, state *vwapState,
+	window time.Duration) map[int64]map[string]*vwap {
+
+	imvwap := make(map[int64]map[string]*vwap, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		sums := make(map[string]*vwapBucket)
+		first := interval - int64(window) + int64(ind.period)
+
+		for bi := first; bi <= interval; bi += int64(ind.period) {
+			addVWAPBuckets(sums, state.buckets[bi])
+		}
+
+		imvwap[interval] = formatVWAP(sums)
+	}
+
+	return imvwap
+}
+
+func computeAnchoredVWAP(ind *indicator, state *vwapState,
+	anchor string) map[int64]map[string]*vwap {
+
+	sealed := ind.timeIntervals[0]
+
+	start, ok := getAnchorStart(anchor, sealed)
+	if !ok {
+		start = sealed
+	}
+
+	as, ok := state.anchored[anchor]
+	if !ok || as.start != start {
+
+		sums := make(map[string]*vwapBucket)
+		if start < sealed {
+			if sums = getVWAPSums(ind, start, sealed); sums == nil {
+				return nil
+			}
+		}
+
+		as = &anchoredVWAPState{start, sealed, sums}
+		state.anchored[anchor] = as
+	}
+
+	for ; as.sealed < sealed; as.sealed += int64(ind.period) {
+		addVWAPBuckets(as.sums, state.buckets[as.sealed])
+	}
+
+	imvwap := make(map[int64]map[string]*vwap, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		intervalStart, ok := getAnchorStart(anchor, interval)
+		if !ok {
+			continue
+		}
+
+		sums := make(map[string]*vwapBucket)
+		first := intervalStart
+
+		if intervalStart == as.start {
+			addVWAPBuckets(sums, as.sums)
+			first = as.sealed
+		}
+
+		for bi := first; bi <= interval; bi += int64(ind.period) {
+			addVWAPBuckets(sums, state.buckets[bi])
+		}
+
+		imvwap[interval] = formatVWAP(sums)
+	}
+
+	return imvwap
+}
+
+// getAnchorStart returns the beginning of the anchored period containing
+// interval: the UTC day or week (starting on monday) or a fixed timestamp.
+func getAnchorStart(anchor string, interval int64) (int64, bool) {
+
+	t := time.Unix(0, interval).UTC()
+
+	switch anchor {
+
+	case "day":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.UnixNano(), true
+
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset).UnixNano(), true
+	}
+
+	start, err := time.Parse(time.RFC3339, anchor)
+	if err != nil || start.UnixNano() > interval {
+		return 0, false
+	}
+
+	return start.UnixNano(), true
+}
+
+func addVWAPBuckets(sums, mbucket map[string]*vwapBucket) {
+
+	for market, bucket := range mbucket {
+
+		if _, ok := sums[market]; !ok {
+			sums[market] = &vwapBucket{}
+		}
+
+		sums[market].volume += bucket.volume
+		sums[market].quantity += bucket.quantity
+		sums[market].volumeRate += bucket.volumeRate
+	}
+}
+
+func formatVWAP(sums map[string]*vwapBucket) map[string]*vwap {
+
+	mvwap := make(map[string]*vwap, len(sums))
+
+	for market, sum := range sums {
+
+		if sum.quantity == 0.0 {
+			continue
+		}
+
+		vwapValue := sum.volume / sum.quantity
+		variance := sum.volumeRate/sum.quantity - vwapValue*vwapValue
+
+		mvwap[market] = &vwap{
+			vwap:     vwapValue,
+			stdDev:   math.Sqrt(math.Max(variance, 0.0)),
+			volume:   sum.volume,
+			quantity: sum.quantity,
+		}
+	}
+
+	return mvwap
+}
+
+func getVWAPBuckets(ind *indicator,
+	start, end int64) map[int64]map[string]*vwapBucket {
+
+	query := fmt.Sprintf(
+		`SELECT SUM(total) AS volume,
+      SUM(quantity) AS quantity,
+      SUM(total_rate) AS volume_rate
+    FROM (
+      SELECT total, quantity, total * rate AS total_rate
+      FROM %s
+      WHERE time >= %d AND time < %d
+      GROUP BY market)
+    WHERE time >= %d AND time < %d
+    GROUP BY time(%s), market fill(none)`,
+		ind.dataSource.Schema["trades_measurement"],
+		start, end, start, end,
+		ind.period)
+
+	res := queryVWAP(ind, query)
+	if res == nil {
+		return nil
+	}
+
+	imbucket := make(map[int64]map[string]*vwapBucket)
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+
+		for _, rec := range serie.Values {
+
+			timestamp, bucket := formatVWAPBucket(ind, market, rec)
+			if bucket == nil {
+				continue
+			}
+
+			if _, ok := imbucket[timestamp]; !ok {
+				imbucket[timestamp] = make(map[string]*vwapBucket)
+			}
+			imbucket[timestamp][market] = bucket
+		}
+	}
+
+	return imbucket
+}
+
+func getVWAPSums(ind *indicator, start, end int64) map[string]*vwapBucket {
+
+	query := fmt.Sprintf(
+		`SELECT SUM(total) AS volume,
+      SUM(quantity) AS quantity,
+      SUM(total_rate) AS volume_rate
+    FROM (
+      SELECT total, quantity, total * rate AS total_rate
+      FROM %s
+      WHERE time >= %d AND time < %d
+      GROUP BY market)
+    GROUP BY market`,
+		ind.dataSource.Schema["trades_measurement"],
+		start, end)
+
+	res := queryVWAP(ind, query)
+	if res == nil {
+		return nil
+	}
+
+	sums := make(map[string]*vwapBucket, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+
+		if _, bucket := formatVWAPBucket(ind, market, serie.Values[0]); bucket != nil {
+			sums[market] = bucket
+		}
+	}
+
+	return sums
+}
+
+func queryVWAP(ind *indicator, query string) []ifxClient.Result {
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(
+			dbClient, query, ind.dataSource.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   ind.period,
+		ErrorMsg: "queryVWAP: database.QueryDB",
+		Request:  request,
+	})
+
+	if !success {
+		return nil
+	}
+
+	return res
+}
+
+func formatVWAPBucket(ind *indicator, market string,
+	rec []interface{}) (int64, *vwapBucket) {
+
+	if rec[0] == nil || rec[1] == nil || rec[2] == nil || rec[3] == nil {
+		return 0, nil
+	}
+
+	timestamp, err := networking.ConvertJsonValueToTime(rec[0])
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"exchange": ind.exchange,
+			"market":   market,
+		}).Error("formatVWAPBucket: networking.ConvertJsonValueToTime")
+		return 0, nil
+	}
+
+	values := make([]float64, 3)
+
+	for i := range values {
+
+		values[i], err = networking.ConvertJsonValueToFloat64(rec[i+1])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": ind.exchange,
+				"market":   market,
+			}).Error("formatVWAPBucket: networking.ConvertJsonValueToFloat64")
+			return 0, nil
+		}
+	}
+
+	return timestamp.UnixNano(), &vwapBucket{values[0], values[1], values[2]}
+}
+
+func prepareVWAPPoints(ind *indicator, measurement string,
+	extraTags map[string]string, imvwap map[int64]map[string]*vwap) {
+
+	points := make([]*ifxClient.Point, 0)
+
+	for interval, mvwap := range imvwap {
+
+		timestamp := time.Unix(0, interval)
+
+		for market, vwap := range mvwap {
+
+			tags := map[string]string{
+				"market":   market,
+				"exchange": ind.exchange,
+			}
+
+			for key, value := range extraTags {
+				tags[key] = value
+			}
+
+			fields := map[string]interface{}{
+				"vwap":     vwap.vwap,
+				"std_dev":  vwap.stdDev,
+				"volume":   vwap.volume,
+				"quantity": vwap.quantity,
+			}
+
+			for _, m := range conf.Metrics.VWAP.BandMultipliers {
+
+				multiplier := strconv.FormatFloat(m, 'f', -1, 64)
+				fields["upper_band_"+multiplier] = vwap.vwap + m*vwap.stdDev
+				fields["lower_band_"+multiplier] = vwap.vwap - m*vwap.stdDev
+			}
+
+			pt, err := ifxClient.NewPoint(measurement, tags, fields, timestamp)
+			if err != nil {
+				logger.WithField("error", err).Error(
+					"prepareVWAPPoints: ifxClient.NewPoint")
+			}
+			points = append(points, pt)
+		}
+	}
+
+	sendBatchPoints(ind, "VWAP", points)
+}
+
+func (v *vwapConf) UnmarshalJSON(data []byte) error {
+
+	type alias vwapConf
+	aux := (*alias)(v)
+
+	if err := json.Unmarshal(data, aux); err != nil {
+		return fmt.Errorf("json.Unmarshal: %v", err)
+	}
+
+	v.Windows = make([]time.Duration, len(v.WindowsStr))
+	for i, w := range v.WindowsStr {
+
+		window, err := time.ParseDuration(w)
+		if err != nil {
+			return fmt.Errorf("time.ParseDuration: %v", err)
+		}
+		v.Windows[i] = window
+	}
+
+	for _, anchor := range v.Anchors {
+
+		if anchor == "day" || anchor == "week" {
+			continue
+		}
+
+		if _, err := time.Parse(time.RFC3339, anchor); err != nil {
+			return fmt.Errorf("time.Parse: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetAnchorStart(t *testing.T) {
+
+	at := func(value string) int64 {
+		ts, _ := time.Parse(time.RFC3339, value)
+		return ts.UnixNano()
+	}
+
+	tests := []struct {
+		anchor   string
+		interval string
+		want     string
+		ok       bool
+	}{
+		{"day", "2017-10-04T13:05:00Z", "2017-10-04T00:00:00Z", true},
+		{"day", "2017-10-04T00:00:00Z", "2017-10-04T00:00:00Z", true},
+		{"week", "2017-10-04T13:05:00Z", "2017-10-02T00:00:00Z", true},
+		{"week", "2017-10-08T23:59:00Z", "2017-10-02T00:00:00Z", true},
+		{"week", "2017-10-09T00:00:00Z", "2017-10-09T00:00:00Z", true},
+		{"2017-10-01T12:00:00Z", "2017-10-04T13:05:00Z",
+			"2017-10-01T12:00:00Z", true},
+		{"2017-10-05T00:00:00Z", "2017-10-04T13:05:00Z", "", false},
+		{"month", "2017-10-04T13:05:00Z", "", false},
+	}
+
+	for _, tt := range tests {
+
+		got, ok := getAnchorStart(tt.anchor, at(tt.interval))
+		if ok != tt.ok || ok && got != at(tt.want) {
+			t.Errorf("%s at %s: got %s (%t), want %s (%t)", tt.anchor,
+				tt.interval, time.Unix(0, got).UTC(), ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFormatVWAP(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		sum    *vwapBucket
+		want   *vwap
+		wantOk bool
+	}{
+		{
+			// 1 at 10 and 1 at 20
+			name:   "two trades",
+			sum:    &vwapBucket{volume: 30, quantity: 2, volumeRate: 500},
+			want:   &vwap{vwap: 15, stdDev: 5, volume: 30, quantity: 2},
+			wantOk: true,
+		},
+		{
+			name:   "single rate",
+			sum:    &vwapBucket{volume: 30, quantity: 3, volumeRate: 300},
+			want:   &vwap{vwap: 10, stdDev: 0, volume: 30, quantity: 3},
+			wantOk: true,
+		},
+		{
+			name: "no quantity",
+			sum:  &vwapBucket{},
+		},
+	}
+
+	for _, tt := range tests {
+
+		got, ok := formatVWAP(map[string]*vwapBucket{"BTC_ETH": tt.sum})["BTC_ETH"]
+		if ok != tt.wantOk {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+
+		if ok && (!approxEqual(got.vwap, tt.want.vwap) ||
+			!approxEqual(got.stdDev, tt.want.stdDev) ||
+			got.volume != tt.want.volume || got.quantity != tt.want.quantity) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestComputeRollingVWAP(t *testing.T) {
+
+	ind := newTestIndicator(time.Minute, 2)
+	period := int64(ind.period)
+
+	state := &vwapState{buckets: map[int64]map[string]*vwapBucket{
+		testStart - 2*period: {"BTC_ETH": {10, 1, 100}},
+		testStart - period:   {"BTC_ETH": {20, 1, 400}},
+		testStart:            {"BTC_ETH": {60, 2, 1800}},
+		testStart + period:   {},
+	}}
+
+	tests := []struct {
+		window time.Duration
+		want   []float64 // vwap of each interval
+	}{
+		{time.Minute, []float64{30}},
+		{2 * time.Minute, []float64{80.0 / 3, 30}},
+		{3 * time.Minute, []float64{90.0 / 4, 80.0 / 3}},
+	}
+
+	for _, tt := range tests {
+
+		imvwap := computeRollingVWAP(ind, state, tt.window)
+
+		for i, want := range tt.want {
+
+			got := imvwap[ind.timeIntervals[i]]["BTC_ETH"]
+			if got == nil || !approxEqual(got.vwap, want) {
+				t.Errorf("window %s: interval %d: got %+v, want %v",
+					tt.window, i, got, want)
+			}
+		}
+	}
+}
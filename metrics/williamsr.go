@@ -0,0 +1,60 @@
+package metrics
+
+import "fmt"
+
+func getWilliamsR(from *indicator) (*indicator, error) {
+
+	ind := deriveIndicator(from, "williams_r")
+
+	ind.computeTimeIntervals(0)
+
+	imfields := computeWilliamsR(ind)
+	if imfields == nil {
+		return nil, fmt.Errorf("computeWilliamsR: no result")
+	}
+
+	prepareFieldsPoints(ind, "WilliamsR", imfields)
+
+	return ind, nil
+}
+
+func computeWilliamsR(ind *indicator) map[int64]map[string]indicatorFields {
+
+	imohlc := getCachedLastOHLC(ind)
+	if imohlc == nil {
+		return nil
+	}
+
+	lengths := conf.Metrics.Oscillators.WilliamsR.Lengths
+	imfields := make(map[int64]map[string]indicatorFields, len(ind.timeIntervals))
+
+	for _, interval := range ind.timeIntervals {
+
+		imfields[interval] = make(map[string]indicatorFields, len(imohlc[interval]))
+
+		for market, ohlc := range imohlc[interval] {
+
+			fields := make(indicatorFields, len(lengths))
+
+			for _, length := range lengths {
+
+				window := getOHLCWindow(imohlc, ind.period, interval, market, length)
+				if window == nil {
+					continue
+				}
+
+				wr := -50.0
+				high, low := highestHighLowestLow(window)
+				if high != low {
+					wr = -100.0 * (high - ohlc.close) / (high - low)
+				}
+
+				fields[fmt.Sprintf("williams_r_%d", length)] = wr
+			}
+
+			imfields[interval][market] = fields
+		}
+	}
+
+	return imfields
+}
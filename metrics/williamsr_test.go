@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeWilliamsR(t *testing.T) {
+
+	defer func(o *oscillatorsConf) { conf.Metrics.Oscillators = o }(
+		conf.Metrics.Oscillators)
+
+	tests := []struct {
+		name    string
+		lengths []int
+		candles []*ohlc
+		want    indicatorFields
+	}{
+		{
+			name:    "close within range",
+			lengths: []int{3, 4},
+			candles: testOscillatorCandles,
+			want:    indicatorFields{"williams_r_3": -75, "williams_r_4": -60},
+		},
+		{
+			name:    "flat range",
+			lengths: []int{2},
+			candles: []*ohlc{newTestOHLC(5, 5, 5, 5, 1), newTestOHLC(5, 5, 5, 5, 1)},
+			want:    indicatorFields{"williams_r_2": -50},
+		},
+		{
+			name:    "window longer than the candles",
+			lengths: []int{5},
+			candles: testOscillatorCandles,
+			want:    indicatorFields{},
+		},
+	}
+
+	for _, tt := range tests {
+
+		conf.Metrics.Oscillators = &oscillatorsConf{
+			WilliamsR: &lengthsConf{tt.lengths},
+		}
+
+		ind := newTestIndicator(time.Minute, 1)
+		setTestOHLC(ind.period, len(tt.candles)-1, "BTC_ETH", tt.candles)
+
+		got := computeWilliamsR(ind)[testStart]["BTC_ETH"]
+		assertFields(t, tt.name, got, tt.want)
+	}
+}
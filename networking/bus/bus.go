@@ -0,0 +1,92 @@
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var trades = &tradeSubscriptions{}
+
+// Trade is a trade published by the ingestion of an exchange.
+type Trade struct {
+	Exchange string
+	Market   string
+	Time     time.Time
+	Rate     float64
+	Quantity float64
+	Total    float64
+}
+
+// TradeSubscription receives the trades published on an exchange (all
+// exchanges if empty). Trades are dropped rather than blocking the
+// ingestion when the subscription is full.
+type TradeSubscription struct {
+	C        <-chan *Trade
+	c        chan *Trade
+	exchange string
+	dropped  int64
+}
+
+type tradeSubscriptions struct {
+	sync.RWMutex
+	subscriptions []*TradeSubscription
+}
+
+func SubscribeTrades(exchange string, capacity int) *TradeSubscription {
+
+	c := make(chan *Trade, capacity)
+
+	s := &TradeSubscription{
+		C:        c,
+		c:        c,
+		exchange: exchange,
+	}
+
+	trades.Lock()
+	defer trades.Unlock()
+
+	trades.subscriptions = append(trades.subscriptions, s)
+
+	return s
+}
+
+func UnsubscribeTrades(s *TradeSubscription) {
+
+	trades.Lock()
+	defer trades.Unlock()
+
+	for i, subscription := range trades.subscriptions {
+		if subscription == s {
+			trades.subscriptions = append(trades.subscriptions[:i],
+				trades.subscriptions[i+1:]...)
+			close(s.c)
+			return
+		}
+	}
+}
+
+// PublishTrade sends trade to every subscription without blocking.
+func PublishTrade(trade *Trade) {
+
+	trades.RLock()
+	defer trades.RUnlock()
+
+	for _, s := range trades.subscriptions {
+
+		if s.exchange != "" && s.exchange != trade.Exchange {
+			continue
+		}
+
+		select {
+		case s.c <- trade:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of trades dropped since the subscription.
+func (s *TradeSubscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
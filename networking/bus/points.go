@@ -0,0 +1,110 @@
+package bus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var points = &pointSubscriptions{}
+
+// Point is a point written by the metrics, published once computed.
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// PointSubscription receives the points of its measurements. Points are
+// dropped rather than blocking the metrics when the subscription is full.
+type PointSubscription struct {
+	C            <-chan *Point
+	c            chan *Point
+	measurements map[string]bool
+	dropped      int64
+}
+
+type pointSubscriptions struct {
+	sync.RWMutex
+	subscriptions []*PointSubscription
+}
+
+func SubscribePoints(measurements []string, capacity int) *PointSubscription {
+
+	c := make(chan *Point, capacity)
+
+	s := &PointSubscription{
+		C:            c,
+		c:            c,
+		measurements: make(map[string]bool, len(measurements)),
+	}
+
+	for _, measurement := range measurements {
+		s.measurements[measurement] = true
+	}
+
+	points.Lock()
+	defer points.Unlock()
+
+	points.subscriptions = append(points.subscriptions, s)
+
+	return s
+}
+
+func UnsubscribePoints(s *PointSubscription) {
+
+	points.Lock()
+	defer points.Unlock()
+
+	for i, subscription := range points.subscriptions {
+		if subscription == s {
+			points.subscriptions = append(points.subscriptions[:i],
+				points.subscriptions[i+1:]...)
+			close(s.c)
+			return
+		}
+	}
+}
+
+// Subscribed returns whether a subscription receives the points of
+// measurement.
+func Subscribed(measurement string) bool {
+
+	points.RLock()
+	defer points.RUnlock()
+
+	for _, s := range points.subscriptions {
+		if s.measurements[measurement] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PublishPoint sends point to the subscriptions of its measurement without
+// blocking.
+func PublishPoint(point *Point) {
+
+	points.RLock()
+	defer points.RUnlock()
+
+	for _, s := range points.subscriptions {
+
+		if !s.measurements[point.Measurement] {
+			continue
+		}
+
+		select {
+		case s.c <- point:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of points dropped since the subscription.
+func (s *PointSubscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
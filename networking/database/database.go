@@ -28,10 +28,12 @@ type influxdbConf struct {
 	LogLevel           string            `json:"log_level"`
 }
 
+// BatchPoints Callback is called once the points are written, with the
+// error of the write if it failed.
 type BatchPoints struct {
 	TypePoint string
 	Points    []*ifxClient.Point
-	Callback  func()
+	Callback  func(error)
 }
 
 type FlushInfo struct {
@@ -77,8 +79,13 @@ func init() {
 		logrus.SetLevel(logrus.WarnLevel)
 	}
 
-	tlsConfig = &tls.Config{RootCAs: x509.NewCertPool()}
+	// system root CAs without certificate (tests, plain http)
 	certPath := conf.TlsCertificatePath
+	if certPath == "" {
+		return
+	}
+
+	tlsConfig = &tls.Config{RootCAs: x509.NewCertPool()}
 
 	if crt, err := ioutil.ReadFile(certPath); err != nil {
 		logger.WithField("error", err).Fatal("reading certificate")
@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	ifxClient "github.com/influxdata/influxdb/client/v2"
@@ -42,17 +43,19 @@ func flushBatchs(fi *FlushInfo, count int) {
 		bp.AddPoints(batchPoints.Points)
 	}
 
-	if err := fi.DbClient.Write(bp); err != nil {
-		logger.WithField("error", err).Error("flushBatchs: dbClient.Write")
-		return
-	}
+	err = fi.DbClient.Write(bp)
 
 	for _, batchPoints := range batchPointsArr {
 		if batchPoints.Callback != nil {
-			go batchPoints.Callback()
+			go batchPoints.Callback(err)
 		}
 	}
 
+	if err != nil {
+		logger.WithField("error", err).Error("flushBatchs: dbClient.Write")
+		return
+	}
+
 	if logrus.GetLevel() >= logrus.DebugLevel {
 
 		switch fi.Database {
@@ -193,122 +196,32 @@ func flushBittrexDebug(batchPointsArr []*BatchPoints) {
 
 func flushMetricsDebug(batchPointsArr []*BatchPoints) {
 
-	bittrexMarketDepthBatchCount, bittrexMarketDepthPointCount := 0, 0
-	poloniexMarketDepthBatchCount, poloniexMarketDepthPointCount := 0, 0
-	bittrexOHLCBatchCount, bittrexOHLCPointCount := 0, 0
-	poloniexOHLCBatchCount, poloniexOHLCPointCount := 0, 0
-	bittrexOBVBatchCount, bittrexOBVPointCount := 0, 0
-	poloniexOBVBatchCount, poloniexOBVPointCount := 0, 0
-	bittrexMABatchCount, bittrexMAPointCount := 0, 0
-	poloniexMABatchCount, poloniexMAPointCount := 0, 0
-	bittrexRSIBatchCount, bittrexRSIPointCount := 0, 0
-	poloniexRSIBatchCount, poloniexRSIPointCount := 0, 0
+	typePoints := make([]string, 0)
+	batchCounts := make(map[string]int)
+	pointCounts := make(map[string]int)
+	batchCount, pointCount := 0, 0
 
 	for _, batchPoints := range batchPointsArr {
-		switch batchPoints.TypePoint {
-
-		case "bittrexMarketDepth":
-			bittrexMarketDepthBatchCount++
-			bittrexMarketDepthPointCount += len(batchPoints.Points)
-
-		case "poloniexMarketDepth":
-			poloniexMarketDepthBatchCount++
-			poloniexMarketDepthPointCount += len(batchPoints.Points)
-
-		case "bittrexOHLC":
-			bittrexOHLCBatchCount++
-			bittrexOHLCPointCount += len(batchPoints.Points)
-
-		case "poloniexOHLC":
-			poloniexOHLCBatchCount++
-			poloniexOHLCPointCount += len(batchPoints.Points)
-
-		case "bittrexOBV":
-			bittrexOBVBatchCount++
-			bittrexOBVPointCount += len(batchPoints.Points)
-
-		case "poloniexOBV":
-			poloniexOBVBatchCount++
-			poloniexOBVPointCount += len(batchPoints.Points)
-
-		case "bittrexMA":
-			bittrexMABatchCount++
-			bittrexMAPointCount += len(batchPoints.Points)
-
-		case "poloniexMA":
-			poloniexMABatchCount++
-			poloniexMAPointCount += len(batchPoints.Points)
 
-		case "bittrexRSI":
-			bittrexRSIBatchCount++
-			bittrexRSIPointCount += len(batchPoints.Points)
-
-		case "poloniexRSI":
-			poloniexRSIBatchCount++
-			poloniexRSIPointCount += len(batchPoints.Points)
+		if _, ok := batchCounts[batchPoints.TypePoint]; !ok {
+			typePoints = append(typePoints, batchPoints.TypePoint)
 		}
-	}
 
-	toPrint := fmt.Sprintf("[Metrics Flush]: %d batchs (%d points)",
-		bittrexMarketDepthBatchCount+poloniexMarketDepthBatchCount+
-			bittrexOHLCBatchCount+poloniexOHLCBatchCount+
-			bittrexOBVBatchCount+poloniexOBVBatchCount+
-			bittrexMABatchCount+poloniexMABatchCount+
-			bittrexRSIBatchCount+poloniexRSIBatchCount,
-		bittrexMarketDepthPointCount+poloniexMarketDepthPointCount+
-			bittrexOHLCPointCount+poloniexOHLCPointCount+
-			bittrexOBVPointCount+poloniexOBVPointCount+
-			bittrexMAPointCount+poloniexMAPointCount+
-			bittrexRSIPointCount+poloniexRSIPointCount)
-
-	if bittrexMarketDepthBatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d bittrexMarketDepths (%d)",
-			bittrexMarketDepthBatchCount, bittrexMarketDepthPointCount)
-	}
+		batchCounts[batchPoints.TypePoint]++
+		pointCounts[batchPoints.TypePoint] += len(batchPoints.Points)
 
-	if poloniexMarketDepthBatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d poloniexMarketDepths (%d)",
-			poloniexMarketDepthBatchCount, poloniexMarketDepthPointCount)
+		batchCount++
+		pointCount += len(batchPoints.Points)
 	}
 
-	if bittrexOHLCBatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d bittrexOHLCs (%d)",
-			bittrexOHLCBatchCount, bittrexOHLCPointCount)
-	}
-
-	if poloniexOHLCBatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d poloniexOHLCs (%d)",
-			poloniexOHLCBatchCount, poloniexOHLCPointCount)
-	}
-
-	if bittrexOBVBatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d bittrexOBVs (%d)",
-			bittrexOBVBatchCount, bittrexOBVPointCount)
-	}
+	sort.Strings(typePoints)
 
-	if poloniexOBVBatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d poloniexOBVs (%d)",
-			poloniexOBVBatchCount, poloniexOBVPointCount)
-	}
-
-	if bittrexMABatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d bittrexMAs (%d)",
-			bittrexMABatchCount, bittrexMAPointCount)
-	}
-
-	if poloniexMABatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d poloniexMAs (%d)",
-			poloniexMABatchCount, poloniexMAPointCount)
-	}
-
-	if bittrexRSIBatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d bittrexRSIs (%d)",
-			bittrexRSIBatchCount, bittrexRSIPointCount)
-	}
+	toPrint := fmt.Sprintf("[Metrics Flush]: %d batchs (%d points)",
+		batchCount, pointCount)
 
-	if poloniexRSIBatchCount > 0 {
-		toPrint += fmt.Sprintf(" %d poloniexRSIs (%d)",
-			poloniexRSIBatchCount, poloniexRSIPointCount)
+	for _, typePoint := range typePoints {
+		toPrint += fmt.Sprintf(" %d %ss (%d)",
+			batchCounts[typePoint], typePoint, pointCounts[typePoint])
 	}
 
 	logger.Debug(toPrint)
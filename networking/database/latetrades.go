@@ -0,0 +1,27 @@
+package database
+
+import (
+	"time"
+	"trading/networking/symbols"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+)
+
+// NewLateTradesPoint returns the point marking for recomputation the buckets
+// of the count trades of market ingested late, from the oldest one.
+func NewLateTradesPoint(measurement, exchange, market string, oldest time.Time,
+	count int) (*ifxClient.Point, error) {
+
+	tags := map[string]string{
+		"source": "publicapi",
+		"market": market,
+	}
+	symbols.AddTags(exchange, market, measurement, tags)
+
+	fields := map[string]interface{}{
+		"oldest": oldest.UnixNano(),
+		"count":  count,
+	}
+
+	return ifxClient.NewPoint(measurement, tags, fields, time.Now())
+}
@@ -0,0 +1,219 @@
+package feed
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"trading/networking"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithField("prefix", "[feed]")
+
+const (
+	SideBuy  = "buy"
+	SideSell = "sell"
+)
+
+// Trade is a trade stored by the ingestion, Side being its order type.
+type Trade struct {
+	Market   string
+	Time     time.Time
+	Side     string
+	Rate     float64
+	Quantity float64
+	Total    float64
+}
+
+// Book is an order book stored by the ingestion, best levels first.
+type Book struct {
+	Market string
+	Time   time.Time
+	Bids   []*Level
+	Asks   []*Level
+}
+
+type Level struct {
+	Rate     float64
+	Quantity float64
+}
+
+// MarketsCondition returns the where clause restricting a query to markets
+// (all markets if none).
+func MarketsCondition(markets []string) string {
+
+	if len(markets) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" AND (market = '%s')",
+		strings.Join(markets, "' OR market = '"))
+}
+
+// TradesQuery returns the query of the trades of markets (all if empty)
+// within [start, end), read by ParseTrades.
+func TradesQuery(measurement string, start, end int64,
+	markets []string) string {
+
+	return fmt.Sprintf(
+		`SELECT rate, quantity, total, order_type
+    FROM %s
+    WHERE time >= %d AND time < %d%s
+    GROUP BY market`,
+		measurement, start, end, MarketsCondition(markets))
+}
+
+// BooksQuery returns the query of the order books of markets (all if empty)
+// within [start, end), read by ParseBooks.
+func BooksQuery(measurement string, start, end int64,
+	markets []string) string {
+
+	return fmt.Sprintf(
+		`SELECT rate, quantity, order_type
+    FROM %s
+    WHERE time >= %d AND time < %d%s
+    GROUP BY market`,
+		measurement, start, end, MarketsCondition(markets))
+}
+
+// ParseTrades returns the trades of the results of TradesQuery, records
+// that can't be converted being skipped.
+func ParseTrades(exchange string, res []ifxClient.Result) []*Trade {
+
+	trades := make([]*Trade, 0)
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+
+		for _, rec := range serie.Values {
+
+			trade, err := formatTrade(market, rec)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"exchange": exchange,
+					"market":   market,
+				}).Error("ParseTrades: formatTrade")
+				continue
+			}
+			trades = append(trades, trade)
+		}
+	}
+
+	return trades
+}
+
+func formatTrade(market string, rec []interface{}) (*Trade, error) {
+
+	timestamp, err := networking.ConvertJsonValueToTime(rec[0])
+	if err != nil {
+		return nil, err
+	}
+
+	rate, err := networking.ConvertJsonValueToFloat64(rec[1])
+	if err != nil {
+		return nil, err
+	}
+
+	quantity, err := networking.ConvertJsonValueToFloat64(rec[2])
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := networking.ConvertJsonValueToFloat64(rec[3])
+	if err != nil {
+		return nil, err
+	}
+
+	side, err := networking.ConvertJsonValueToString(rec[4])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trade{
+		Market:   market,
+		Time:     timestamp,
+		Side:     strings.ToLower(side),
+		Rate:     rate,
+		Quantity: quantity,
+		Total:    total,
+	}, nil
+}
+
+// ParseBooks returns the order books of the results of BooksQuery. The
+// orders of a book are written within the second of its check.
+func ParseBooks(exchange string, res []ifxClient.Result) []*Book {
+
+	books := make([]*Book, 0)
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+		var book *Book
+
+		for _, rec := range serie.Values {
+
+			timestamp, orderType, level, err := formatLevel(rec)
+			if err != nil {
+				logger.WithFields(logrus.Fields{
+					"error":    err,
+					"exchange": exchange,
+					"market":   market,
+				}).Error("ParseBooks: formatLevel")
+				continue
+			}
+
+			checked := timestamp.Truncate(time.Second)
+			if book == nil || !book.Time.Equal(checked) {
+				book = &Book{Market: market, Time: checked}
+				books = append(books, book)
+			}
+
+			if orderType == "bid" {
+				book.Bids = append(book.Bids, level)
+			} else {
+				book.Asks = append(book.Asks, level)
+			}
+		}
+	}
+
+	for _, b := range books {
+		sort.Slice(b.Bids, func(i, j int) bool {
+			return b.Bids[i].Rate > b.Bids[j].Rate
+		})
+		sort.Slice(b.Asks, func(i, j int) bool {
+			return b.Asks[i].Rate < b.Asks[j].Rate
+		})
+	}
+
+	return books
+}
+
+func formatLevel(rec []interface{}) (time.Time, string, *Level, error) {
+
+	timestamp, err := networking.ConvertJsonValueToTime(rec[0])
+	if err != nil {
+		return time.Time{}, "", nil, err
+	}
+
+	rate, err := networking.ConvertJsonValueToFloat64(rec[1])
+	if err != nil {
+		return time.Time{}, "", nil, err
+	}
+
+	quantity, err := networking.ConvertJsonValueToFloat64(rec[2])
+	if err != nil {
+		return time.Time{}, "", nil, err
+	}
+
+	orderType, err := networking.ConvertJsonValueToString(rec[3])
+	if err != nil {
+		return time.Time{}, "", nil, err
+	}
+
+	return timestamp, orderType, &Level{rate, quantity}, nil
+}
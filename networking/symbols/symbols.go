@@ -0,0 +1,156 @@
+package symbols
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	prefixed "github.com/x-cray/logrus-prefixed-formatter"
+)
+
+var (
+	conf   *configuration
+	logger *logrus.Entry
+)
+
+type configuration struct {
+	Symbols *symbolsConf `json:"symbols"`
+}
+
+// symbolsConf renames the currencies of an exchange to their canonical
+// ticker (aliases), sets the pair of the markets not following the exchange
+// format (markets) and lists the measurements whose points are not tagged
+// with the canonical symbols (untagged), by exchange. Every measurement is
+// tagged by default, measurements written before the tags being listed until
+// migrated (see schema.txt).
+type symbolsConf struct {
+	Aliases  map[string]map[string]string `json:"aliases"`
+	Markets  map[string]map[string]*Pair  `json:"markets"`
+	Untagged map[string][]string          `json:"untagged"`
+}
+
+// Pair is the canonical pair of a market. Following the exchanges, Base is
+// the currency prices and totals are expressed in (BTC for BTC_STRAT) and
+// Quote the currency traded (STRAT).
+type Pair struct {
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+}
+
+// separators of the base and quote currencies of the native markets
+var separators = map[string]string{
+	"poloniex": "_",
+	"bittrex":  "-",
+}
+
+func init() {
+
+	customFormatter := new(prefixed.TextFormatter)
+	customFormatter.FullTimestamp = true
+	customFormatter.ForceColors = true
+	customFormatter.ForceFormatting = true
+	logrus.SetFormatter(customFormatter)
+
+	logger = logrus.WithField("prefix", "[symbols]")
+
+	content, err := ioutil.ReadFile("conf.json")
+
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading configuration")
+	}
+
+	if err := json.Unmarshal(content, &conf); err != nil {
+		logger.WithField("error", err).Fatal("loading configuration")
+	}
+
+	if conf.Symbols == nil {
+		conf.Symbols = &symbolsConf{}
+	}
+}
+
+// Currency returns the canonical ticker of a currency of exchange.
+func Currency(exchange, currency string) string {
+
+	currency = strings.ToUpper(currency)
+
+	if canonical, ok := conf.Symbols.Aliases[exchange][currency]; ok {
+		return canonical
+	}
+
+	return currency
+}
+
+// Canonical returns the canonical pair of a native market of exchange.
+func Canonical(exchange, market string) (*Pair, error) {
+
+	if pair, ok := conf.Symbols.Markets[exchange][market]; ok {
+		return pair, nil
+	}
+
+	separator, ok := separators[exchange]
+	if !ok {
+		return nil, fmt.Errorf("unknown exchange: %s", exchange)
+	}
+
+	currencies := strings.Split(market, separator)
+	if len(currencies) != 2 || currencies[0] == "" || currencies[1] == "" {
+		return nil, fmt.Errorf("unknown market format: %s", market)
+	}
+
+	return &Pair{
+		Base:  Currency(exchange, currencies[0]),
+		Quote: Currency(exchange, currencies[1]),
+	}, nil
+}
+
+// Native returns the market of exchange trading pair (empty if none among
+// markets).
+func Native(exchange string, pair *Pair, markets []string) string {
+
+	for _, market := range markets {
+
+		p, err := Canonical(exchange, market)
+		if err == nil && *p == *pair {
+			return market
+		}
+	}
+
+	return ""
+}
+
+// Tagged tells if the points of measurement of exchange are tagged with the
+// canonical symbols.
+func Tagged(exchange, measurement string) bool {
+
+	for _, untagged := range conf.Symbols.Untagged[exchange] {
+		if untagged == measurement {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AddTags sets the base and quote tags of the points of a native market,
+// measurement being tagged.
+func AddTags(exchange, market, measurement string, tags map[string]string) {
+
+	if !Tagged(exchange, measurement) {
+		return
+	}
+
+	pair, err := Canonical(exchange, market)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"error":    err,
+			"exchange": exchange,
+			"market":   market,
+		}).Warn("AddTags: Canonical")
+		return
+	}
+
+	tags["base"] = pair.Base
+	tags["quote"] = pair.Quote
+}
@@ -0,0 +1,86 @@
+package symbols
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+
+	tests := []struct {
+		exchange string
+		market   string
+		want     *Pair
+	}{
+		{"poloniex", "BTC_ETH", &Pair{"BTC", "ETH"}},
+		{"poloniex", "BTC_STR", &Pair{"BTC", "XLM"}},
+		{"poloniex", "btc_eth", &Pair{"BTC", "ETH"}},
+		{"bittrex", "BTC-ETH", &Pair{"BTC", "ETH"}},
+		{"bittrex", "BTC-STR", &Pair{"BTC", "STR"}},
+		{"bittrex", "BTC-CUSTOM", &Pair{"BTC", "CST"}},
+		{"bittrex", "BTC_ETH", nil},
+		{"poloniex", "BTC_", nil},
+		{"kraken", "XBTETH", nil},
+	}
+
+	for _, tt := range tests {
+
+		got, err := Canonical(tt.exchange, tt.market)
+
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s %s: got %+v, want error", tt.exchange, tt.market,
+					got)
+			}
+			continue
+		}
+
+		if err != nil || *got != *tt.want {
+			t.Errorf("%s %s: got %+v (%v), want %+v", tt.exchange, tt.market,
+				got, err, tt.want)
+		}
+	}
+}
+
+func TestNative(t *testing.T) {
+
+	markets := []string{"BTC_ETH", "BTC_STR"}
+
+	if got := Native("poloniex", &Pair{"BTC", "XLM"}, markets); got != "BTC_STR" {
+		t.Errorf("aliased pair: got %s, want BTC_STR", got)
+	}
+
+	if got := Native("poloniex", &Pair{"ETH", "BTC"}, markets); got != "" {
+		t.Errorf("reversed pair: got %s, want none", got)
+	}
+}
+
+func TestAddTags(t *testing.T) {
+
+	tests := []struct {
+		exchange    string
+		market      string
+		measurement string
+		want        map[string]string
+	}{
+		{"poloniex", "BTC_STR", "trade_updates", map[string]string{
+			"market": "BTC_STR", "base": "BTC", "quote": "XLM"}},
+		{"poloniex", "BTC_STR", "ticks",
+			map[string]string{"market": "BTC_STR"}},
+		{"bittrex", "BTC-ETH", "market_summaries", map[string]string{
+			"market": "BTC-ETH", "base": "BTC", "quote": "ETH"}},
+		{"bittrex", "BTC-ETH", "market_histories",
+			map[string]string{"market": "BTC-ETH"}},
+		{"poloniex", "BTC", "trade_updates",
+			map[string]string{"market": "BTC"}},
+	}
+
+	for _, tt := range tests {
+
+		tags := map[string]string{"market": tt.market}
+		AddTags(tt.exchange, tt.market, tt.measurement, tags)
+
+		if len(tags) != len(tt.want) || tags["base"] != tt.want["base"] ||
+			tags["quote"] != tt.want["quote"] {
+			t.Errorf("%s %s %s: got %v, want %v", tt.exchange, tt.market,
+				tt.measurement, tags, tt.want)
+		}
+	}
+}
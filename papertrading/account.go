@@ -0,0 +1,446 @@
+package papertrading
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"trading/networking/feed"
+	"trading/networking/symbols"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+)
+
+const (
+	SideBuy  = feed.SideBuy
+	SideSell = feed.SideSell
+
+	StatusOpen     = "open"
+	StatusFilled   = "filled"
+	StatusCanceled = "canceled"
+)
+
+// Account is the simulated account of an exchange: balances by canonical
+// currency and open limit orders (oldest first).
+type Account struct {
+	exchange string
+	source   *sourceConf
+	now      int64
+	balances map[string]*balance
+	orders   []*Order
+	books    map[string]*Book
+	prices   map[string]float64
+	rates    map[string]float64
+	// last timestamps of the orders and fills points
+	lastOrderPoint int64
+	lastFillPoint  int64
+}
+
+// balance reserved is held by the open orders.
+type balance struct {
+	available float64
+	reserved  float64
+}
+
+// Order is a limit order. Buys reserve the base currency (fee included),
+// sells the quote currency.
+type Order struct {
+	ID       int64
+	Market   string
+	Side     string
+	Rate     float64
+	Quantity float64
+	Filled   float64
+	Status   string
+	Created  time.Time
+	base     string
+	quote    string
+}
+
+// order ids are unique across restarts
+var lastOrderID = time.Now().UnixNano()
+
+func newAccount(exchange string, source *sourceConf) *Account {
+
+	a := &Account{
+		exchange: exchange,
+		source:   source,
+		balances: make(map[string]*balance, len(source.Balances)),
+		books:    make(map[string]*Book),
+		prices:   make(map[string]float64),
+		rates: map[string]float64{
+			conf.PaperTrading.EquityCurrency: 1.0,
+		},
+	}
+
+	for currency, amount := range source.Balances {
+		a.balances[currency] = &balance{available: amount}
+	}
+
+	return a
+}
+
+func (a *Account) Exchange() string {
+	return a.exchange
+}
+
+// Time returns the time of the event being dispatched.
+func (a *Account) Time() time.Time {
+	return time.Unix(0, a.now).UTC()
+}
+
+// Balance returns the available balance of a canonical currency.
+func (a *Account) Balance(currency string) float64 {
+
+	if b, ok := a.balances[currency]; ok {
+		return b.available
+	}
+
+	return 0.0
+}
+
+// OpenOrders returns the open orders of market (all markets if empty).
+func (a *Account) OpenOrders(market string) []*Order {
+
+	orders := make([]*Order, 0)
+	for _, o := range a.orders {
+		if market == "" || o.Market == market {
+			orders = append(orders, o)
+		}
+	}
+
+	return orders
+}
+
+// Price returns the last price of market (0 if none yet).
+func (a *Account) Price(market string) float64 {
+	return a.prices[market]
+}
+
+// Book returns the last order book of market (nil if none yet).
+func (a *Account) Book(market string) *Book {
+	return a.books[market]
+}
+
+// Equity returns the balances valued in the equity currency at the last
+// prices, currencies without price excluded.
+func (a *Account) Equity() float64 {
+
+	equity := 0.0
+	for currency, b := range a.balances {
+		equity += (b.available + b.reserved) * a.rates[currency]
+	}
+
+	return equity
+}
+
+// Limit places a limit order of quantity at rate on market, reserving its
+// balance.
+func (a *Account) Limit(market, side string, rate,
+	quantity float64) (*Order, error) {
+
+	if rate <= 0.0 || quantity <= 0.0 {
+		return nil, fmt.Errorf("invalid order: %f at %f", quantity, rate)
+	}
+
+	pair, err := symbols.Canonical(a.exchange, market)
+	if err != nil {
+		return nil, fmt.Errorf("symbols.Canonical: %v", err)
+	}
+
+	o := &Order{
+		Market:   market,
+		Side:     side,
+		Rate:     rate,
+		Quantity: quantity,
+		Status:   StatusOpen,
+		Created:  a.Time(),
+		base:     pair.Base,
+		quote:    pair.Quote,
+	}
+
+	var currency string
+	var amount float64
+
+	switch side {
+	case SideBuy:
+		currency = pair.Base
+		amount = rate * quantity * (1 + a.source.MakerFee)
+	case SideSell:
+		currency = pair.Quote
+		amount = quantity
+	default:
+		return nil, fmt.Errorf("unknown side: %s", side)
+	}
+
+	b := a.balance(currency)
+	if amount > b.available {
+		return nil, fmt.Errorf("insufficient %s balance: %f < %f",
+			currency, b.available, amount)
+	}
+
+	b.available -= amount
+	b.reserved += amount
+
+	lastOrderID++
+	o.ID = lastOrderID
+	a.orders = append(a.orders, o)
+
+	a.prepareOrderPoint(o)
+
+	return o, nil
+}
+
+// Cancel cancels an open order, releasing its remaining balance.
+func (a *Account) Cancel(id int64) error {
+
+	for i, o := range a.orders {
+
+		if o.ID != id {
+			continue
+		}
+
+		currency, amount := o.remaining(a.source.MakerFee)
+		b := a.balance(currency)
+		b.reserved -= amount
+		b.available += amount
+
+		o.Status = StatusCanceled
+		a.orders = append(a.orders[:i], a.orders[i+1:]...)
+
+		a.prepareOrderPoint(o)
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown order: %d", id)
+}
+
+// remaining returns the currency and amount still reserved by o.
+func (o *Order) remaining(fee float64) (string, float64) {
+
+	quantity := o.Quantity - o.Filled
+
+	if o.Side == SideBuy {
+		return o.base, o.Rate * quantity * (1 + fee)
+	}
+
+	return o.quote, quantity
+}
+
+func (a *Account) balance(currency string) *balance {
+
+	b, ok := a.balances[currency]
+	if !ok {
+		b = &balance{}
+		a.balances[currency] = b
+	}
+
+	return b
+}
+
+// setPrice sets the last price of market and the rate of its currencies in
+// the equity currency.
+func (a *Account) setPrice(market string, price float64) {
+
+	if price == 0.0 {
+		return
+	}
+
+	a.prices[market] = price
+
+	pair, err := symbols.Canonical(a.exchange, market)
+	if err != nil {
+		return
+	}
+
+	switch conf.PaperTrading.EquityCurrency {
+	case pair.Base:
+		a.rates[pair.Quote] = price
+	case pair.Quote:
+		a.rates[pair.Base] = 1 / price
+	}
+}
+
+// fillOrders fills the open orders of the market crossed by the trade
+// print (strictly better price), oldest first and up to the quantity
+// traded. Orders are filled at their rate and pay the maker fee.
+func (a *Account) fillOrders(trade *Trade) {
+
+	remaining := trade.Quantity
+	open := a.orders[:0]
+	points := make([]*ifxClient.Point, 0)
+
+	for _, o := range a.orders {
+
+		crossed := o.Side == SideBuy && trade.Rate < o.Rate ||
+			o.Side == SideSell && trade.Rate > o.Rate
+
+		if o.Market != trade.Market || !crossed || remaining == 0.0 {
+			open = append(open, o)
+			continue
+		}
+
+		quantity := o.Quantity - o.Filled
+		if quantity > remaining {
+			quantity = remaining
+		}
+		remaining -= quantity
+		o.Filled += quantity
+
+		total := o.Rate * quantity
+		fee := total * a.source.MakerFee
+
+		if o.Side == SideBuy {
+			a.balance(o.base).reserved -= total + fee
+			a.balance(o.quote).available += quantity
+		} else {
+			a.balance(o.quote).reserved -= quantity
+			a.balance(o.base).available += total - fee
+		}
+
+		if pt := a.newFillPoint(o, trade, quantity, fee); pt != nil {
+			points = append(points, pt)
+		}
+
+		if o.Filled < o.Quantity {
+			open = append(open, o)
+		} else {
+			o.Status = StatusFilled
+		}
+
+		a.prepareOrderPoint(o)
+	}
+
+	a.orders = open
+
+	sendBatchPoints(a.exchange+"Fills", points)
+}
+
+func (a *Account) prepareOrderPoint(o *Order) {
+
+	measurement := conf.PaperTrading.Schema["orders_measurement"]
+
+	tags := map[string]string{
+		"exchange": a.exchange,
+		"market":   o.Market,
+		"side":     o.Side,
+		"status":   o.Status,
+	}
+
+	fields := map[string]interface{}{
+		"order_id": strconv.FormatInt(o.ID, 10),
+		"rate":     o.Rate,
+		"quantity": o.Quantity,
+		"filled":   o.Filled,
+	}
+
+	pt, err := ifxClient.NewPoint(measurement, tags, fields,
+		nextPointTime(&a.lastOrderPoint, a.Time()))
+	if err != nil {
+		logger.WithField("error", err).Error(
+			"prepareOrderPoint: ifxClient.NewPoint")
+		return
+	}
+
+	sendBatchPoints(a.exchange+"Orders", []*ifxClient.Point{pt})
+}
+
+func (a *Account) newFillPoint(o *Order, trade *Trade, quantity,
+	fee float64) *ifxClient.Point {
+
+	measurement := conf.PaperTrading.Schema["fills_measurement"]
+
+	tags := map[string]string{
+		"exchange": a.exchange,
+		"market":   o.Market,
+		"side":     o.Side,
+	}
+
+	fields := map[string]interface{}{
+		"order_id":   strconv.FormatInt(o.ID, 10),
+		"rate":       o.Rate,
+		"quantity":   quantity,
+		"fee":        fee,
+		"trade_rate": trade.Rate,
+	}
+
+	pt, err := ifxClient.NewPoint(measurement, tags, fields,
+		nextPointTime(&a.lastFillPoint, trade.Time))
+	if err != nil {
+		logger.WithField("error", err).Error(
+			"newFillPoint: ifxClient.NewPoint")
+		return nil
+	}
+
+	return pt
+}
+
+// nextPointTime returns timestamp, moved to the nanosecond following last if
+// not after it: the points of the orders sharing a series (order_id being a
+// field) are kept apart.
+func nextPointTime(last *int64, timestamp time.Time) time.Time {
+
+	ns := timestamp.UnixNano()
+	if ns <= *last {
+		ns = *last + 1
+	}
+	*last = ns
+
+	return time.Unix(0, ns)
+}
+
+// prepareBalancesPoints writes the balances and the equity of the account
+// at the run time.
+func (a *Account) prepareBalancesPoints() {
+
+	timestamp := a.Time()
+	points := make([]*ifxClient.Point, 0, len(a.balances)+1)
+
+	for currency, b := range a.balances {
+
+		tags := map[string]string{
+			"exchange": a.exchange,
+			"currency": currency,
+		}
+
+		fields := map[string]interface{}{
+			"available": b.available,
+			"reserved":  b.reserved,
+		}
+
+		if rate, ok := a.rates[currency]; ok {
+			fields["value"] = (b.available + b.reserved) * rate
+		}
+
+		pt, err := ifxClient.NewPoint(
+			conf.PaperTrading.Schema["balances_measurement"],
+			tags, fields, timestamp)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareBalancesPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+	}
+
+	tags := map[string]string{
+		"exchange": a.exchange,
+		"currency": conf.PaperTrading.EquityCurrency,
+	}
+
+	fields := map[string]interface{}{
+		"equity":      a.Equity(),
+		"open_orders": len(a.orders),
+	}
+
+	pt, err := ifxClient.NewPoint(conf.PaperTrading.Schema["equity_measurement"],
+		tags, fields, timestamp)
+	if err != nil {
+		logger.WithField("error", err).Error(
+			"prepareBalancesPoints: ifxClient.NewPoint")
+	} else {
+		points = append(points, pt)
+	}
+
+	sendBatchPoints(a.exchange+"Balances", points)
+}
@@ -0,0 +1,122 @@
+package papertrading
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+)
+
+var testStart = time.Date(2017, 10, 2, 0, 0, 0, 0, time.UTC)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1.0, math.Abs(b))
+}
+
+func TestFillOrders(t *testing.T) {
+
+	a := newAccount("poloniex", conf.PaperTrading.Sources["poloniex"])
+	a.now = testStart.UnixNano()
+
+	orders := []struct {
+		market   string
+		side     string
+		rate     float64
+		quantity float64
+	}{
+		{"BTC_ETH", SideBuy, 0.05, 2},
+		{"BTC_ETH", SideBuy, 0.05, 3},
+		{"BTC_ETH", SideSell, 0.06, 1},
+		{"BTC_XMR", SideBuy, 0.01, 1},
+	}
+
+	for _, o := range orders {
+		if _, err := a.Limit(o.market, o.side, o.rate, o.quantity); err != nil {
+			t.Fatalf("Limit: %v", err)
+		}
+	}
+	drainBatchs()
+
+	tests := []struct {
+		name   string
+		trade  *Trade
+		open   int
+		fills  int
+		btc    [2]float64 // available, reserved
+		eth    [2]float64
+		filled []float64 // of the open orders
+	}{
+		{"not crossed", &Trade{Market: "BTC_ETH", Rate: 0.05, Quantity: 10},
+			4, 0, [2]float64{9.73948, 0.26052}, [2]float64{9, 1},
+			[]float64{0, 0, 0, 0}},
+		{"oldest buys first", &Trade{Market: "BTC_ETH", Rate: 0.049,
+			Quantity: 4}, 3, 2, [2]float64{9.73948, 0.06012},
+			[2]float64{13, 1}, []float64{2, 0, 0}},
+		{"sell", &Trade{Market: "BTC_ETH", Rate: 0.061, Quantity: 5},
+			2, 1, [2]float64{9.79936, 0.06012}, [2]float64{13, 0},
+			[]float64{2, 0}},
+	}
+
+	for _, tt := range tests {
+
+		tt.trade.Time = testStart
+		a.fillOrders(tt.trade)
+		points := drainBatchs()
+
+		btc, eth := a.balance("BTC"), a.balance("ETH")
+		if len(a.orders) != tt.open ||
+			!approxEqual(btc.available, tt.btc[0]) ||
+			!approxEqual(btc.reserved, tt.btc[1]) ||
+			!approxEqual(eth.available, tt.eth[0]) ||
+			!approxEqual(eth.reserved, tt.eth[1]) {
+			t.Errorf("%s: got %d orders, BTC %+v, ETH %+v, want %d, %v, %v",
+				tt.name, len(a.orders), *btc, *eth, tt.open, tt.btc, tt.eth)
+			continue
+		}
+
+		for i, o := range a.orders {
+			if o.Filled != tt.filled[i] {
+				t.Errorf("%s: order %d filled %v, want %v", tt.name, i,
+					o.Filled, tt.filled[i])
+			}
+		}
+
+		fills := points["poloniexFills"]
+		if len(fills) != tt.fills {
+			t.Errorf("%s: got %d fills, want %d", tt.name, len(fills), tt.fills)
+			continue
+		}
+
+		// fills of a same trade are kept apart, order ids being fields
+		for i, pt := range fills {
+
+			fields, _ := pt.Fields()
+			if _, ok := fields["order_id"]; !ok {
+				t.Errorf("%s: fill %d without order_id", tt.name, i)
+			}
+			if _, ok := pt.Tags()["order_id"]; ok {
+				t.Errorf("%s: fill %d tagged with order_id", tt.name, i)
+			}
+			if i != 0 && !pt.Time().After(fills[i-1].Time()) {
+				t.Errorf("%s: fill %d at %s, not after the previous one",
+					tt.name, i, pt.Time())
+			}
+		}
+	}
+}
+
+// drainBatchs returns the points sent since the last call by type.
+func drainBatchs() map[string][]*ifxClient.Point {
+
+	points := make(map[string][]*ifxClient.Point)
+
+	for {
+		select {
+		case bp := <-batchsToWrite:
+			points[bp.TypePoint] = append(points[bp.TypePoint], bp.Points...)
+		default:
+			return points
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"trading/networking/symbols"
+	"trading/papertrading"
+
+	"github.com/sirupsen/logrus"
+)
+
+// spread quotes each market spread_percent away from the last tick: a buy
+// below the bid investing a fraction of the base balance, then a sell above
+// the ask of the quantity held. Orders are replaced at every tick.
+type spread struct {
+	percent  float64
+	fraction float64
+}
+
+func (s *spread) OnTick(a *papertrading.Account, t *papertrading.Tick) {
+
+	if t.Bid == 0.0 || t.Ask == 0.0 {
+		return
+	}
+
+	for _, o := range a.OpenOrders(t.Market) {
+		if err := a.Cancel(o.ID); err != nil {
+			logrus.WithField("error", err).Error("OnTick: a.Cancel")
+		}
+	}
+
+	pair, err := symbols.Canonical(a.Exchange(), t.Market)
+	if err != nil {
+		return
+	}
+
+	if held := a.Balance(pair.Quote); held != 0.0 {
+		rate := t.Ask * (1 + s.percent/100)
+		if _, err := a.Limit(t.Market, papertrading.SideSell, rate,
+			held); err != nil {
+			logrus.WithField("error", err).Error("OnTick: a.Limit")
+		}
+		return
+	}
+
+	rate := t.Bid * (1 - s.percent/100)
+	quantity := a.Balance(pair.Base) * s.fraction / rate
+	if _, err := a.Limit(t.Market, papertrading.SideBuy, rate,
+		quantity); err != nil {
+		logrus.WithField("error", err).Error("OnTick: a.Limit")
+	}
+}
+
+func (s *spread) OnTrade(a *papertrading.Account, t *papertrading.Trade) {}
+
+func (s *spread) OnBook(a *papertrading.Account, b *papertrading.Book) {}
+
+func main() {
+
+	papertrading.Run(&spread{percent: 0.5, fraction: 0.1})
+
+	select {}
+}
@@ -0,0 +1,140 @@
+package papertrading
+
+import (
+	"fmt"
+	"trading/networking"
+	"trading/networking/database"
+	"trading/networking/feed"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// queryFeed runs query on the database of the exchange, false if it keeps
+// failing over the run.
+func queryFeed(source *sourceConf, query, errorMsg string) (
+	[]ifxClient.Result, bool) {
+
+	var res []ifxClient.Result
+
+	request := func() (err error) {
+		res, err = database.QueryDB(dbClient, query, source.Schema["database"])
+		return err
+	}
+
+	success := networking.ExecuteRequest(&networking.RequestInfo{
+		Logger:   logger.WithField("query", query),
+		Period:   conf.PaperTrading.frequency,
+		ErrorMsg: errorMsg,
+		Request:  request,
+	})
+
+	return res, success
+}
+
+// marketsCondition returns the where clause restricting a query to the
+// markets of the source (all markets if none).
+func (source *sourceConf) marketsCondition() string {
+	return feed.MarketsCondition(source.Markets)
+}
+
+func getTrades(exchange string, source *sourceConf,
+	start, end int64) ([]*Trade, bool) {
+
+	query := feed.TradesQuery(source.Schema["trades_measurement"],
+		start, end, source.Markets)
+
+	res, ok := queryFeed(source, query, "getTrades: database.QueryDB")
+	if !ok {
+		return nil, false
+	}
+
+	return feed.ParseTrades(exchange, res), true
+}
+
+// getTicks returns the last tick of each market within [start, end).
+func getTicks(exchange string, source *sourceConf,
+	start, end int64) ([]*Tick, bool) {
+
+	tf := source.TickFields
+
+	query := fmt.Sprintf(
+		`SELECT %s, %s, %s
+    FROM %s
+    WHERE time >= %d AND time < %d%s
+    GROUP BY market ORDER BY time DESC LIMIT 1`,
+		tf["last"], tf["bid"], tf["ask"],
+		source.Schema["ticks_measurement"],
+		start, end, source.marketsCondition())
+
+	res, ok := queryFeed(source, query, "getTicks: database.QueryDB")
+	if !ok {
+		return nil, false
+	}
+
+	ticks := make([]*Tick, 0, len(res[0].Series))
+
+	for _, serie := range res[0].Series {
+
+		market := serie.Tags["market"]
+		rec := serie.Values[0]
+
+		timestamp, err := networking.ConvertJsonValueToTime(rec[0])
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": exchange,
+				"market":   market,
+			}).Error("getTicks: networking.ConvertJsonValueToTime")
+			continue
+		}
+
+		values := make([]float64, 3)
+		for i, v := range rec[1:] {
+
+			if v == nil {
+				continue
+			}
+
+			if values[i], err = networking.ConvertJsonValueToFloat64(
+				v); err != nil {
+				break
+			}
+		}
+
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"error":    err,
+				"exchange": exchange,
+				"market":   market,
+			}).Error("getTicks: networking.ConvertJsonValueToFloat64")
+			continue
+		}
+
+		ticks = append(ticks, &Tick{
+			Market: market,
+			Time:   timestamp,
+			Last:   values[0],
+			Bid:    values[1],
+			Ask:    values[2],
+		})
+	}
+
+	return ticks, true
+}
+
+// getBooks returns the order books stored by the ingestion within
+// [start, end).
+func getBooks(exchange string, source *sourceConf,
+	start, end int64) ([]*Book, bool) {
+
+	query := feed.BooksQuery(source.Schema["book_orders_measurement"],
+		start, end, source.Markets)
+
+	res, ok := queryFeed(source, query, "getBooks: database.QueryDB")
+	if !ok {
+		return nil, false
+	}
+
+	return feed.ParseBooks(exchange, res), true
+}
@@ -0,0 +1,290 @@
+package papertrading
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"time"
+	"trading/networking"
+	"trading/networking/database"
+	"trading/networking/feed"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+	prefixed "github.com/x-cray/logrus-prefixed-formatter"
+)
+
+var (
+	conf          *configuration
+	logger        *logrus.Entry
+	dbClient      ifxClient.Client
+	batchsToWrite chan *database.BatchPoints
+)
+
+type configuration struct {
+	PaperTrading *paperTradingConf `json:"papertrading"`
+}
+
+// paperTradingConf polls the exchanges databases every frequency and values
+// the accounts in equity_currency. Orders, fills, balances and equity are
+// written to the schema database.
+type paperTradingConf struct {
+	LogLevel            string                 `json:"log_level"`
+	Schema              map[string]string      `json:"schema"`
+	FlushBatchsPeriodMs int                    `json:"flush_batchs_period_ms"`
+	FlushCapacity       int                    `json:"flush_capacity"`
+	Frequency           string                 `json:"frequency"`
+	EquityCurrency      string                 `json:"equity_currency"`
+	Sources             map[string]*sourceConf `json:"sources"`
+	frequency           time.Duration
+}
+
+// sourceConf sets the markets traded on an exchange (all if empty), the
+// initial balances by canonical currency and the maker fee (rate) of the
+// limit orders. Data is read update_lag behind the run time, tick_fields
+// naming the last, bid and ask fields of the ticks.
+type sourceConf struct {
+	Schema     map[string]string  `json:"schema"`
+	Markets    []string           `json:"markets"`
+	Balances   map[string]float64 `json:"balances"`
+	MakerFee   float64            `json:"maker_fee"`
+	UpdateLag  string             `json:"update_lag"`
+	TickFields map[string]string  `json:"tick_fields"`
+	updateLag  time.Duration
+}
+
+// Strategy receives the live events of each exchange in time order and
+// places its orders on the account of the exchange. Accounts are not safe
+// for use outside of the callbacks.
+type Strategy interface {
+	OnTick(a *Account, t *Tick)
+	OnTrade(a *Account, t *Trade)
+	OnBook(a *Account, b *Book)
+}
+
+type Tick struct {
+	Market string
+	Time   time.Time
+	Last   float64
+	Bid    float64
+	Ask    float64
+}
+
+// trades and order books are read from the feed stored by the ingestion
+type (
+	Trade = feed.Trade
+	Book  = feed.Book
+	Level = feed.Level
+)
+
+// events of a same timestamp are dispatched books first, then ticks and
+// trades
+const (
+	eventBook = iota
+	eventTick
+	eventTrade
+)
+
+type event struct {
+	timestamp int64
+	kind      int
+	book      *Book
+	tick      *Tick
+	trade     *Trade
+}
+
+func init() {
+
+	customFormatter := new(prefixed.TextFormatter)
+	customFormatter.FullTimestamp = true
+	customFormatter.ForceColors = true
+	customFormatter.ForceFormatting = true
+	logrus.SetFormatter(customFormatter)
+
+	logger = logrus.WithField("prefix", "[papertrading]")
+
+	content, err := ioutil.ReadFile("conf.json")
+
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading configuration")
+	}
+
+	if err := json.Unmarshal(content, &conf); err != nil {
+		logger.WithField("error", err).Fatal("loading configuration")
+	}
+
+	switch conf.PaperTrading.LogLevel {
+	case "debug":
+		logrus.SetLevel(logrus.DebugLevel)
+	case "info":
+		logrus.SetLevel(logrus.InfoLevel)
+	case "warn":
+		logrus.SetLevel(logrus.WarnLevel)
+	case "error":
+		logrus.SetLevel(logrus.ErrorLevel)
+	case "fatal":
+		logrus.SetLevel(logrus.FatalLevel)
+	case "panic":
+		logrus.SetLevel(logrus.PanicLevel)
+	default:
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+
+	if conf.PaperTrading.frequency, err = time.ParseDuration(
+		conf.PaperTrading.Frequency); err != nil {
+		logger.WithField("error", err).Fatal("time.ParseDuration")
+	}
+
+	for _, source := range conf.PaperTrading.Sources {
+		if source.updateLag, err = time.ParseDuration(
+			source.UpdateLag); err != nil {
+			logger.WithField("error", err).Fatal("time.ParseDuration")
+		}
+	}
+
+	if dbClient, err = database.NewdbClient(); err != nil {
+		logger.WithField("error", err).Fatal("database.NewdbClient")
+	}
+
+	batchsToWrite = make(chan *database.BatchPoints,
+		conf.PaperTrading.FlushCapacity)
+}
+
+// Run paper trades strategy on the exchanges of the configuration from now
+// on, starting from the configured balances.
+func Run(strategy Strategy) {
+
+	// flushing batchs periodically
+	period := time.Duration(conf.PaperTrading.FlushBatchsPeriodMs) *
+		time.Millisecond
+
+	go database.FlushEvery(period, &database.FlushInfo{
+		batchsToWrite,
+		conf.PaperTrading.Schema["database"],
+		dbClient,
+	})
+
+	accounts := make(map[string]*Account, len(conf.PaperTrading.Sources))
+	polled := make(map[string]int64, len(conf.PaperTrading.Sources))
+
+	for exchange, source := range conf.PaperTrading.Sources {
+		accounts[exchange] = newAccount(exchange, source)
+		polled[exchange] = time.Now().UnixNano() - int64(source.updateLag)
+	}
+
+	go networking.RunEvery(conf.PaperTrading.frequency, func(nextRun int64) {
+
+		for exchange, source := range conf.PaperTrading.Sources {
+
+			a := accounts[exchange]
+			end := nextRun - int64(source.updateLag)
+
+			// polled again at the next run if the feed can't be read
+			events, ok := getEvents(exchange, source, polled[exchange], end)
+			if ok {
+				polled[exchange] = end
+			}
+
+			for _, e := range events {
+				a.dispatch(strategy, e)
+			}
+
+			a.now = nextRun
+			a.prepareBalancesPoints()
+		}
+	})
+}
+
+// getEvents returns the events of an exchange within [start, end) sorted by
+// time, false if the feed could not be read.
+func getEvents(exchange string, source *sourceConf,
+	start, end int64) ([]*event, bool) {
+
+	events := make([]*event, 0)
+
+	if _, ok := source.Schema["book_orders_measurement"]; ok {
+
+		books, ok := getBooks(exchange, source, start, end)
+		if !ok {
+			return nil, false
+		}
+
+		for _, b := range books {
+			events = append(events, &event{
+				timestamp: b.Time.UnixNano(),
+				kind:      eventBook,
+				book:      b,
+			})
+		}
+	}
+
+	if _, ok := source.Schema["ticks_measurement"]; ok {
+
+		ticks, ok := getTicks(exchange, source, start, end)
+		if !ok {
+			return nil, false
+		}
+
+		for _, t := range ticks {
+			events = append(events, &event{
+				timestamp: t.Time.UnixNano(),
+				kind:      eventTick,
+				tick:      t,
+			})
+		}
+	}
+
+	trades, ok := getTrades(exchange, source, start, end)
+	if !ok {
+		return nil, false
+	}
+
+	for _, t := range trades {
+		events = append(events, &event{
+			timestamp: t.Time.UnixNano(),
+			kind:      eventTrade,
+			trade:     t,
+		})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].timestamp != events[j].timestamp {
+			return events[i].timestamp < events[j].timestamp
+		}
+		return events[i].kind < events[j].kind
+	})
+
+	return events, true
+}
+
+func (a *Account) dispatch(strategy Strategy, e *event) {
+
+	a.now = e.timestamp
+
+	switch e.kind {
+	case eventBook:
+		a.books[e.book.Market] = e.book
+		strategy.OnBook(a, e.book)
+
+	case eventTick:
+		a.setPrice(e.tick.Market, e.tick.Last)
+		strategy.OnTick(a, e.tick)
+
+	case eventTrade:
+		a.setPrice(e.trade.Market, e.trade.Rate)
+		a.fillOrders(e.trade)
+		strategy.OnTrade(a, e.trade)
+	}
+}
+
+func sendBatchPoints(typePoint string, points []*ifxClient.Point) {
+
+	if len(points) == 0 {
+		return
+	}
+
+	batchsToWrite <- &database.BatchPoints{
+		TypePoint: typePoint,
+		Points:    points,
+	}
+}
@@ -0,0 +1,283 @@
+package signals
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"trading/networking/bus"
+)
+
+// maCrossoverConf emits a signal when the fast average (sma or ema) of
+// ma_<period> crosses the slow one: long when crossing above.
+type maCrossoverConf struct {
+	Period  string `json:"period"`
+	Average string `json:"average"`
+	Fast    int    `json:"fast"`
+	Slow    int    `json:"slow"`
+}
+
+// rsiThresholdConf emits a signal when rsi_<length> of rsi_<period> enters
+// the oversold (long) or overbought (short) zone, 0 < oversold < overbought
+// < 100.
+type rsiThresholdConf struct {
+	Period     string  `json:"period"`
+	Length     int     `json:"length"`
+	Oversold   float64 `json:"oversold"`
+	Overbought float64 `json:"overbought"`
+}
+
+// depthImbalanceConf emits a signal when the imbalance of the market depths
+// of interval (tag) reaches threshold (0 to 1 excluded): long when the bids
+// dominate.
+type depthImbalanceConf struct {
+	Interval  string  `json:"interval"`
+	Threshold float64 `json:"threshold"`
+}
+
+// zoneSeries is the zone (-1, 0 or 1) of a series at its last timestamp and
+// at the timestamp before. Points rewritten at the same timestamp (open
+// intervals) replace the last zone.
+type zoneSeries struct {
+	timestamp int64
+	zone      int
+	previous  int
+	emitted   int64
+}
+
+type zones map[string]*zoneSeries
+
+// enter returns whether the series entered a non neutral zone at timestamp,
+// once per timestamp.
+func (z zones) enter(key string, timestamp int64, zone int) bool {
+
+	s, ok := z[key]
+	if !ok {
+		z[key] = &zoneSeries{timestamp: timestamp, zone: zone, previous: zone}
+		return false
+	}
+
+	switch {
+	case timestamp > s.timestamp:
+		s.previous = s.zone
+		s.timestamp = timestamp
+	case timestamp < s.timestamp:
+		return false
+	}
+	s.zone = zone
+
+	if zone == 0 || zone == s.previous || s.emitted == timestamp {
+		return false
+	}
+	s.emitted = timestamp
+
+	return true
+}
+
+func direction(zone int) string {
+
+	if zone > 0 {
+		return DirectionLong
+	}
+
+	return DirectionShort
+}
+
+func getFloat64(fields map[string]interface{}, name string) (float64, bool) {
+
+	switch v := fields[name].(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+
+	return 0.0, false
+}
+
+type maCrossover struct {
+	conf        *maCrossoverConf
+	measurement string
+	fast        string
+	slow        string
+	zones       zones
+}
+
+func newMACrossover(mc *maCrossoverConf) *maCrossover {
+
+	return &maCrossover{
+		conf:        mc,
+		measurement: "ma_" + mc.Period,
+		fast:        mc.Average + "_" + strconv.Itoa(mc.Fast),
+		slow:        mc.Average + "_" + strconv.Itoa(mc.Slow),
+		zones:       make(zones),
+	}
+}
+
+func (mc *maCrossover) Name() string {
+	return fmt.Sprintf("%s_cross_%s_%s", mc.fast, mc.slow, mc.conf.Period)
+}
+
+func (mc *maCrossover) Measurements() []string {
+	return []string{mc.measurement}
+}
+
+// OnPoint strength is the gap between the averages in percent of the slow
+// one (1% and more being full strength).
+func (mc *maCrossover) OnPoint(p *bus.Point) []*Signal {
+
+	fast, ok := getFloat64(p.Fields, mc.fast)
+	if !ok {
+		return nil
+	}
+
+	slow, ok := getFloat64(p.Fields, mc.slow)
+	if !ok || slow == 0.0 {
+		return nil
+	}
+
+	zone := 0
+	switch {
+	case fast > slow:
+		zone = 1
+	case fast < slow:
+		zone = -1
+	}
+
+	key := p.Tags["exchange"] + "/" + p.Tags["market"]
+	if !mc.zones.enter(key, p.Time.UnixNano(), zone) {
+		return nil
+	}
+
+	return []*Signal{{
+		Kind:      "ma_crossover",
+		Exchange:  p.Tags["exchange"],
+		Market:    p.Tags["market"],
+		Direction: direction(zone),
+		Strength:  math.Min(1, math.Abs(fast-slow)/slow*100),
+		Time:      p.Time,
+		Source:    p.Measurement,
+		Inputs:    map[string]float64{mc.fast: fast, mc.slow: slow},
+	}}
+}
+
+type rsiThreshold struct {
+	conf        *rsiThresholdConf
+	measurement string
+	field       string
+	zones       zones
+}
+
+func newRSIThreshold(rc *rsiThresholdConf) *rsiThreshold {
+
+	return &rsiThreshold{
+		conf:        rc,
+		measurement: "rsi_" + rc.Period,
+		field:       "rsi_" + strconv.Itoa(rc.Length),
+		zones:       make(zones),
+	}
+}
+
+func (rt *rsiThreshold) Name() string {
+	return fmt.Sprintf("%s_threshold_%s", rt.field, rt.conf.Period)
+}
+
+func (rt *rsiThreshold) Measurements() []string {
+	return []string{rt.measurement}
+}
+
+// OnPoint strength is the depth of the rsi within its zone.
+func (rt *rsiThreshold) OnPoint(p *bus.Point) []*Signal {
+
+	rsi, ok := getFloat64(p.Fields, rt.field)
+	if !ok {
+		return nil
+	}
+
+	zone, strength := 0, 0.0
+	switch {
+	case rsi <= rt.conf.Oversold:
+		zone = 1
+		strength = (rt.conf.Oversold - rsi) / rt.conf.Oversold
+	case rsi >= rt.conf.Overbought:
+		zone = -1
+		strength = (rsi - rt.conf.Overbought) / (100 - rt.conf.Overbought)
+	}
+
+	key := p.Tags["exchange"] + "/" + p.Tags["market"]
+	if !rt.zones.enter(key, p.Time.UnixNano(), zone) {
+		return nil
+	}
+
+	return []*Signal{{
+		Kind:      "rsi_threshold",
+		Exchange:  p.Tags["exchange"],
+		Market:    p.Tags["market"],
+		Direction: direction(zone),
+		Strength:  strength,
+		Time:      p.Time,
+		Source:    p.Measurement,
+		Inputs:    map[string]float64{rt.field: rsi},
+	}}
+}
+
+type depthImbalance struct {
+	conf  *depthImbalanceConf
+	zones zones
+}
+
+func newDepthImbalance(dc *depthImbalanceConf) *depthImbalance {
+	return &depthImbalance{conf: dc, zones: make(zones)}
+}
+
+func (di *depthImbalance) Name() string {
+	return "depth_imbalance_" + di.conf.Interval
+}
+
+func (di *depthImbalance) Measurements() []string {
+	return []string{conf.Signals.Schema["market_depths_measurement"]}
+}
+
+// OnPoint strength is the share of the imbalance beyond the threshold.
+func (di *depthImbalance) OnPoint(p *bus.Point) []*Signal {
+
+	if p.Tags["interval"] != di.conf.Interval {
+		return nil
+	}
+
+	imbalance, ok := getFloat64(p.Fields, "imbalance")
+	if !ok {
+		return nil
+	}
+
+	zone := 0
+	switch {
+	case imbalance >= di.conf.Threshold:
+		zone = 1
+	case imbalance <= -di.conf.Threshold:
+		zone = -1
+	}
+
+	key := p.Tags["exchange"] + "/" + p.Tags["market"]
+	if !di.zones.enter(key, p.Time.UnixNano(), zone) {
+		return nil
+	}
+
+	bidDepth, _ := getFloat64(p.Fields, "bid_depth")
+	askDepth, _ := getFloat64(p.Fields, "ask_depth")
+
+	return []*Signal{{
+		Kind:      "depth_imbalance",
+		Exchange:  p.Tags["exchange"],
+		Market:    p.Tags["market"],
+		Direction: direction(zone),
+		Strength: (math.Abs(imbalance) - di.conf.Threshold) /
+			(1 - di.conf.Threshold),
+		Time:   p.Time,
+		Source: p.Measurement,
+		Inputs: map[string]float64{
+			"imbalance": imbalance,
+			"bid_depth": bidDepth,
+			"ask_depth": askDepth,
+		},
+	}}
+}
@@ -0,0 +1,88 @@
+package signals
+
+import (
+	"math"
+	"testing"
+	"time"
+	"trading/networking/bus"
+)
+
+var testStart = time.Date(2017, 10, 2, 0, 0, 0, 0, time.UTC)
+
+func TestZonesEnter(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		zone      int
+		want      bool
+	}{
+		{"first point", 0, 1, false},
+		{"same zone", 1, 1, false},
+		{"neutral", 2, 0, false},
+		{"entered", 3, 1, true},
+		{"rewritten", 3, 1, false},
+		{"rewritten neutral", 3, 0, false},
+		{"rewritten again", 3, 1, false},
+		{"older point", 2, -1, false},
+		{"opposite zone", 4, -1, true},
+		{"staying", 5, -1, false},
+	}
+
+	z := make(zones)
+
+	for _, tt := range tests {
+		got := z.enter("poloniex/BTC_ETH", tt.timestamp, tt.zone)
+		if got != tt.want {
+			t.Errorf("%s: got %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDepthImbalanceOnPoint(t *testing.T) {
+
+	di := newDepthImbalance(&depthImbalanceConf{
+		Interval:  "2.00",
+		Threshold: 0.5,
+	})
+
+	tests := []struct {
+		name      string
+		interval  string
+		imbalance float64
+		direction string // empty if no signal
+		strength  float64
+	}{
+		{"other interval", "5.00", 0.9, "", 0},
+		{"below threshold", "2.00", 0.4, "", 0},
+		{"bids", "2.00", 0.75, DirectionLong, 0.5},
+		{"asks", "2.00", -1, DirectionShort, 1},
+	}
+
+	for i, tt := range tests {
+
+		signals := di.OnPoint(&bus.Point{
+			Measurement: "market_depths",
+			Tags: map[string]string{
+				"exchange": "poloniex",
+				"market":   "BTC_ETH",
+				"interval": tt.interval,
+			},
+			Fields: map[string]interface{}{"imbalance": tt.imbalance},
+			Time:   testStart.Add(time.Duration(i) * time.Minute),
+		})
+
+		if tt.direction == "" {
+			if len(signals) != 0 {
+				t.Errorf("%s: got %+v, want no signal", tt.name, *signals[0])
+			}
+			continue
+		}
+
+		if len(signals) != 1 || signals[0].Direction != tt.direction ||
+			math.Abs(signals[0].Strength-tt.strength) > 1e-9 {
+			t.Errorf("%s: got %d signals, want %s of strength %v", tt.name,
+				len(signals), tt.direction, tt.strength)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package signals
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+	"trading/networking/bus"
+	"trading/networking/database"
+
+	ifxClient "github.com/influxdata/influxdb/client/v2"
+	"github.com/sirupsen/logrus"
+	prefixed "github.com/x-cray/logrus-prefixed-formatter"
+)
+
+var (
+	conf          *configuration
+	logger        *logrus.Entry
+	dbClient      ifxClient.Client
+	batchsToWrite chan *database.BatchPoints
+	generators    = &registry{}
+)
+
+type configuration struct {
+	Signals *signalsConf `json:"signals"`
+}
+
+// signalsConf sets the built-in generators run on the points published by
+// the metrics (same process). Each generator subscribes to its measurements
+// with capacity points buffered.
+type signalsConf struct {
+	LogLevel            string                `json:"log_level"`
+	Schema              map[string]string     `json:"schema"`
+	FlushBatchsPeriodMs int                   `json:"flush_batchs_period_ms"`
+	FlushCapacity       int                   `json:"flush_capacity"`
+	Capacity            int                   `json:"capacity"`
+	MACrossovers        []*maCrossoverConf    `json:"ma_crossovers"`
+	RSIThresholds       []*rsiThresholdConf   `json:"rsi_thresholds"`
+	DepthImbalances     []*depthImbalanceConf `json:"depth_imbalances"`
+}
+
+const (
+	DirectionLong  = "long"
+	DirectionShort = "short"
+)
+
+// Signal is emitted by a generator from a point of Source. Strength ranges
+// from 0 to 1 and Inputs are the values of the point it was derived from.
+type Signal struct {
+	Kind      string
+	Exchange  string
+	Market    string
+	Direction string
+	Strength  float64
+	Time      time.Time
+	Source    string
+	Inputs    map[string]float64
+}
+
+// Generator derives signals from the points of its measurements. Points
+// are received in order by a single goroutine per generator.
+type Generator interface {
+	Name() string
+	Measurements() []string
+	OnPoint(p *bus.Point) []*Signal
+}
+
+type registry struct {
+	sync.Mutex
+	generators []Generator
+}
+
+func init() {
+
+	customFormatter := new(prefixed.TextFormatter)
+	customFormatter.FullTimestamp = true
+	customFormatter.ForceColors = true
+	customFormatter.ForceFormatting = true
+	logrus.SetFormatter(customFormatter)
+
+	logger = logrus.WithField("prefix", "[signals]")
+
+	content, err := ioutil.ReadFile("conf.json")
+
+	if err != nil {
+		logger.WithField("error", err).Fatal("loading configuration")
+	}
+
+	if err := json.Unmarshal(content, &conf); err != nil {
+		logger.WithField("error", err).Fatal("loading configuration")
+	}
+
+	switch conf.Signals.LogLevel {
+	case "debug":
+		logrus.SetLevel(logrus.DebugLevel)
+	case "info":
+		logrus.SetLevel(logrus.InfoLevel)
+	case "warn":
+		logrus.SetLevel(logrus.WarnLevel)
+	case "error":
+		logrus.SetLevel(logrus.ErrorLevel)
+	case "fatal":
+		logrus.SetLevel(logrus.FatalLevel)
+	case "panic":
+		logrus.SetLevel(logrus.PanicLevel)
+	default:
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+
+	if dbClient, err = database.NewdbClient(); err != nil {
+		logger.WithField("error", err).Fatal("database.NewdbClient")
+	}
+
+	batchsToWrite = make(chan *database.BatchPoints, conf.Signals.FlushCapacity)
+
+	for _, mc := range conf.Signals.MACrossovers {
+
+		if (mc.Average != "sma" && mc.Average != "ema") || mc.Fast <= 0 ||
+			mc.Fast >= mc.Slow {
+			logger.WithFields(logrus.Fields{
+				"average": mc.Average,
+				"fast":    mc.Fast,
+				"slow":    mc.Slow,
+			}).Fatal("init: invalid ma crossover")
+		}
+
+		Register(newMACrossover(mc))
+	}
+
+	for _, rc := range conf.Signals.RSIThresholds {
+
+		if rc.Oversold <= 0 || rc.Overbought >= 100 ||
+			rc.Oversold >= rc.Overbought {
+			logger.WithFields(logrus.Fields{
+				"oversold":   rc.Oversold,
+				"overbought": rc.Overbought,
+			}).Fatal("init: invalid rsi thresholds")
+		}
+
+		Register(newRSIThreshold(rc))
+	}
+
+	for _, dc := range conf.Signals.DepthImbalances {
+
+		if dc.Threshold <= 0 || dc.Threshold >= 1 {
+			logger.WithField("threshold", dc.Threshold).Fatal(
+				"init: invalid depth imbalance threshold")
+		}
+
+		Register(newDepthImbalance(dc))
+	}
+}
+
+// Register adds a generator, to be registered before Run.
+func Register(g Generator) {
+
+	generators.Lock()
+	defer generators.Unlock()
+
+	generators.generators = append(generators.generators, g)
+}
+
+// Run subscribes the generators to their measurements and writes their
+// signals.
+func Run() {
+
+	// flushing batchs periodically
+	period := time.Duration(conf.Signals.FlushBatchsPeriodMs) * time.Millisecond
+
+	go database.FlushEvery(period, &database.FlushInfo{
+		batchsToWrite,
+		conf.Signals.Schema["database"],
+		dbClient,
+	})
+
+	generators.Lock()
+	defer generators.Unlock()
+
+	for _, g := range generators.generators {
+
+		subscription := bus.SubscribePoints(g.Measurements(),
+			conf.Signals.Capacity)
+
+		go func(g Generator) {
+			for p := range subscription.C {
+				prepareSignalsPoints(g.Name(), g.OnPoint(p))
+			}
+		}(g)
+	}
+}
+
+func prepareSignalsPoints(generator string, signals []*Signal) {
+
+	if len(signals) == 0 {
+		return
+	}
+
+	measurement := conf.Signals.Schema["signals_measurement"]
+	points := make([]*ifxClient.Point, 0, len(signals))
+
+	for _, s := range signals {
+
+		tags := map[string]string{
+			"generator": generator,
+			"kind":      s.Kind,
+			"exchange":  s.Exchange,
+			"market":    s.Market,
+			"direction": s.Direction,
+		}
+
+		fields := map[string]interface{}{
+			"strength": s.Strength,
+			"source":   s.Source,
+		}
+
+		for name, value := range s.Inputs {
+			fields[name] = value
+		}
+
+		pt, err := ifxClient.NewPoint(measurement, tags, fields, s.Time)
+		if err != nil {
+			logger.WithField("error", err).Error(
+				"prepareSignalsPoints: ifxClient.NewPoint")
+			continue
+		}
+		points = append(points, pt)
+
+		logger.WithFields(logrus.Fields{
+			"generator": generator,
+			"exchange":  s.Exchange,
+			"market":    s.Market,
+			"direction": s.Direction,
+			"strength":  s.Strength,
+		}).Info("prepareSignalsPoints: signal")
+	}
+
+	batchsToWrite <- &database.BatchPoints{
+		TypePoint: generator,
+		Points:    points,
+	}
+}